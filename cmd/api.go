@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSuggestions limits the users returned by /api/users/suggest.
+const maxSuggestions = 8
+
+type userSuggestion struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	Avatar      string `json:"avatar"`
+}
+
+type bookmarkJSON struct {
+	ID        int       `json:"id"`
+	PostID    int       `json:"postId"`
+	CommentID int       `json:"commentId,omitempty"`
+	Title     string    `json:"title"`
+	Comment   string    `json:"comment,omitempty"`
+	Folder    string    `json:"folder"`
+	Note      string    `json:"note"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type bookmarksJSON struct {
+	Bookmarks []bookmarkJSON `json:"bookmarks"`
+	Page      int            `json:"page"`
+	NextPage  int            `json:"nextPage,omitempty"`
+}
+
+type pollOptionJSON struct {
+	ID      int      `json:"id"`
+	Label   string   `json:"label"`
+	Votes   int      `json:"votes"`
+	Percent int      `json:"percent"`
+	Voters  []string `json:"voters,omitempty"`
+	Chosen  bool     `json:"chosen"`
+}
+
+type pollJSON struct {
+	PostID    int              `json:"postId"`
+	Question  string           `json:"question"`
+	Multiple  bool             `json:"multiple"`
+	Anonymous bool             `json:"anonymous"`
+	ClosesAt  *time.Time       `json:"closesAt,omitempty"`
+	Closed    bool             `json:"closed"`
+	Voters    int              `json:"voters"`
+	Voted     bool             `json:"voted"`
+	Options   []pollOptionJSON `json:"options"`
+}
+
+type APIHandler struct {
+	Service *services.Service
+}
+
+func NewAPIHandler(Service *services.Service) *APIHandler {
+	return &APIHandler{
+		Service: Service,
+	}
+}
+
+// MentionsScript serves the @mention autocomplete of the comment and post
+// forms, which calls UserSuggest.
+func (h *APIHandler) MentionsScript(w http.ResponseWriter, r *http.Request) {
+	serveScript(w, r, "./ui/static/mentions.js")
+}
+
+// UserSuggest serves /api/users/suggest?q= for @mention autocomplete.
+func (h *APIHandler) UserSuggest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	suggestions := []userSuggestion{}
+
+	prefix := strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("q")), "@")
+	if prefix == "" {
+		writeJSON(w, http.StatusOK, suggestions)
+		return
+	}
+
+	users, err := h.Service.UserService.SuggestUsers(prefix, maxSuggestions)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load users", http.StatusInternalServerError)
+		return
+	}
+
+	for _, user := range users {
+		suggestions = append(suggestions, userSuggestion{
+			Username:    user.Username,
+			DisplayName: user.DisplayName,
+			Avatar:      user.Avatar,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, suggestions)
+}
+
+// UnreadNotifications serves /api/notifications/unread for the header badge.
+func (h *APIHandler) UnreadNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if (user == models.User{}) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "not logged in"})
+		return
+	}
+
+	count, err := h.Service.NotificationService.CountUnread(user.ID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant count notifications", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"unread": count})
+}
+
+// Bookmarks serves /api/bookmarks. GET lists the bookmarks of the user with
+// the folder, category and page parameters of /bookmarks; POST toggles the
+// bookmark of postID, or of commentID in it, and tells whether it is set.
+func (h *APIHandler) Bookmarks(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if (user == models.User{}) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "not logged in"})
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		bookmark, err := bookmarkFromForm(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid bookmark"})
+			return
+		}
+
+		bookmarked, err := h.Service.BookmarkService.ToggleBookmark(bookmark)
+		if err != nil {
+			switch err {
+			case models.NotFoundAnything:
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			case models.ValueMismatch:
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "folder or note too long"})
+			case models.ErrForbidden:
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant save bookmark", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]bool{"bookmarked": bookmarked})
+	} else if r.Method == http.MethodGet {
+		bookmarks, _, pageNum, hasNext, err := loadBookmarks(h.Service, user, r.URL.Query())
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load bookmarks", http.StatusInternalServerError)
+			return
+		}
+
+		data := bookmarksJSON{Bookmarks: []bookmarkJSON{}, Page: pageNum}
+		if hasNext {
+			data.NextPage = pageNum + 1
+		}
+		for _, b := range bookmarks {
+			data.Bookmarks = append(data.Bookmarks, bookmarkJSON{
+				ID:        b.ID,
+				PostID:    b.PostID,
+				CommentID: b.CommentID,
+				Title:     b.Title,
+				Comment:   b.Comment,
+				Folder:    b.Folder,
+				Note:      b.Note,
+				URL:       b.Link(),
+				CreatedAt: b.CreatedAt,
+			})
+		}
+
+		writeJSON(w, http.StatusOK, data)
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Poll serves /api/polls/{postID}. GET returns the results of the poll of
+// the post; POST casts the vote of the user with the option parameters and
+// returns the results.
+func (h *APIHandler) Poll(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/polls/"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if r.Method == http.MethodPost {
+		if (user == models.User{}) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "not logged in"})
+			return
+		}
+
+		optionIDs, err := optionsFromForm(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid vote"})
+			return
+		}
+
+		if err := h.Service.PollService.Vote(user.ID, postID, optionIDs); err != nil {
+			switch err {
+			case models.ErrAlreadyVoted:
+				writeJSON(w, http.StatusConflict, map[string]string{"error": "already voted"})
+				return
+			case models.ErrPollClosed:
+				writeJSON(w, http.StatusConflict, map[string]string{"error": "poll is closed"})
+				return
+			case models.ValueMismatch:
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid options"})
+				return
+			}
+			pollError(w, err)
+			return
+		}
+	} else if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	poll, err := h.Service.PollService.GetPoll(user.ID, postID)
+	if err != nil {
+		pollError(w, err)
+		return
+	}
+
+	data := pollJSON{
+		PostID:    poll.PostID,
+		Question:  poll.Question,
+		Multiple:  poll.Multiple,
+		Anonymous: poll.Anonymous,
+		Closed:    poll.IsClosed(),
+		Voters:    poll.Voters,
+		Voted:     poll.Voted,
+		Options:   []pollOptionJSON{},
+	}
+	if !poll.ClosesAt.IsZero() {
+		data.ClosesAt = &poll.ClosesAt
+	}
+	for _, option := range poll.Options {
+		data.Options = append(data.Options, pollOptionJSON{
+			ID:      option.ID,
+			Label:   option.Label,
+			Votes:   option.Votes,
+			Percent: option.Percent,
+			Voters:  option.VoterNames,
+			Chosen:  option.Chosen,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, data)
+}
+
+func pollError(w http.ResponseWriter, err error) {
+	switch err {
+	case models.NotFoundAnything:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	case models.ErrForbidden:
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+	default:
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load poll", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
+}
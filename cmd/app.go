@@ -1,15 +1,36 @@
 package main
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"fmt"
+	"forum/pkg/events"
+	"forum/pkg/mailer"
+	"forum/pkg/models"
+	"forum/pkg/oauth"
 	"forum/pkg/services"
+	"forum/pkg/storage"
+	"forum/pkg/utils/breach"
 	"forum/pkg/utils/logger"
+	"forum/pkg/utils/validators"
 	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// webhookPollInterval is how often queued webhook deliveries are retried.
+const webhookPollInterval = 15 * time.Second
+
+// digestPollInterval is how often the digest job looks for users whose
+// daily or weekly digest is due.
+const digestPollInterval = 10 * time.Minute
+
 type Application struct {
 	Service *services.Service
 	Router  *http.ServeMux
@@ -18,22 +39,173 @@ type Application struct {
 }
 
 // Config struct to hold application configuration
-type Config struct { // Add configuration fields here
+type Config struct {
+	// BaseURL is used to build absolute links in emails.
+	BaseURL string
+	// Secret signs tokens sent by email.
+	Secret []byte
+
+	// SMTP relay; when SMTPAddr is empty mail is written to OutboxDir instead.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	OutboxDir    string
+
+	// PasswordPolicy applies to new passwords, which are also looked up in
+	// the range files of BreachedDir. Existing hashes are upgraded to
+	// BcryptCost on login.
+	PasswordPolicy validators.PasswordPolicy
+	BreachedDir    string
+	BcryptCost     int
+
+	// Uploaded images are kept in UploadDir and may be at most
+	// UploadMaxBytes large.
+	UploadDir      string
+	UploadMaxBytes int64
+
+	// OAuthProviders are the external identity providers users can log in
+	// with, keyed by name.
+	OAuthProviders map[string]*oauth.Provider
+
+	// Reactions are the emoji kinds offered on posts and comments.
+	Reactions models.ReactionConfig
+}
+
+// NewConfig reads configuration from FORUM_* environment variables.
+func NewConfig() *Config {
+	config := &Config{
+		BaseURL:      getenv("FORUM_BASE_URL", "http://localhost:8080"),
+		Secret:       []byte(os.Getenv("FORUM_SECRET")),
+		SMTPAddr:     os.Getenv("FORUM_SMTP_ADDR"),
+		SMTPUsername: os.Getenv("FORUM_SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("FORUM_SMTP_PASSWORD"),
+		MailFrom:     getenv("FORUM_MAIL_FROM", "forum@localhost"),
+		OutboxDir:    getenv("FORUM_OUTBOX_DIR", "outbox"),
+		PasswordPolicy: validators.PasswordPolicy{
+			MinLength:      getenvInt("FORUM_PASSWORD_MIN_LENGTH", validators.DefaultPasswordPolicy.MinLength),
+			MinClasses:     getenvInt("FORUM_PASSWORD_MIN_CLASSES", validators.DefaultPasswordPolicy.MinClasses),
+			RejectPersonal: getenv("FORUM_PASSWORD_REJECT_PERSONAL", "true") == "true",
+		},
+		BreachedDir:    getenv("FORUM_BREACHED_DIR", "data/breached"),
+		BcryptCost:     getenvInt("FORUM_BCRYPT_COST", bcrypt.DefaultCost),
+		UploadDir:      getenv("FORUM_UPLOAD_DIR", "uploads"),
+		UploadMaxBytes: int64(getenvInt("FORUM_UPLOAD_MAX_BYTES", 5<<20)),
+	}
+
+	if len(config.Secret) == 0 {
+		logger.GetLogger().Warn("FORUM_SECRET is not set, emailed links will not survive a restart")
+		config.Secret = make([]byte, 32)
+		rand.Read(config.Secret)
+	}
+
+	config.OAuthProviders = oauthProviders(config.BaseURL)
+
+	config.Reactions = models.ReactionConfig{
+		Post:    reactionSet("FORUM_POST_REACTIONS"),
+		Comment: reactionSet("FORUM_COMMENT_REACTIONS"),
+	}
+
+	return config
+}
+
+// ProviderNames returns the configured OAuth provider names in display order.
+func (c *Config) ProviderNames() []string {
+	names := make([]string, 0, len(c.OAuthProviders))
+	for name := range c.OAuthProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// oauthProviders reads FORUM_OAUTH_PROVIDERS, a comma separated list of
+// provider names. Each provider NAME is configured with
+// FORUM_OAUTH_NAME_CLIENT_ID and FORUM_OAUTH_NAME_CLIENT_SECRET; "google" and
+// "github" come with their endpoints preset, any other name needs
+// FORUM_OAUTH_NAME_AUTH_URL, _TOKEN_URL, _USERINFO_URL and optionally _KIND,
+// _EMAILS_URL and _SCOPES. The URL variables also override the presets.
+func oauthProviders(baseURL string) map[string]*oauth.Provider {
+	providers := make(map[string]*oauth.Provider)
+
+	for _, name := range strings.Split(os.Getenv("FORUM_OAUTH_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "FORUM_OAUTH_" + strings.ToUpper(name) + "_"
+		clientID := os.Getenv(prefix + "CLIENT_ID")
+		clientSecret := os.Getenv(prefix + "CLIENT_SECRET")
+		if clientID == "" {
+			logger.GetLogger().Warn("OAuth provider " + name + " has no " + prefix + "CLIENT_ID, skipping")
+			continue
+		}
+
+		redirectURL := baseURL + "/oauth/" + name + "/callback"
+
+		var provider *oauth.Provider
+		switch name {
+		case "google":
+			provider = oauth.Google(clientID, clientSecret, redirectURL)
+		case "github":
+			provider = oauth.GitHub(clientID, clientSecret, redirectURL)
+		default:
+			provider = &oauth.Provider{
+				Kind:         getenv(prefix+"KIND", oauth.KindOIDC),
+				ClientID:     clientID,
+				ClientSecret: clientSecret,
+				Scopes:       []string{"openid", "email", "profile"},
+				RedirectURL:  redirectURL,
+			}
+		}
+		provider.Name = name
+
+		provider.AuthURL = getenv(prefix+"AUTH_URL", provider.AuthURL)
+		provider.TokenURL = getenv(prefix+"TOKEN_URL", provider.TokenURL)
+		provider.UserInfoURL = getenv(prefix+"USERINFO_URL", provider.UserInfoURL)
+		provider.EmailsURL = getenv(prefix+"EMAILS_URL", provider.EmailsURL)
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			provider.Scopes = strings.Fields(scopes)
+		}
+
+		if provider.AuthURL == "" || provider.TokenURL == "" || provider.UserInfoURL == "" {
+			logger.GetLogger().Warn("OAuth provider " + name + " is missing endpoint URLs, skipping")
+			continue
+		}
+
+		providers[name] = provider
+	}
+
+	return providers
 }
 
 // NewApplication initializes a new Application struct
 func NewApplication(config *Config) *Application {
+	if config == nil {
+		config = NewConfig()
+	}
+
 	// Initialize services
-	db, err := sql.Open("sqlite3", "forum.sqlite")
+	db, err := sql.Open("sqlite3", "forum.sqlite?_foreign_keys=on")
 	if err != nil {
 		fmt.Print(err)
 	}
 
+	var mail mailer.Mailer
+	if config.SMTPAddr != "" {
+		mail = mailer.NewSMTPMailer(config.SMTPAddr, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+	} else {
+		mail = mailer.NewFileOutbox(config.OutboxDir, config.MailFrom)
+	}
+
+	passwords := services.NewPasswordService(config.PasswordPolicy, breach.NewChecker(config.BreachedDir), config.BcryptCost)
+
 	// Initialize router
 	router := http.NewServeMux()
 
 	return &Application{
-		Service: services.NewService(db),
+		Service: services.NewService(db, mail, passwords, storage.NewLocal(config.UploadDir), config.UploadMaxBytes, config.Secret, config.BaseURL, events.NewHub(), config.Reactions),
 		Router:  router,
 		Logger:  logger.GetLogger(),
 		Config:  config,
@@ -44,6 +216,68 @@ func NewApplication(config *Config) *Application {
 func (app *Application) Start(addr string) error {
 	// Start the server
 	app.Logger.Info("serv")
+
+	// Bring HTML cached by an older Markdown renderer up to date.
+	if err := app.Service.PostService.RefreshHTML(); err != nil {
+		app.Logger.Error(err.Error())
+	}
+	if err := app.Service.CommentService.RefreshHTML(); err != nil {
+		app.Logger.Error(err.Error())
+	}
+	// Give stored reactions the weights configured now.
+	if err := app.Service.ReactionService.SyncWeights(); err != nil {
+		app.Logger.Error(err.Error())
+	}
+	// Score the posts of databases created before ranking.
+	if err := app.Service.RankingService.RefreshScores(); err != nil {
+		app.Logger.Error(err.Error())
+	}
+
+	go app.Service.WebhookService.Run(webhookPollInterval, func(err error) {
+		app.Logger.Error(err.Error())
+	})
+	go app.Service.DigestService.Run(digestPollInterval, func(err error) {
+		app.Logger.Error(err.Error())
+	})
+
 	app.InitializeRoutes()
 	return http.ListenAndServe(addr, app.Router)
 }
+
+// reactionSet reads the reaction kinds of a target from key, a comma
+// separated list of name:emoji:weight entries such as "heart:❤️:1", and
+// whether users may leave several of them from key_MULTIPLE. Like and
+// dislike are offered when key is unset or invalid. Changed weights apply to
+// existing reactions from the next start.
+func reactionSet(key string) models.ReactionSet {
+	set := models.ReactionSet{
+		Kinds:    models.DefaultReactionKinds,
+		Multiple: os.Getenv(key+"_MULTIPLE") == "true",
+	}
+
+	if spec := os.Getenv(key); spec != "" {
+		kinds, err := models.ParseReactionKinds(spec)
+		if err != nil {
+			logger.GetLogger().Warn(key + ": " + err.Error() + ", using like and dislike")
+			return set
+		}
+		set.Kinds = kinds
+	}
+
+	return set
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getenvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
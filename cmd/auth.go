@@ -6,6 +6,7 @@ import (
 	"forum/pkg/services"
 	"forum/pkg/utils/cookies"
 	"forum/pkg/utils/logger"
+	"forum/pkg/utils/tokens"
 	"forum/pkg/utils/validators"
 	"html/template"
 	"net/http"
@@ -17,15 +18,29 @@ type ErrorMessages struct {
 	EmailError                string
 	PasswordError             string
 	PasswordConfirmationError string
+	PasswordHint              string
+}
+
+type loginPage struct {
+	Error     string
+	Providers []string
+}
+
+type twoFactorLoginPage struct {
+	Token string
+	Error string
 }
 
 type AuthHanlder struct {
 	Service *services.Service
+	// Providers are the names of the OAuth providers offered on the login page.
+	Providers []string
 }
 
-func NewAuthHandler(Service *services.Service) *AuthHanlder {
+func NewAuthHandler(Service *services.Service, Providers []string) *AuthHanlder {
 	return &AuthHanlder{
-		Service: Service,
+		Service:   Service,
+		Providers: Providers,
 	}
 }
 
@@ -42,19 +57,7 @@ func (a *AuthHanlder) Login(w http.ResponseWriter, r *http.Request) {
 		pass := r.FormValue("password")
 
 		if validators.LengthRangeValidate(login, 2, 10) != nil || validators.PasswordValidate(pass) != nil {
-			file := "./ui/templates/login.html"
-			tmpl, err := template.ParseFiles(file)
-			if err != nil {
-				http.Error(w, "Error parsing templates", 500)
-				return
-			}
-			w.WriteHeader(400)
-			err = tmpl.Execute(w, "Invalid username or password")
-			if err != nil {
-				fmt.Print(err)
-				http.Error(w, "Error executing template", 500)
-				return
-			}
+			renderPage(w, http.StatusBadRequest, "./ui/templates/login.html", loginPage{Error: "Invalid username or password", Providers: a.Providers})
 			return
 		}
 
@@ -62,19 +65,7 @@ func (a *AuthHanlder) Login(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			switch err {
 			case models.ErrInvalidCredentials:
-				file := "./ui/templates/login.html"
-				tmpl, err := template.ParseFiles(file)
-				if err != nil {
-					http.Error(w, "Error parsing templates", 500)
-					return
-				}
-				w.WriteHeader(400)
-				err = tmpl.Execute(w, "Invalid username or password")
-				if err != nil {
-					fmt.Print(err)
-					http.Error(w, "Error executing template", 500)
-					return
-				}
+				renderPage(w, http.StatusBadRequest, "./ui/templates/login.html", loginPage{Error: "Invalid username or password", Providers: a.Providers})
 				return
 
 			default:
@@ -83,36 +74,84 @@ func (a *AuthHanlder) Login(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		times := time.Now().Add(time.Hour)
-
-		session, err := a.Service.SessionService.RegisterSession(user.ID, times)
-		if err != nil {
-			logger.GetLogger().Warn(err.Error())
-			http.Error(w, "ERROR CREATING SESSION", http.StatusInternalServerError)
+		if user.TOTPEnabled {
+			renderPage(w, http.StatusOK, "./ui/templates/login2fa.html", twoFactorLoginPage{Token: a.Service.TwoFactorService.StartLogin(user.ID)})
 			return
 		}
 
-		cookies.SetCookie(w, session.ID, times) // RETURN TO THIS
-		fmt.Println(session)
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		a.startSession(w, r, user)
 
 	} else if r.Method == http.MethodGet {
-		file := "./ui/templates/login.html"
-		tmpl, err := template.ParseFiles(file)
-		if err != nil {
-			http.Error(w, "Error parsing templates", 500)
-			return
+		renderPage(w, http.StatusOK, "./ui/templates/login.html", loginPage{Providers: a.Providers})
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// LoginTwoFactor completes a login started by Login for users with 2FA enabled.
+func (a *AuthHanlder) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token := r.FormValue("token")
+	uid, err := a.Service.TwoFactorService.CompleteLogin(token, r.FormValue("code"))
+	if err != nil {
+		switch err {
+		case models.ErrInvalidTwoFactorCode:
+			renderPage(w, http.StatusBadRequest, "./ui/templates/login2fa.html", twoFactorLoginPage{Token: token, Error: "Invalid code"})
+		case models.ErrRateLimited:
+			renderPage(w, http.StatusTooManyRequests, "./ui/templates/login2fa.html", twoFactorLoginPage{Token: token, Error: "Too many wrong codes. Please try again later."})
+		case tokens.ErrInvalid, tokens.ErrExpired:
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "UNKNOWN", http.StatusInternalServerError)
 		}
+		return
+	}
+
+	user, err := a.Service.UserService.GetUserByID(uid)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "UNKNOWN", http.StatusInternalServerError)
+		return
+	}
+
+	a.startSession(w, r, user)
+}
+
+func (a *AuthHanlder) startSession(w http.ResponseWriter, r *http.Request, user models.User) {
+	times := time.Now().Add(time.Hour)
+
+	session, err := a.Service.SessionService.RegisterSession(user.ID, times)
+	if err != nil {
+		logger.GetLogger().Warn(err.Error())
+		http.Error(w, "ERROR CREATING SESSION", http.StatusInternalServerError)
+		return
+	}
 
-		err = tmpl.Execute(w, nil)
+	cookies.SetCookie(w, session.ID, times)
+
+	if user.IsStaff() && !user.TOTPEnabled {
+		required, err := a.Service.SettingsService.GetBool(services.SettingRequireStaffTwoFactor)
 		if err != nil {
-			fmt.Print(err)
-			http.Error(w, "Error executing template", 500)
+			logger.GetLogger().Error(err.Error())
+		}
+		if required {
+			http.Redirect(w, r, "/settings/2fa", http.StatusSeeOther)
 			return
 		}
-	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (a *AuthHanlder) Registration(w http.ResponseWriter, r *http.Request) {
@@ -127,15 +166,20 @@ func (a *AuthHanlder) Registration(w http.ResponseWriter, r *http.Request) {
 		email := r.FormValue("email")
 		pass := r.FormValue("password")
 		passConf := r.FormValue("passwordConf")
-		fmt.Println(login, email, pass, passConf)
-		var errorMessages ErrorMessages
+		errorMessages := ErrorMessages{PasswordHint: a.Service.PasswordService.Hint()}
 
 		if validators.LengthRangeValidate(login, 2, 10) != nil {
 			errorMessages.LoginError = "Username must be between 2 and 10 characters"
 		}
 
-		if validators.PasswordValidate(pass) != nil {
-			errorMessages.PasswordError = "Password must have at least 5 characters"
+		if err := a.Service.PasswordService.Check(pass, login, email); err != nil {
+			message, ok := passwordRejection(err)
+			if !ok {
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "UNKNOWN ERROR", http.StatusInternalServerError)
+				return
+			}
+			errorMessages.PasswordError = message
 		}
 
 		if validators.EmailValidate(email) != nil {
@@ -163,7 +207,7 @@ func (a *AuthHanlder) Registration(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		_, err = a.Service.UserService.RegisterUser(models.User{Username: login, Email: email, Password: pass})
+		newUser, err := a.Service.UserService.RegisterUser(models.User{Username: login, Email: email, Password: pass})
 
 		if err != nil {
 			switch err {
@@ -195,7 +239,14 @@ func (a *AuthHanlder) Registration(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		err = a.Service.VerificationService.SendVerification(newUser)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			renderNotice(w, http.StatusOK, "Registered", "Your account is created but we could not send the confirmation email. Log in to request a new one.")
+			return
+		}
+
+		renderNotice(w, http.StatusOK, "Check your email", "We have sent a confirmation link to "+email+". Confirm your email to start posting.")
 	} else if r.Method == http.MethodGet {
 		file := "./ui/templates/reg.html"
 		tmpl, err := template.ParseFiles(file)
@@ -204,7 +255,7 @@ func (a *AuthHanlder) Registration(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = tmpl.Execute(w, nil)
+		err = tmpl.Execute(w, ErrorMessages{PasswordHint: a.Service.PasswordService.Hint()})
 		if err != nil {
 			fmt.Print(err)
 			http.Error(w, "Error executing template", 500)
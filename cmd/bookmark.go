@@ -0,0 +1,195 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const bookmarksPageSize = 20
+
+type bookmarksPage struct {
+	Bookmarks []models.Bookmark
+	Folders   []string
+	Cats      []models.Category
+	Filter    models.BookmarkFilter
+	Page      int
+	// PrevLink and NextLink keep the filter; they are empty on the first
+	// and the last page.
+	PrevLink string
+	NextLink string
+}
+
+type BookmarkHandler struct {
+	Service *services.Service
+}
+
+func NewBookmarkHandler(Service *services.Service) *BookmarkHandler {
+	return &BookmarkHandler{
+		Service: Service,
+	}
+}
+
+// Toggle saves or removes the bookmark of a post, or of one of its comments
+// when commentID is set, and goes back to the post.
+func (h *BookmarkHandler) Toggle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bookmark, err := bookmarkFromForm(r)
+	if err != nil {
+		http.Error(w, "Invalid bookmark", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.Service.BookmarkService.ToggleBookmark(bookmark); err != nil {
+		bookmarkError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, bookmark.Link(), http.StatusSeeOther)
+}
+
+// Bookmarks serves /bookmarks, the saved posts and comments of the user page
+// by page, optionally narrowed to a folder and a category. Bookmarks are
+// edited and removed with the update and delete actions.
+func (h *BookmarkHandler) Bookmarks(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid bookmark", http.StatusBadRequest)
+			return
+		}
+
+		switch r.FormValue("action") {
+		case "update":
+			err = h.Service.BookmarkService.UpdateBookmark(user.ID, id, r.FormValue("folder"), r.FormValue("note"))
+		case "delete":
+			err = h.Service.BookmarkService.DeleteBookmark(user.ID, id)
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			bookmarkError(w, r, err)
+			return
+		}
+
+		http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		bookmarks, filter, pageNum, hasNext, err := loadBookmarks(h.Service, user, r.URL.Query())
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load bookmarks", http.StatusInternalServerError)
+			return
+		}
+
+		folders, err := h.Service.BookmarkService.GetFolders(user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load bookmarks", http.StatusInternalServerError)
+			return
+		}
+
+		cats, err := h.Service.PostService.GetCats()
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant fecth cats", http.StatusInternalServerError)
+			return
+		}
+
+		data := bookmarksPage{
+			Bookmarks: bookmarks,
+			Folders:   folders,
+			Cats:      cats,
+			Filter:    filter,
+			Page:      pageNum,
+		}
+		if pageNum > 1 {
+			data.PrevLink = bookmarksLink(filter, pageNum-1)
+		}
+		if hasNext {
+			data.NextLink = bookmarksLink(filter, pageNum+1)
+		}
+
+		renderPage(w, http.StatusOK, "./ui/templates/bookmarks.html", data)
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// loadBookmarks returns the page of bookmarks of user selected by the folder,
+// category and page parameters of query, and whether a next page exists.
+func loadBookmarks(service *services.Service, user models.User, query url.Values) ([]models.Bookmark, models.BookmarkFilter, int, bool, error) {
+	filter := models.BookmarkFilter{Folder: query.Get("folder")}
+	filter.CategoryID, _ = strconv.Atoi(query.Get("category"))
+
+	pageNum, err := strconv.Atoi(query.Get("page"))
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+
+	start := (pageNum - 1) * bookmarksPageSize
+	bookmarks, total, err := service.BookmarkService.GetBookmarks(user.ID, filter, bookmarksPageSize, start)
+	if err != nil {
+		return nil, filter, pageNum, false, err
+	}
+
+	return bookmarks, filter, pageNum, start+bookmarksPageSize < total, nil
+}
+
+func bookmarksLink(filter models.BookmarkFilter, pageNum int) string {
+	query := url.Values{}
+	if filter.Folder != "" {
+		query.Set("folder", filter.Folder)
+	}
+	if filter.CategoryID != 0 {
+		query.Set("category", strconv.Itoa(filter.CategoryID))
+	}
+	query.Set("page", strconv.Itoa(pageNum))
+	return "/bookmarks?" + query.Encode()
+}
+
+func bookmarkFromForm(r *http.Request) (models.Bookmark, error) {
+	postID, err := strconv.Atoi(r.FormValue("postID"))
+	if err != nil {
+		return models.Bookmark{}, err
+	}
+
+	var commentID int
+	if value := r.FormValue("commentID"); value != "" {
+		commentID, err = strconv.Atoi(value)
+		if err != nil {
+			return models.Bookmark{}, err
+		}
+	}
+
+	return models.Bookmark{
+		UID:       getUserFromContext(r).ID,
+		PostID:    postID,
+		CommentID: commentID,
+		Folder:    r.FormValue("folder"),
+		Note:      r.FormValue("note"),
+	}, nil
+}
+
+func bookmarkError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case models.NotFoundAnything:
+		http.NotFound(w, r)
+	case models.ValueMismatch:
+		http.Error(w, "Folders are limited to 50 and notes to 500 characters", http.StatusBadRequest)
+	case models.ErrForbidden:
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	default:
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant save bookmark", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"forum/pkg/utils/validators"
+	"forum/pkg/views"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type CategoryHandler struct {
+	Service *services.Service
+	posts   *PostHanlder
+}
+
+type categoryPage struct {
+	Auth     bool
+	Username string
+	Category models.Category
+	Posts    []views.PostView
+	// FollowState is whether the user follows or mutes the category.
+	FollowState string
+}
+
+type adminCategoriesPage struct {
+	Cats  []models.Category
+	Error string
+}
+
+func NewCategoryHandler(Service *services.Service) *CategoryHandler {
+	return &CategoryHandler{
+		Service: Service,
+		posts:   NewPostHandler(Service),
+	}
+}
+
+func (h *CategoryHandler) Category(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	slug := strings.TrimPrefix(r.URL.Path, "/c/")
+	if slug == "" || strings.Contains(slug, "/") {
+		http.Error(w, "Page not found", http.StatusNotFound)
+		return
+	}
+
+	cat, err := h.Service.CategoryService.GetCategoryBySlug(slug)
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything:
+			http.Error(w, "Category not found", http.StatusNotFound)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Category load problem", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	posts, err := h.Service.PostService.GetPostsByCats([]int{cat.ID})
+	if err != nil {
+		http.Error(w, "Cant fecth posts", http.StatusInternalServerError)
+		return
+	}
+
+	posts, err = h.Service.ForumService.FilterPosts(user.Role, posts)
+	if err != nil {
+		http.Error(w, "Cant fecth posts", http.StatusInternalServerError)
+		return
+	}
+
+	postViews, err := h.posts.converterPOSTS(posts)
+	if err != nil {
+		http.Error(w, "Cant load views", http.StatusInternalServerError)
+		return
+	}
+
+	file := "./ui/templates/category.html"
+	tmpl, err := template.ParseFiles(file)
+	if err != nil {
+		http.Error(w, "Error parsing templates", 500)
+		return
+	}
+
+	data := categoryPage{
+		Category: cat,
+		Posts:    postViews,
+	}
+
+	if (user != models.User{}) {
+		data.Auth = true
+		data.Username = user.Username
+		data.FollowState, err = h.Service.FollowService.GetFollowState(user.ID, models.FollowCategory, strconv.Itoa(cat.ID))
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load follows", http.StatusInternalServerError)
+			return
+		}
+		counts, err := h.Service.ReadService.GetUnreadCounts(user.ID, viewIDs(data.Posts))
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load read markers", http.StatusInternalServerError)
+			return
+		}
+		markUnread(data.Posts, counts)
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		logger.GetLogger().Warn(err.Error())
+		http.Error(w, "Error executing template", 500)
+		return
+	}
+}
+
+func (h *CategoryHandler) Admin(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = h.applyAdminAction(r)
+		if err != nil {
+			h.renderAdmin(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		h.renderAdmin(w, http.StatusOK, "")
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *CategoryHandler) applyAdminAction(r *http.Request) error {
+	switch r.FormValue("action") {
+	case "create":
+		cat, err := h.categoryFromForm(r)
+		if err != nil {
+			return err
+		}
+		_, err = h.Service.CategoryService.CreateCategory(cat)
+		return h.adminError(err)
+	case "update":
+		cat, err := h.categoryFromForm(r)
+		if err != nil {
+			return err
+		}
+		cat.ID, err = strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			return models.ValueMismatch
+		}
+		return h.adminError(h.Service.CategoryService.UpdateCategory(cat))
+	case "delete":
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			return models.ValueMismatch
+		}
+		return h.adminError(h.Service.CategoryService.DeleteCategory(id))
+	case "merge":
+		src, err := strconv.Atoi(r.FormValue("from"))
+		if err != nil {
+			return models.ValueMismatch
+		}
+		dst, err := strconv.Atoi(r.FormValue("into"))
+		if err != nil {
+			return models.ValueMismatch
+		}
+		return h.adminError(h.Service.CategoryService.MergeCategories(src, dst))
+	case "reorder":
+		ids, err := h.posts.stringsToInts(strings.Fields(strings.ReplaceAll(r.FormValue("order"), ",", " ")))
+		if err != nil {
+			return models.ValueMismatch
+		}
+		return h.adminError(h.Service.CategoryService.ReorderCategories(ids))
+	default:
+		return models.ValueMismatch
+	}
+}
+
+func (h *CategoryHandler) categoryFromForm(r *http.Request) (models.Category, error) {
+	cat := models.Category{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Slug:        strings.TrimSpace(r.FormValue("slug")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Color:       strings.TrimSpace(r.FormValue("color")),
+	}
+
+	if validators.NonBlankValidate(cat.Name) != nil || validators.LengthRangeValidate(cat.Name, 1, 50) != nil {
+		return models.Category{}, models.ValueMismatch
+	}
+	if cat.Slug != "" {
+		if err := validators.SlugValidate(cat.Slug); err != nil {
+			return models.Category{}, err
+		}
+	}
+	if cat.Color != "" {
+		if err := validators.ColorValidate(cat.Color); err != nil {
+			return models.Category{}, err
+		}
+	}
+	if validators.TextLengthValidate(cat.Description, 500) != nil {
+		return models.Category{}, models.ValueMismatch
+	}
+
+	if order := r.FormValue("sort_order"); order != "" {
+		num, err := strconv.Atoi(order)
+		if err != nil {
+			return models.Category{}, models.ValueMismatch
+		}
+		cat.SortOrder = num
+	}
+
+	return cat, nil
+}
+
+// adminError hides unexpected errors behind a generic message and logs them.
+func (h *CategoryHandler) adminError(err error) error {
+	switch err {
+	case nil, models.UniqueConstraintSlug, models.NotFoundAnything, models.ValueMismatch:
+		return err
+	default:
+		logger.GetLogger().Error(err.Error())
+		return models.ErrUnknown
+	}
+}
+
+func (h *CategoryHandler) renderAdmin(w http.ResponseWriter, status int, message string) {
+	file := "./ui/templates/adminCategories.html"
+	tmpl, err := template.ParseFiles(file)
+	if err != nil {
+		http.Error(w, "Error parsing templates", 500)
+		return
+	}
+
+	cats, err := h.Service.PostService.GetCats()
+	if err != nil {
+		http.Error(w, "Cant fecth cats", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(status)
+	err = tmpl.Execute(w, adminCategoriesPage{Cats: cats, Error: message})
+	if err != nil {
+		logger.GetLogger().Warn(err.Error())
+		http.Error(w, "Error executing template", 500)
+		return
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"forum/pkg/models"
 	"forum/pkg/services"
+	"forum/pkg/utils/logger"
 	"forum/pkg/utils/validators"
 	"net/http"
 	"strconv"
@@ -55,13 +56,66 @@ func (h *CommentHandler) SubmitComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Service.CommentService.SubmitCommentForPost(models.Comment{UID: user.ID, PostID: postint, Content: content})
+	commentID, err := h.Service.CommentService.SubmitCommentForPost(models.Comment{UID: user.ID, PostID: postint, Content: content})
 
 	if err != nil {
-		http.Error(w, "Comment creation error", http.StatusInternalServerError)
+		switch err {
+		case models.ErrForbidden:
+			http.Error(w, "You cant comment in this forum", http.StatusForbidden)
+		case models.ErrEmailNotVerified:
+			http.Error(w, "Confirm your email before commenting", http.StatusForbidden)
+		case models.ErrTrustTooLow:
+			http.Error(w, "New users cant post links yet", http.StatusForbidden)
+		default:
+			http.Error(w, "Comment creation error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = h.Service.MentionService.Record(user, postint, commentID, content)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
+
+	trust, err := h.Service.ReputationService.GetTrust(user.ID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+	} else if !trust.Level.SkipsModeration() {
+		renderNotice(w, http.StatusOK, "Comment awaiting review", "Thank you. Your comment will be visible to others once a moderator approves it.")
 		return
 	}
 
 	http.Redirect(w, r, "/post/"+postID, http.StatusSeeOther)
 	return
 }
+
+// DeleteComment removes a comment for staff. The author gets a moderation
+// notification.
+func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	commentID, err := strconv.Atoi(r.FormValue("commentID"))
+	if err != nil {
+		http.Error(w, "Invalid comment", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Service.CommentService.DeleteComment(commentID, user.ID)
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything:
+			http.Error(w, "Not found comment", http.StatusNotFound)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant delete comment", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/post/"+r.FormValue("postID"), http.StatusSeeOther)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"forum/pkg/utils/tokens"
+	"net/http"
+	"strconv"
+)
+
+type digestSettingsPage struct {
+	Settings models.DigestSettings
+	Selected map[int]bool
+	Cats     []models.Category
+	Verified bool
+	Saved    bool
+}
+
+type digestUnsubscribePage struct {
+	Token string
+}
+
+type DigestHandler struct {
+	Service *services.Service
+}
+
+func NewDigestHandler(Service *services.Service) *DigestHandler {
+	return &DigestHandler{
+		Service: Service,
+	}
+}
+
+// Settings serves /settings/digest where users pick how often they get a
+// digest and which categories it follows.
+func (h *DigestHandler) Settings(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+
+		settings := models.DigestSettings{Frequency: r.FormValue("frequency")}
+		for _, value := range r.PostForm["cats"] {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, "Invalid category", http.StatusBadRequest)
+				return
+			}
+			settings.Categories = append(settings.Categories, id)
+		}
+
+		err := h.Service.DigestService.SetSettings(user.ID, settings)
+		if err != nil {
+			switch err {
+			case models.ValueMismatch:
+				http.Error(w, "Invalid frequency", http.StatusBadRequest)
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant save digest settings", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		http.Redirect(w, r, "/settings/digest?saved=1", http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		settings, err := h.Service.DigestService.GetSettings(user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load digest settings", http.StatusInternalServerError)
+			return
+		}
+
+		cats, err := h.Service.PostService.GetCats()
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant fecth cats", http.StatusInternalServerError)
+			return
+		}
+
+		selected := make(map[int]bool)
+		for _, id := range settings.Categories {
+			selected[id] = true
+		}
+
+		renderPage(w, http.StatusOK, "./ui/templates/digestSettings.html", digestSettingsPage{
+			Settings: settings,
+			Selected: selected,
+			Cats:     cats,
+			Verified: user.EmailVerified,
+			Saved:    r.URL.Query().Get("saved") != "",
+		})
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Unsubscribe serves the link in digest emails. GET only asks for
+// confirmation, as mail scanners and link previews follow links on their
+// own; the form and mail clients that support one-click unsubscribe
+// (RFC 8058) POST to the same URL.
+func (h *DigestHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		err := h.Service.DigestService.Unsubscribe(r.FormValue("token"))
+		if err != nil {
+			switch err {
+			case tokens.ErrExpired, tokens.ErrInvalid:
+				renderNotice(w, http.StatusBadRequest, "Invalid link", "This unsubscribe link is not valid. You can turn off digests in your settings.")
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant unsubscribe", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		renderNotice(w, http.StatusOK, "Unsubscribed", "You will not get digest emails anymore.")
+	} else if r.Method == http.MethodGet {
+		token := r.URL.Query().Get("token")
+		if _, err := h.Service.DigestService.CheckUnsubscribeToken(token); err != nil {
+			renderNotice(w, http.StatusBadRequest, "Invalid link", "This unsubscribe link is not valid. You can turn off digests in your settings.")
+			return
+		}
+
+		renderPage(w, http.StatusOK, "./ui/templates/digestUnsubscribe.html", digestUnsubscribePage{Token: token})
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"forum/pkg/utils/tokens"
+	"forum/pkg/utils/validators"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+type changeEmailPage struct {
+	Email    string
+	Verified bool
+	Error    string
+}
+
+type EmailHandler struct {
+	Service *services.Service
+}
+
+func NewEmailHandler(Service *services.Service) *EmailHandler {
+	return &EmailHandler{
+		Service: Service,
+	}
+}
+
+func (h *EmailHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, err := h.Service.VerificationService.Verify(r.URL.Query().Get("token"))
+	if err != nil {
+		switch err {
+		case tokens.ErrExpired:
+			renderNotice(w, http.StatusBadRequest, "Link expired", "This confirmation link has expired. Log in and request a new one.")
+		case tokens.ErrInvalid:
+			renderNotice(w, http.StatusBadRequest, "Invalid link", "This confirmation link is not valid.")
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Verification error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	renderNotice(w, http.StatusOK, "Email confirmed", "Your email is confirmed, you can now create posts and comments.")
+}
+
+func (h *EmailHandler) Resend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if user.EmailVerified {
+		renderNotice(w, http.StatusOK, "Email confirmed", "Your email is already confirmed.")
+		return
+	}
+
+	err := h.Service.VerificationService.SendVerification(user)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant send email", http.StatusInternalServerError)
+		return
+	}
+
+	renderNotice(w, http.StatusOK, "Check your email", "We have sent a new confirmation link to "+user.Email+".")
+}
+
+func (h *EmailHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		email := strings.TrimSpace(r.FormValue("email"))
+		if validators.EmailValidate(email) != nil {
+			h.renderChangeEmail(w, http.StatusBadRequest, user, "Invalid email format")
+			return
+		}
+
+		err = h.Service.UserService.ChangeEmail(user.ID, r.FormValue("current"), email)
+		if err != nil {
+			switch err {
+			case models.ErrInvalidCredentials:
+				h.renderChangeEmail(w, http.StatusBadRequest, user, "Current password is wrong")
+			case models.UniqueConstraintEmail:
+				h.renderChangeEmail(w, http.StatusBadRequest, user, "Email exists")
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant change email", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// The change is saved; the notice to the old address is only logged
+		// when it fails.
+		if err := h.Service.VerificationService.SendEmailChanged(user, email); err != nil {
+			logger.GetLogger().Error(err.Error())
+		}
+
+		user.Email = email
+		user.EmailVerified = false
+		err = h.Service.VerificationService.SendVerification(user)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant send email", http.StatusInternalServerError)
+			return
+		}
+
+		renderNotice(w, http.StatusOK, "Check your email", "We have sent a confirmation link to "+email+".")
+	} else if r.Method == http.MethodGet {
+		h.renderChangeEmail(w, http.StatusOK, user, "")
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *EmailHandler) renderChangeEmail(w http.ResponseWriter, status int, user models.User, message string) {
+	file := "./ui/templates/changeEmail.html"
+	tmpl, err := template.ParseFiles(file)
+	if err != nil {
+		http.Error(w, "Error parsing templates", 500)
+		return
+	}
+
+	w.WriteHeader(status)
+	err = tmpl.Execute(w, changeEmailPage{Email: user.Email, Verified: user.EmailVerified, Error: message})
+	if err != nil {
+		logger.GetLogger().Warn(err.Error())
+		http.Error(w, "Error executing template", 500)
+		return
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"forum/pkg/events"
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sseHeartbeat is how often an idle stream gets a comment so that proxies
+// keep the connection open.
+const sseHeartbeat = 25 * time.Second
+
+type EventsHandler struct {
+	Service *services.Service
+}
+
+func NewEventsHandler(Service *services.Service) *EventsHandler {
+	return &EventsHandler{
+		Service: Service,
+	}
+}
+
+// Post streams new comments and reaction counts of /events/post/{id}.
+func (h *EventsHandler) Post(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	postID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/events/post/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	post, err := h.Service.PostService.GetPostByID(postID)
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything, models.ValueMismatch:
+			http.NotFound(w, r)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Post load problem", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	user := getUserFromContext(r)
+	if !post.VisibleTo(user) {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.Service.ForumService.CheckRead(user.Role, post.ForumID); err != nil {
+		switch err {
+		case models.ErrForbidden:
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Post load problem", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.stream(w, r, events.PostTopic(postID))
+}
+
+// User streams the notifications of the logged in user.
+func (h *EventsHandler) User(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+	h.stream(w, r, events.UserTopic(user.ID))
+}
+
+// stream writes the events of topic until the client goes away. Clients
+// resume with the Last-Event-ID header, or the lastEventId query parameter
+// for the first connection of a page, and are told to reload when the
+// events they missed are no longer kept.
+func (h *EventsHandler) stream(w http.ResponseWriter, r *http.Request, topic string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	since, _ := strconv.ParseUint(lastID, 10, 64)
+
+	sub, replay, complete := h.Service.Events.Subscribe(topic, since)
+	defer h.Service.Events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !complete {
+		fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+	}
+	for _, event := range replay {
+		writeEvent(w, event)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, open := <-sub.C:
+			if !open {
+				// The hub dropped the subscription because the client fell
+				// behind; it reconnects and resumes from Last-Event-ID.
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
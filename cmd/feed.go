@@ -0,0 +1,313 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"forum/pkg/feed"
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"forum/pkg/views"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// feedSize is how many posts or comments a feed carries.
+const feedSize = 20
+
+type FeedHandler struct {
+	Service *services.Service
+	baseURL string
+	posts   *PostHanlder
+}
+
+func NewFeedHandler(Service *services.Service, baseURL string) *FeedHandler {
+	return &FeedHandler{
+		Service: Service,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		posts:   NewPostHandler(Service),
+	}
+}
+
+// Site serves /feed.atom and /feed.rss with the latest posts of the forum.
+func (h *FeedHandler) Site(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, format, ok := splitFeedName(strings.TrimPrefix(r.URL.Path, "/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	posts, err := h.Service.PostService.GetAllPosts()
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant fecth posts", http.StatusInternalServerError)
+		return
+	}
+
+	h.servePosts(w, r, format, feed.Feed{
+		Title: "FORUM",
+		Link:  h.baseURL + "/",
+	}, posts)
+}
+
+// Feed serves the feeds under /feed/: /feed/c/{slug}, /feed/u/{username} and
+// /feed/post/{id}, each with an .atom or .rss extension.
+func (h *FeedHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	kind, name, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/feed/"), "/")
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	name, format, ok := splitFeedName(name)
+	if !ok || name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch kind {
+	case "c":
+		h.category(w, r, name, format)
+	case "u":
+		h.user(w, r, name, format)
+	case "post":
+		h.thread(w, r, name, format)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *FeedHandler) category(w http.ResponseWriter, r *http.Request, slug, format string) {
+	cat, err := h.Service.CategoryService.GetCategoryBySlug(slug)
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything:
+			http.NotFound(w, r)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Category load problem", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	posts, err := h.Service.PostService.GetPostsByCats([]int{cat.ID})
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant fecth posts", http.StatusInternalServerError)
+		return
+	}
+
+	h.servePosts(w, r, format, feed.Feed{
+		Title:       cat.Name + " - FORUM",
+		Description: cat.Description,
+		Link:        h.baseURL + "/c/" + cat.Slug,
+	}, posts)
+}
+
+func (h *FeedHandler) user(w http.ResponseWriter, r *http.Request, username, format string) {
+	user, err := h.Service.UserService.GetUserByUsername(username)
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything:
+			http.NotFound(w, r)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load profile", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if user.Username != username {
+		http.Redirect(w, r, "/feed/u/"+user.Username+"."+format, http.StatusMovedPermanently)
+		return
+	}
+
+	posts, err := h.Service.PostService.GetPostsByUID(user.ID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant fecth posts", http.StatusInternalServerError)
+		return
+	}
+
+	h.servePosts(w, r, format, feed.Feed{
+		Title:   "Posts by " + user.Username + " - FORUM",
+		Link:    h.baseURL + "/u/" + user.Username,
+		Created: user.CreatedAt,
+	}, posts)
+}
+
+func (h *FeedHandler) thread(w http.ResponseWriter, r *http.Request, id, format string) {
+	postID, err := strconv.Atoi(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	post, err := h.Service.PostService.GetPostByID(postID)
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything, models.ValueMismatch:
+			http.NotFound(w, r)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Post load problem", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Feed readers share the thread URL, so held posts and comments are
+	// left out of feeds even for their author.
+	if post.Pending {
+		http.NotFound(w, r)
+		return
+	}
+
+	viewer := getUserFromContext(r)
+	if err := h.Service.ForumService.CheckRead(viewer.Role, post.ForumID); err != nil {
+		switch err {
+		case models.ErrForbidden:
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Post load problem", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	comments, err := h.Service.CommentService.GetCommentsByPostID(postID, models.User{})
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant fetch comments", http.StatusInternalServerError)
+		return
+	}
+
+	// Comments come oldest first; the feed carries the newest ones.
+	if len(comments) > feedSize {
+		comments = comments[len(comments)-feedSize:]
+	}
+
+	link := h.baseURL + "/post/" + strconv.Itoa(postID)
+	f := feed.Feed{
+		Title:   "Comments on " + post.Title + " - FORUM",
+		Link:    link,
+		Created: post.CreatedAt,
+	}
+
+	for i := len(comments) - 1; i >= 0; i-- {
+		comment := comments[i]
+		author, err := h.Service.UserService.GetUserByID(comment.UID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load views", http.StatusInternalServerError)
+			return
+		}
+
+		f.Entries = append(f.Entries, feed.Entry{
+			Title:     "Comment by " + author.Username,
+			Link:      link + "#comment-" + strconv.Itoa(comment.ID),
+			Author:    author.Username,
+			Published: comment.CreatedAt,
+			Updated:   comment.CreatedAt,
+			HTML:      comment.ContentHTML,
+		})
+	}
+
+	h.serve(w, r, format, f)
+}
+
+// servePosts fills f with the newest of posts the viewer may read.
+func (h *FeedHandler) servePosts(w http.ResponseWriter, r *http.Request, format string, f feed.Feed, posts []models.PostWithCats) {
+	viewer := getUserFromContext(r)
+
+	posts, err := h.Service.ForumService.FilterPosts(viewer.Role, posts)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant fecth posts", http.StatusInternalServerError)
+		return
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+	if len(posts) > feedSize {
+		posts = posts[:feedSize]
+	}
+
+	postViews, err := h.posts.converterPOSTS(posts)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load views", http.StatusInternalServerError)
+		return
+	}
+
+	for _, post := range postViews {
+		f.Entries = append(f.Entries, postEntry(h.baseURL, post))
+	}
+
+	h.serve(w, r, format, f)
+}
+
+func postEntry(baseURL string, post views.PostView) feed.Entry {
+	return feed.Entry{
+		Title:     post.Title,
+		Link:      baseURL + "/post/" + strconv.Itoa(post.Id),
+		Author:    post.AuthorName,
+		Published: post.CreatedAt,
+		Updated:   post.CreatedAt,
+		HTML:      string(post.ContentHTML),
+	}
+}
+
+// serve writes f in format. The ETag is a hash of the document, so that it
+// also changes when an entry is deleted, and http.ServeContent answers
+// If-None-Match and If-Modified-Since with 304 Not Modified.
+func (h *FeedHandler) serve(w http.ResponseWriter, r *http.Request, format string, f feed.Feed) {
+	f.Self = h.baseURL + r.URL.Path
+
+	var body []byte
+	var err error
+	if format == "atom" {
+		body, err = f.Atom()
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	} else {
+		body, err = f.RSS()
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	}
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant build feed", http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	http.ServeContent(w, r, "", f.Updated().Truncate(time.Second), strings.NewReader(string(body)))
+}
+
+// splitFeedName splits "name.atom" or "name.rss" into the name and the
+// format.
+func splitFeedName(file string) (string, string, bool) {
+	for _, format := range []string{"atom", "rss"} {
+		if name, ok := strings.CutSuffix(file, "."+format); ok {
+			return name, format, true
+		}
+	}
+	return "", "", false
+}
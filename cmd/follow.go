@@ -0,0 +1,189 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"forum/pkg/views"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const personalFeedPageSize = 20
+
+// feedEntryView is a post of the personal feed with why it is listed.
+type feedEntryView struct {
+	Post     views.PostView
+	Reason   string
+	ActiveAt time.Time
+	// IsNew is set for posts that became active since the previous visit.
+	IsNew bool
+}
+
+type personalFeedPage struct {
+	Entries   []feedEntryView
+	LastVisit time.Time
+	Page      int
+	PrevPage  int
+	NextPage  int
+}
+
+type FollowHandler struct {
+	Service *services.Service
+	posts   *PostHanlder
+}
+
+func NewFollowHandler(Service *services.Service) *FollowHandler {
+	return &FollowHandler{
+		Service: Service,
+		posts:   NewPostHandler(Service),
+	}
+}
+
+// Follow serves POST /follow. It follows, unfollows, mutes or unmutes the
+// user, category or thread named by kind and target and goes back to it.
+// Users are named by username, categories by slug and threads by post ID.
+func (h *FollowHandler) Follow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+	kind := r.FormValue("kind")
+
+	var state string
+	switch r.FormValue("action") {
+	case "follow":
+		state = models.FollowStateFollow
+	case "mute":
+		state = models.FollowStateMute
+	case "unfollow", "unmute":
+		state = ""
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	targetID, link, err := h.resolveTarget(kind, r.FormValue("target"))
+	if err == nil {
+		err = h.Service.FollowService.SetFollow(user.ID, kind, targetID, state)
+	}
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything:
+			http.NotFound(w, r)
+		case models.ValueMismatch:
+			http.Error(w, "Cant follow that", http.StatusBadRequest)
+		case models.ErrForbidden:
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant save follow", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, link, http.StatusSeeOther)
+}
+
+// resolveTarget returns the stored ID and the page of the target of kind.
+func (h *FollowHandler) resolveTarget(kind, target string) (string, string, error) {
+	switch kind {
+	case models.FollowUser:
+		user, err := h.Service.UserService.GetUserByUsername(target)
+		if err != nil {
+			return "", "", err
+		}
+		return user.ID, "/u/" + user.Username, nil
+	case models.FollowCategory:
+		cat, err := h.Service.CategoryService.GetCategoryBySlug(target)
+		if err != nil {
+			return "", "", err
+		}
+		return strconv.Itoa(cat.ID), "/c/" + cat.Slug, nil
+	case models.FollowThread:
+		postID, err := strconv.Atoi(target)
+		if err != nil {
+			return "", "", models.NotFoundAnything
+		}
+		return strconv.Itoa(postID), "/post/" + strconv.Itoa(postID), nil
+	default:
+		return "", "", models.ValueMismatch
+	}
+}
+
+// Feed serves /feed, the posts of followed users and categories and the
+// followed threads of the user, most recently active first. Opening the
+// feed marks it as seen; posts active since the previous visit are flagged
+// as new.
+func (h *FollowHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	pageNum, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+
+	forumIDs, err := h.Service.ForumService.ReadableForumIDs(user.Role)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load feed", http.StatusInternalServerError)
+		return
+	}
+
+	start := (pageNum - 1) * personalFeedPageSize
+	entries, total, err := h.Service.FollowService.GetFeed(user.ID, forumIDs, personalFeedPageSize, start)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load feed", http.StatusInternalServerError)
+		return
+	}
+
+	// Pages link to each other with the marker of the visit that opened the
+	// feed, so only that visit is recorded.
+	var lastVisit time.Time
+	if since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64); err == nil {
+		lastVisit = time.Unix(since, 0).UTC()
+	} else {
+		lastVisit, err = h.Service.FollowService.Visit(user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load feed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data := personalFeedPage{
+		LastVisit: lastVisit,
+		Page:      pageNum,
+	}
+	for _, entry := range entries {
+		view, err := h.posts.convertPostToView(entry.Post)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load views", http.StatusInternalServerError)
+			return
+		}
+		data.Entries = append(data.Entries, feedEntryView{
+			Post:     view,
+			Reason:   entry.Reason,
+			ActiveAt: entry.ActiveAt,
+			IsNew:    !lastVisit.IsZero() && entry.ActiveAt.After(lastVisit),
+		})
+	}
+	if pageNum > 1 {
+		data.PrevPage = pageNum - 1
+	}
+	if start+len(entries) < total {
+		data.NextPage = pageNum + 1
+	}
+
+	renderPage(w, http.StatusOK, "./ui/templates/feed.html", data)
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"forum/pkg/utils/validators"
+	"forum/pkg/views"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type ForumHandler struct {
+	Service *services.Service
+	posts   *PostHanlder
+}
+
+type forumsPage struct {
+	Auth     bool
+	Username string
+	Forums   []views.ForumView
+}
+
+type forumPage struct {
+	Auth        bool
+	Username    string
+	CanPost     bool
+	Forum       models.Forum
+	Breadcrumbs []models.Forum
+	Children    []views.ForumView
+	Posts       []views.PostView
+}
+
+type adminForumsPage struct {
+	Forums []models.Forum
+	Roles  []string
+	Error  string
+}
+
+func NewForumHandler(Service *services.Service) *ForumHandler {
+	return &ForumHandler{
+		Service: Service,
+		posts:   NewPostHandler(Service),
+	}
+}
+
+func (h *ForumHandler) Forums(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	forums, err := h.Service.ForumService.GetForums()
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant fetch forums", http.StatusInternalServerError)
+		return
+	}
+
+	roots, err := h.forumViews(user, forums, 0)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load forum stats", http.StatusInternalServerError)
+		return
+	}
+
+	file := "./ui/templates/forums.html"
+	tmpl, err := template.ParseFiles(file)
+	if err != nil {
+		http.Error(w, "Error parsing templates", 500)
+		return
+	}
+
+	data := forumsPage{Forums: roots}
+	if (user != models.User{}) {
+		data.Auth = true
+		data.Username = user.Username
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		logger.GetLogger().Warn(err.Error())
+		http.Error(w, "Error executing template", 500)
+		return
+	}
+}
+
+func (h *ForumHandler) Forum(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	slug := strings.TrimPrefix(r.URL.Path, "/f/")
+	if slug == "" || strings.Contains(slug, "/") {
+		http.Error(w, "Page not found", http.StatusNotFound)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	forum, err := h.Service.ForumService.GetForumBySlug(slug)
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything:
+			http.Error(w, "Forum not found", http.StatusNotFound)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Forum load problem", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if !h.Service.ForumService.CanRead(user.Role, forum) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	crumbs, err := h.Service.ForumService.GetBreadcrumbs(forum.ID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Forum load problem", http.StatusInternalServerError)
+		return
+	}
+
+	forums, err := h.Service.ForumService.GetForums()
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant fetch forums", http.StatusInternalServerError)
+		return
+	}
+
+	children, err := h.forumViews(user, forums, forum.ID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load forum stats", http.StatusInternalServerError)
+		return
+	}
+
+	posts, err := h.Service.PostService.GetPostsByForums([]int{forum.ID})
+	if err != nil {
+		http.Error(w, "Cant fecth posts", http.StatusInternalServerError)
+		return
+	}
+
+	postViews, err := h.posts.converterPOSTS(posts)
+	if err != nil {
+		http.Error(w, "Cant load views", http.StatusInternalServerError)
+		return
+	}
+
+	file := "./ui/templates/forum.html"
+	tmpl, err := template.ParseFiles(file)
+	if err != nil {
+		http.Error(w, "Error parsing templates", 500)
+		return
+	}
+
+	data := forumPage{
+		Forum:       forum,
+		Breadcrumbs: crumbs,
+		Children:    children,
+		Posts:       postViews,
+	}
+	if (user != models.User{}) {
+		data.Auth = true
+		data.Username = user.Username
+		data.CanPost = h.Service.ForumService.CanPost(user.Role, forum)
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		logger.GetLogger().Warn(err.Error())
+		http.Error(w, "Error executing template", 500)
+		return
+	}
+}
+
+// forumViews builds the readable children of parentID along with stats
+// aggregated over each child's whole subtree.
+func (h *ForumHandler) forumViews(user models.User, forums []models.Forum, parentID int) ([]views.ForumView, error) {
+	var result []views.ForumView
+	for _, forum := range forums {
+		if forum.ParentID != parentID || !h.Service.ForumService.CanRead(user.Role, forum) {
+			continue
+		}
+
+		var subtree []int
+		for _, id := range services.Subtree(forums, forum.ID) {
+			for _, f := range forums {
+				if f.ID == id && h.Service.ForumService.CanRead(user.Role, f) {
+					subtree = append(subtree, id)
+				}
+			}
+		}
+
+		stats, err := h.Service.ForumService.GetStats(subtree)
+		if err != nil {
+			return nil, err
+		}
+
+		view := views.ForumView{Forum: forum, Stats: stats}
+		for _, child := range forums {
+			if child.ParentID == forum.ID && h.Service.ForumService.CanRead(user.Role, child) {
+				view.Children = append(view.Children, child)
+			}
+		}
+		result = append(result, view)
+	}
+	return result, nil
+}
+
+func (h *ForumHandler) Admin(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = h.applyAdminAction(r)
+		if err != nil {
+			h.renderAdmin(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		http.Redirect(w, r, "/admin/forums", http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		h.renderAdmin(w, http.StatusOK, "")
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ForumHandler) applyAdminAction(r *http.Request) error {
+	var err error
+	switch r.FormValue("action") {
+	case "create":
+		var forum models.Forum
+		forum, err = h.forumFromForm(r)
+		if err == nil {
+			_, err = h.Service.ForumService.CreateForum(forum)
+		}
+	case "update":
+		var forum models.Forum
+		forum, err = h.forumFromForm(r)
+		if err == nil {
+			forum.ID, err = strconv.Atoi(r.FormValue("id"))
+			if err != nil {
+				return models.ValueMismatch
+			}
+			err = h.Service.ForumService.UpdateForum(forum)
+		}
+	case "delete":
+		var id int
+		id, err = strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			return models.ValueMismatch
+		}
+		err = h.Service.ForumService.DeleteForum(id)
+	default:
+		return models.ValueMismatch
+	}
+
+	switch err {
+	case nil, models.UniqueConstraintSlug, models.NotFoundAnything, models.ValueMismatch, models.ErrForumNotEmpty:
+		return err
+	default:
+		logger.GetLogger().Error(err.Error())
+		return models.ErrUnknown
+	}
+}
+
+func (h *ForumHandler) forumFromForm(r *http.Request) (models.Forum, error) {
+	forum := models.Forum{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Slug:        strings.TrimSpace(r.FormValue("slug")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		ReadRole:    r.FormValue("read_role"),
+		PostRole:    r.FormValue("post_role"),
+	}
+
+	if validators.NonBlankValidate(forum.Name) != nil || validators.LengthRangeValidate(forum.Name, 1, 50) != nil {
+		return models.Forum{}, models.ValueMismatch
+	}
+	if forum.Slug != "" && validators.SlugValidate(forum.Slug) != nil {
+		return models.Forum{}, models.ValueMismatch
+	}
+	if validators.TextLengthValidate(forum.Description, 500) != nil {
+		return models.Forum{}, models.ValueMismatch
+	}
+
+	if parent := r.FormValue("parent_id"); parent != "" {
+		num, err := strconv.Atoi(parent)
+		if err != nil {
+			return models.Forum{}, models.ValueMismatch
+		}
+		forum.ParentID = num
+	}
+	if order := r.FormValue("sort_order"); order != "" {
+		num, err := strconv.Atoi(order)
+		if err != nil {
+			return models.Forum{}, models.ValueMismatch
+		}
+		forum.SortOrder = num
+	}
+
+	return forum, nil
+}
+
+func (h *ForumHandler) renderAdmin(w http.ResponseWriter, status int, message string) {
+	file := "./ui/templates/adminForums.html"
+	tmpl, err := template.ParseFiles(file)
+	if err != nil {
+		http.Error(w, "Error parsing templates", 500)
+		return
+	}
+
+	forums, err := h.Service.ForumService.GetForums()
+	if err != nil {
+		http.Error(w, "Cant fetch forums", http.StatusInternalServerError)
+		return
+	}
+
+	data := adminForumsPage{
+		Forums: forums,
+		Roles:  []string{models.RoleGuest, models.RoleUser, models.RoleModerator, models.RoleAdmin},
+		Error:  message,
+	}
+
+	w.WriteHeader(status)
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		logger.GetLogger().Warn(err.Error())
+		http.Error(w, "Error executing template", 500)
+		return
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 func main() {
-	app := NewApplication(nil)
+	app := NewApplication(NewConfig())
 	err := app.Start(":8080")
 	if err != nil {
 		return
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"forum/pkg/utils/validators"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type inboxPage struct {
+	Conversations []models.Conversation
+	Unread        int
+}
+
+type conversationPage struct {
+	UID          string
+	Conversation models.Conversation
+	Messages     []models.Message
+	Error        string
+}
+
+type newConversationPage struct {
+	To      string
+	Subject string
+	Content string
+	Error   string
+}
+
+type blocksPage struct {
+	Blocked []string
+}
+
+type messageReportsPage struct {
+	Reports []models.MessageReport
+}
+
+type MessageHandler struct {
+	Service *services.Service
+}
+
+func NewMessageHandler(Service *services.Service) *MessageHandler {
+	return &MessageHandler{
+		Service: Service,
+	}
+}
+
+// Inbox serves /messages, the conversations of the user with their unread
+// counts.
+func (h *MessageHandler) Inbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	conversations, err := h.Service.MessageService.GetInbox(user.ID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load messages", http.StatusInternalServerError)
+		return
+	}
+
+	data := inboxPage{Conversations: conversations}
+	for _, c := range conversations {
+		data.Unread += c.Unread
+	}
+
+	renderPage(w, http.StatusOK, "./ui/templates/inbox.html", data)
+}
+
+// New serves /messages/new. It starts a conversation with the comma
+// separated usernames of the to field.
+func (h *MessageHandler) New(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		user := getUserFromContext(r)
+
+		data := newConversationPage{
+			To:      r.FormValue("to"),
+			Subject: r.FormValue("subject"),
+			Content: r.FormValue("content"),
+		}
+
+		id, err := h.Service.MessageService.StartConversation(user.ID, strings.Split(data.To, ","), data.Subject, data.Content)
+		if err != nil {
+			status := http.StatusBadRequest
+			switch err {
+			case models.NotFoundAnything:
+				data.Error = "One of the recipients does not exist."
+			case models.ValueMismatch:
+				data.Error = "Add up to 9 other users, a subject of at most 100 characters and a message of at most 5000 characters."
+			case models.ErrBlocked:
+				status = http.StatusForbidden
+				data.Error = "You cannot message one of these users."
+			case models.ErrEmailNotVerified:
+				status = http.StatusForbidden
+				data.Error = "Please confirm your email address before sending messages."
+			case models.ErrRateLimited:
+				status = http.StatusTooManyRequests
+				data.Error = "You have started too many conversations. Please try again later."
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant start conversation", http.StatusInternalServerError)
+				return
+			}
+			renderPage(w, status, "./ui/templates/newConversation.html", data)
+			return
+		}
+
+		http.Redirect(w, r, "/messages/"+strconv.Itoa(id), http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		renderPage(w, http.StatusOK, "./ui/templates/newConversation.html", newConversationPage{To: r.URL.Query().Get("to")})
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Conversation serves /messages/{id}, the messages of one conversation, and
+// takes replies to it.
+func (h *MessageHandler) Conversation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/messages/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if r.Method == http.MethodPost {
+		_, err := h.Service.MessageService.SendMessage(user.ID, id, r.FormValue("content"))
+		if err != nil {
+			var message string
+			status := http.StatusBadRequest
+			switch err {
+			case models.NotFoundAnything:
+				http.NotFound(w, r)
+				return
+			case models.ValueMismatch:
+				message = "Messages must not be empty or longer than 5000 characters."
+			case models.ErrBlocked:
+				status = http.StatusForbidden
+				message = "You cannot message one of the members of this conversation."
+			case models.ErrEmailNotVerified:
+				status = http.StatusForbidden
+				message = "Please confirm your email address before sending messages."
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant send message", http.StatusInternalServerError)
+				return
+			}
+			h.renderConversation(w, r, user, id, status, message)
+			return
+		}
+
+		http.Redirect(w, r, "/messages/"+strconv.Itoa(id), http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		h.renderConversation(w, r, user, id, http.StatusOK, "")
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *MessageHandler) renderConversation(w http.ResponseWriter, r *http.Request, user models.User, id, status int, message string) {
+	conversation, messages, err := h.Service.MessageService.GetConversation(user.ID, id)
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything:
+			http.NotFound(w, r)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load conversation", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	renderPage(w, status, "./ui/templates/conversation.html", conversationPage{
+		UID:          user.ID,
+		Conversation: conversation,
+		Messages:     messages,
+		Error:        message,
+	})
+}
+
+// Report files a report about a message the user received.
+func (h *MessageHandler) Report(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	messageID, err := strconv.Atoi(r.FormValue("messageID"))
+	if err != nil {
+		http.Error(w, "Invalid message", http.StatusBadRequest)
+		return
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if validators.NonBlankValidate(reason) != nil || validators.TextLengthValidate(reason, 500) != nil {
+		renderNotice(w, http.StatusBadRequest, "Report not sent", "Please tell us briefly what is wrong, in at most 500 characters.")
+		return
+	}
+
+	err = h.Service.MessageService.ReportMessage(user.ID, messageID, reason)
+	if err != nil {
+		switch err {
+		case models.ErrAlreadyReported:
+			renderNotice(w, http.StatusConflict, "Already reported", "You have already reported this. The staff will look into it.")
+		case models.NotFoundAnything:
+			http.Error(w, "Not found", http.StatusNotFound)
+		case models.ValueMismatch:
+			http.Error(w, "You cannot report your own messages", http.StatusBadRequest)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant send report", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	renderNotice(w, http.StatusOK, "Report sent", "Thank you. The staff will look into it.")
+}
+
+// Blocks serves /settings/blocks, the users the user blocked. The block and
+// unblock actions take a username and go back to next, when it is a profile,
+// or to the list.
+func (h *MessageHandler) Blocks(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if r.Method == http.MethodPost {
+		username := r.FormValue("username")
+
+		var err error
+		switch r.FormValue("action") {
+		case "block":
+			err = h.Service.MessageService.Block(user.ID, username)
+		case "unblock":
+			err = h.Service.MessageService.Unblock(user.ID, username)
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			switch err {
+			case models.NotFoundAnything:
+				http.NotFound(w, r)
+			case models.ValueMismatch:
+				http.Error(w, "You cannot block yourself", http.StatusBadRequest)
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant save block", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		next := "/settings/blocks"
+		if r.FormValue("next") == "profile" {
+			next = "/u/" + username
+		}
+		http.Redirect(w, r, next, http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		blocked, err := h.Service.MessageService.GetBlocked(user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load blocks", http.StatusInternalServerError)
+			return
+		}
+
+		renderPage(w, http.StatusOK, "./ui/templates/blocks.html", blocksPage{Blocked: blocked})
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Reports lists the reported messages for staff and dismisses reports.
+func (h *MessageHandler) Reports(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid report", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.Service.MessageService.DismissMessageReport(user.ID, id); err != nil {
+			messageReportError(w, err)
+			return
+		}
+
+		http.Redirect(w, r, "/moderate/messages", http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		reports, err := h.Service.MessageService.GetMessageReports(user.ID)
+		if err != nil {
+			messageReportError(w, err)
+			return
+		}
+
+		renderPage(w, http.StatusOK, "./ui/templates/messageReports.html", messageReportsPage{Reports: reports})
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func messageReportError(w http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrForbidden:
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case models.NotFoundAnything:
+		http.Error(w, "Report not found", http.StatusNotFound)
+	default:
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load reports", http.StatusInternalServerError)
+	}
+}
@@ -70,6 +70,40 @@ func (app *Middle) RequireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+func (app *Middle) RequireAdmin(next http.Handler) http.Handler {
+	return app.requireStaffRole(next, models.User.IsAdmin)
+}
+
+// RequireStaff lets moderators and admins through.
+func (app *Middle) RequireStaff(next http.Handler) http.Handler {
+	return app.requireStaffRole(next, models.User.IsStaff)
+}
+
+func (app *Middle) requireStaffRole(next http.Handler, allowed func(models.User) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromContext(r)
+		if !allowed(user) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if !user.TOTPEnabled {
+			required, err := app.Service.SettingsService.GetBool(services.SettingRequireStaffTwoFactor)
+			if err != nil {
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if required {
+				http.Redirect(w, r, "/settings/2fa", http.StatusSeeOther)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *Middle) RecoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"net/http"
+	"strconv"
+)
+
+type notificationsPage struct {
+	Notifications []models.Notification
+	Unread        int
+}
+
+type notificationSettingsPage struct {
+	Preferences []models.NotificationPreference
+	Saved       bool
+}
+
+type NotificationHandler struct {
+	Service *services.Service
+}
+
+func NewNotificationHandler(Service *services.Service) *NotificationHandler {
+	return &NotificationHandler{
+		Service: Service,
+	}
+}
+
+// Notifications lists the notifications of the user and marks one or all of
+// them as read.
+func (h *NotificationHandler) Notifications(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if r.Method == http.MethodPost {
+		var err error
+
+		switch r.FormValue("action") {
+		case "read":
+			id, convErr := strconv.Atoi(r.FormValue("id"))
+			if convErr != nil {
+				http.Error(w, "Invalid notification", http.StatusBadRequest)
+				return
+			}
+			err = h.Service.NotificationService.MarkRead(user.ID, id)
+		case "readAll":
+			err = h.Service.NotificationService.MarkAllRead(user.ID)
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant update notifications", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		notifications, err := h.Service.NotificationService.GetNotifications(user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load notifications", http.StatusInternalServerError)
+			return
+		}
+
+		data := notificationsPage{Notifications: notifications}
+		for _, n := range notifications {
+			if !n.Read {
+				data.Unread++
+			}
+		}
+
+		renderPage(w, http.StatusOK, "./ui/templates/notifications.html", data)
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Settings serves /settings/notifications where each notification type can
+// be turned on or off.
+func (h *NotificationHandler) Settings(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+
+		enabled := make(map[string]bool)
+		for _, kind := range r.PostForm["types"] {
+			enabled[kind] = true
+		}
+
+		err := h.Service.NotificationService.SetPreferences(user.ID, enabled)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant save preferences", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/settings/notifications?saved=1", http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		prefs, err := h.Service.NotificationService.GetPreferences(user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load preferences", http.StatusInternalServerError)
+			return
+		}
+
+		renderPage(w, http.StatusOK, "./ui/templates/notificationSettings.html", notificationSettingsPage{
+			Preferences: prefs,
+			Saved:       r.URL.Query().Get("saved") != "",
+		})
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Script serves the script that shows the unread badge in page headers.
+func (h *NotificationHandler) Script(w http.ResponseWriter, r *http.Request) {
+	serveScript(w, r, "./ui/static/notifications.js")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/oauth"
+	"forum/pkg/utils/cookies"
+	"forum/pkg/utils/logger"
+	"forum/pkg/utils/tokens"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	oauthStatePurpose = "oauth-state"
+	oauthStateTTL     = 10 * time.Minute
+)
+
+type OAuthHandler struct {
+	Auth      *AuthHanlder
+	Providers map[string]*oauth.Provider
+	Secret    []byte
+}
+
+func NewOAuthHandler(Auth *AuthHanlder, Providers map[string]*oauth.Provider, Secret []byte) *OAuthHandler {
+	return &OAuthHandler{
+		Auth:      Auth,
+		Providers: Providers,
+		Secret:    Secret,
+	}
+}
+
+// Handle serves /oauth/{provider}/login and /oauth/{provider}/callback.
+func (h *OAuthHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/oauth/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	provider, ok := h.Providers[parts[0]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch parts[1] {
+	case "login":
+		h.start(w, r, provider)
+	case "callback":
+		h.callback(w, r, provider)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// start sends the browser to the provider. The state and PKCE verifier are
+// kept in a signed cookie until the provider redirects back.
+func (h *OAuthHandler) start(w http.ResponseWriter, r *http.Request, provider *oauth.Provider) {
+	state, err := oauth.RandomString(16)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant start login", http.StatusInternalServerError)
+		return
+	}
+
+	verifier, challenge, err := oauth.NewPKCE()
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant start login", http.StatusInternalServerError)
+		return
+	}
+
+	exp := time.Now().Add(oauthStateTTL)
+	value := tokens.Sign(h.Secret, oauthStatePurpose, provider.Name+" "+state+" "+verifier, exp)
+	cookies.SetOAuthCookie(w, value, exp)
+
+	http.Redirect(w, r, provider.AuthCodeURL(state, challenge), http.StatusFound)
+}
+
+func (h *OAuthHandler) callback(w http.ResponseWriter, r *http.Request, provider *oauth.Provider) {
+	query := r.URL.Query()
+
+	if query.Get("error") != "" {
+		renderNotice(w, http.StatusBadRequest, "Login cancelled", "The "+provider.Name+" login was cancelled.")
+		return
+	}
+
+	verifier, ok := h.checkState(r, provider, query.Get("state"))
+	cookies.DeleteOAuthCookie(w)
+	if !ok {
+		renderNotice(w, http.StatusBadRequest, "Login failed", "This login attempt is invalid or expired. Please try again.")
+		return
+	}
+
+	accessToken, err := provider.Exchange(r.Context(), query.Get("code"), verifier)
+	if err != nil {
+		logger.GetLogger().Warn(err.Error())
+		renderNotice(w, http.StatusBadGateway, "Login failed", "Could not log in with "+provider.Name+". Please try again.")
+		return
+	}
+
+	ident, err := provider.FetchIdentity(r.Context(), accessToken)
+	if err != nil {
+		logger.GetLogger().Warn(err.Error())
+		renderNotice(w, http.StatusBadGateway, "Login failed", "Could not log in with "+provider.Name+". Please try again.")
+		return
+	}
+
+	current := getUserFromContext(r)
+
+	user, err := h.Auth.Service.IdentityService.ResolveLogin(provider.Name, ident, current.ID)
+	if err != nil {
+		switch err {
+		case models.ErrIdentityConflict:
+			if current.ID != "" {
+				renderNotice(w, http.StatusConflict, "Already linked", "This "+provider.Name+" account is linked to another user.")
+			} else {
+				renderNotice(w, http.StatusConflict, "Account exists", "An account with this email already exists. Log in with your password and open this page again to link "+provider.Name+".")
+			}
+		case models.ErrIdentityNoEmail:
+			renderNotice(w, http.StatusBadRequest, "Email required", "Your "+provider.Name+" account has no email address we can use.")
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "UNKNOWN", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if current.ID != "" {
+		renderNotice(w, http.StatusOK, "Account linked", "You can now log in with "+provider.Name+".")
+		return
+	}
+
+	if user.TOTPEnabled {
+		renderPage(w, http.StatusOK, "./ui/templates/login2fa.html", twoFactorLoginPage{Token: h.Auth.Service.TwoFactorService.StartLogin(user.ID)})
+		return
+	}
+
+	h.Auth.startSession(w, r, user)
+}
+
+// checkState compares state with the signed cookie set by start and returns
+// the PKCE verifier.
+func (h *OAuthHandler) checkState(r *http.Request, provider *oauth.Provider, state string) (string, bool) {
+	cookie, err := cookies.GetOAuthCookie(r)
+	if err != nil {
+		return "", false
+	}
+
+	subject, err := tokens.Verify(h.Secret, oauthStatePurpose, cookie.Value)
+	if err != nil {
+		return "", false
+	}
+
+	fields := strings.Split(subject, " ")
+	if len(fields) != 3 || fields[0] != provider.Name || state == "" || fields[1] != state {
+		return "", false
+	}
+
+	return fields[2], true
+}
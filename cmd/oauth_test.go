@@ -0,0 +1,90 @@
+package main
+
+import (
+	"forum/pkg/oauth"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOAuthCallbackRejectsStateMismatch(t *testing.T) {
+	// Notices are rendered from ./ui/templates.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("provider called at %s", r.URL.Path)
+		http.Error(w, "unexpected", http.StatusTeapot)
+	}))
+	defer idp.Close()
+
+	provider := &oauth.Provider{
+		Name:        "mock",
+		Kind:        oauth.KindOIDC,
+		ClientID:    "client",
+		AuthURL:     idp.URL + "/authorize",
+		TokenURL:    idp.URL + "/token",
+		UserInfoURL: idp.URL + "/userinfo",
+		RedirectURL: "http://forum.test/oauth/mock/callback",
+		Client:      idp.Client(),
+	}
+	h := NewOAuthHandler(nil, map[string]*oauth.Provider{"mock": provider}, []byte("test-secret"))
+
+	start := httptest.NewRecorder()
+	h.Handle(start, httptest.NewRequest(http.MethodGet, "/oauth/mock/login", nil))
+	if start.Code != http.StatusFound {
+		t.Fatalf("login status = %d, want %d", start.Code, http.StatusFound)
+	}
+	cookies := start.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("login set no state cookie")
+	}
+
+	loc, err := url.Parse(start.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := loc.Query().Get("state")
+	if state == "" {
+		t.Fatal("authorization URL has no state")
+	}
+
+	tests := []struct {
+		name    string
+		state   string
+		cookies bool
+	}{
+		{"wrong state", state + "x", true},
+		{"empty state", "", true},
+		{"no cookie", state, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/oauth/mock/callback?code=code-1&state="+url.QueryEscape(tt.state), nil)
+			if tt.cookies {
+				for _, c := range cookies {
+					req.AddCookie(c)
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			h.Handle(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(rec.Body.String(), "Login failed") {
+				t.Fatalf("body does not explain the failure: %s", rec.Body.String())
+			}
+		})
+	}
+}
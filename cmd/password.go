@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/cookies"
+	"forum/pkg/utils/logger"
+	"forum/pkg/utils/validators"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type resetPasswordPage struct {
+	Token string
+	Hint  string
+	Error string
+}
+
+type changePasswordPage struct {
+	Hint  string
+	Error string
+}
+
+type PasswordHandler struct {
+	Service *services.Service
+}
+
+func NewPasswordHandler(Service *services.Service) *PasswordHandler {
+	return &PasswordHandler{
+		Service: Service,
+	}
+}
+
+func (h *PasswordHandler) Forgot(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		email := strings.TrimSpace(r.FormValue("email"))
+		if validators.EmailValidate(email) != nil {
+			renderPage(w, http.StatusBadRequest, "./ui/templates/forgotPassword.html", "Invalid email format")
+			return
+		}
+
+		err = h.Service.PasswordResetService.RequestReset(email, clientIP(r))
+		if err != nil {
+			switch err {
+			case models.ErrRateLimited:
+				renderPage(w, http.StatusTooManyRequests, "./ui/templates/forgotPassword.html", "Too many reset requests. Please try again later.")
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant send email", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		renderNotice(w, http.StatusOK, "Check your email", "If an account uses "+email+", we have sent it a link to reset the password.")
+	} else if r.Method == http.MethodGet {
+		renderPage(w, http.StatusOK, "./ui/templates/forgotPassword.html", nil)
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *PasswordHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		token := r.FormValue("token")
+		pass := r.FormValue("password")
+		passConf := r.FormValue("passwordConf")
+		hint := h.Service.PasswordService.Hint()
+
+		uid, err := h.Service.PasswordResetService.CheckToken(token)
+		if err != nil {
+			switch err {
+			case models.ErrResetTokenInvalid:
+				renderNotice(w, http.StatusBadRequest, "Invalid link", "This reset link is invalid or expired. Request a new one.")
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant check reset link", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		user, err := h.Service.UserService.GetUserByID(uid)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant reset password", http.StatusInternalServerError)
+			return
+		}
+
+		err = h.Service.PasswordService.Check(pass, user.Username, user.Email)
+		if err != nil {
+			message, ok := passwordRejection(err)
+			if !ok {
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant check password", http.StatusInternalServerError)
+				return
+			}
+			renderPage(w, http.StatusBadRequest, "./ui/templates/resetPassword.html", resetPasswordPage{Token: token, Hint: hint, Error: message})
+			return
+		}
+		if pass != passConf {
+			renderPage(w, http.StatusBadRequest, "./ui/templates/resetPassword.html", resetPasswordPage{Token: token, Hint: hint, Error: "Passwords doesn't match"})
+			return
+		}
+
+		err = h.Service.PasswordResetService.ResetPassword(token, pass)
+		if err != nil {
+			switch err {
+			case models.ErrResetTokenInvalid:
+				renderNotice(w, http.StatusBadRequest, "Invalid link", "This reset link is invalid or expired. Request a new one.")
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant reset password", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		cookies.DeleteCookie(w)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		token := r.URL.Query().Get("token")
+		_, err := h.Service.PasswordResetService.CheckToken(token)
+		if err != nil {
+			switch err {
+			case models.ErrResetTokenInvalid:
+				renderNotice(w, http.StatusBadRequest, "Invalid link", "This reset link is invalid or expired. Request a new one.")
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant check reset link", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		renderPage(w, http.StatusOK, "./ui/templates/resetPassword.html", resetPasswordPage{Token: token, Hint: h.Service.PasswordService.Hint()})
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *PasswordHandler) Change(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		user := getUserFromContext(r)
+		current := r.FormValue("current")
+		pass := r.FormValue("password")
+		passConf := r.FormValue("passwordConf")
+
+		hint := h.Service.PasswordService.Hint()
+
+		err = h.Service.PasswordService.Check(pass, user.Username, user.Email)
+		if err != nil {
+			message, ok := passwordRejection(err)
+			if !ok {
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant check password", http.StatusInternalServerError)
+				return
+			}
+			renderPage(w, http.StatusBadRequest, "./ui/templates/changePassword.html", changePasswordPage{Hint: hint, Error: message})
+			return
+		}
+		if pass != passConf {
+			renderPage(w, http.StatusBadRequest, "./ui/templates/changePassword.html", changePasswordPage{Hint: hint, Error: "Passwords doesn't match"})
+			return
+		}
+
+		err = h.Service.UserService.ChangePassword(user.ID, current, pass)
+		if err != nil {
+			switch err {
+			case models.ErrInvalidCredentials:
+				renderPage(w, http.StatusBadRequest, "./ui/templates/changePassword.html", changePasswordPage{Hint: hint, Error: "Current password is wrong"})
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant change password", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// Log out every other device and start a fresh session here.
+		err = h.Service.SessionService.DeleteSessionsByUID(user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant reset sessions", http.StatusInternalServerError)
+			return
+		}
+
+		times := time.Now().Add(time.Hour)
+		session, err := h.Service.SessionService.RegisterSession(user.ID, times)
+		if err != nil {
+			logger.GetLogger().Warn(err.Error())
+			http.Error(w, "ERROR CREATING SESSION", http.StatusInternalServerError)
+			return
+		}
+		cookies.SetCookie(w, session.ID, times)
+
+		renderNotice(w, http.StatusOK, "Password changed", "Your password has been changed.")
+	} else if r.Method == http.MethodGet {
+		renderPage(w, http.StatusOK, "./ui/templates/changePassword.html", changePasswordPage{Hint: h.Service.PasswordService.Hint()})
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// clientIP returns the address r came from without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// passwordRejection returns the message explaining why a new password was
+// refused, or false when err is not about the password itself.
+func passwordRejection(err error) (string, bool) {
+	var policyErr *validators.PasswordError
+	if errors.As(err, &policyErr) {
+		return policyErr.Reason, true
+	}
+	if err == models.ErrPasswordBreached {
+		return "This password has appeared in a data breach, choose another one", true
+	}
+	return "", false
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pollCloseLayout is the format of datetime-local inputs. Closing times are
+// entered in UTC.
+const pollCloseLayout = "2006-01-02T15:04"
+
+type PollHandler struct {
+	Service *services.Service
+}
+
+func NewPollHandler(Service *services.Service) *PollHandler {
+	return &PollHandler{
+		Service: Service,
+	}
+}
+
+// Vote casts the ballot of the user in the poll of postID with the chosen
+// options and goes back to the post.
+func (h *PollHandler) Vote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	postID, err := strconv.Atoi(r.FormValue("postID"))
+	if err != nil {
+		http.Error(w, "Invalid post", http.StatusBadRequest)
+		return
+	}
+
+	optionIDs, err := optionsFromForm(r)
+	if err != nil {
+		http.Error(w, "Invalid vote", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.PollService.Vote(user.ID, postID, optionIDs); err != nil {
+		switch err {
+		case models.ErrAlreadyVoted:
+			renderNotice(w, http.StatusConflict, "Already voted", "You have already voted in this poll.")
+		case models.ErrPollClosed:
+			renderNotice(w, http.StatusConflict, "Poll closed", "This poll no longer takes votes.")
+		case models.ValueMismatch:
+			http.Error(w, "Choose one of the options", http.StatusBadRequest)
+		case models.NotFoundAnything:
+			http.NotFound(w, r)
+		case models.ErrForbidden:
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant save vote", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/post/"+strconv.Itoa(postID)+"#poll", http.StatusSeeOther)
+}
+
+// pollFromForm reads the poll fields of the post form. It reports false when
+// no question was given.
+func pollFromForm(r *http.Request) (models.Poll, bool, error) {
+	question := strings.TrimSpace(r.FormValue("pollQuestion"))
+	if question == "" {
+		return models.Poll{}, false, nil
+	}
+
+	poll := models.Poll{
+		Question:  question,
+		Multiple:  r.FormValue("pollMultiple") != "",
+		Anonymous: r.FormValue("pollAnonymous") != "",
+	}
+	for _, label := range r.Form["pollOptions"] {
+		poll.Options = append(poll.Options, models.PollOption{Label: label})
+	}
+
+	if value := r.FormValue("pollCloses"); value != "" {
+		closesAt, err := time.Parse(pollCloseLayout, value)
+		if err != nil {
+			return models.Poll{}, true, err
+		}
+		poll.ClosesAt = closesAt
+	}
+
+	return poll, true, nil
+}
+
+// optionsFromForm reads the chosen option IDs of a vote.
+func optionsFromForm(r *http.Request) ([]int, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	var optionIDs []int
+	for _, value := range r.Form["option"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		optionIDs = append(optionIDs, id)
+	}
+
+	return optionIDs, nil
+}
@@ -1,36 +1,71 @@
 package main
 
 import (
-	"fmt"
+	"forum/pkg/markdown"
 	"forum/pkg/models"
+	"forum/pkg/ranking"
 	"forum/pkg/services"
 	"forum/pkg/utils/logger"
 	"forum/pkg/views"
 	"html/template"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// indexPageSize is how many posts the front page lists at a time.
+const indexPageSize = 20
+
 type PostHanlder struct {
 	Service *services.Service
 }
 
 type page struct {
 	Auth     bool
+	Verified bool
+	IsAdmin  bool
+	IsStaff  bool
 	Username string
+	// Unread is how many private messages the user has not read.
+	Unread int
+	Cats   []models.Category
+	Posts  []views.PostView
+	// Sort and Period are the order of Posts, see the ranking package.
+	Sort     string
+	Period   string
+	Page     int
+	PrevPage int
+	NextPage int
+}
+
+type createPostPage struct {
 	Cats     []models.Category
-	Posts    []views.PostView
+	Forums   []models.Forum
+	Selected int
 }
 
 type showPost struct {
-	Auth          bool
-	Post          views.PostView
-	Comments      []views.CommentView
-	LikesCount    int
-	DislikesCount int
-	IsLiked       bool
-	IsDisliked    bool
+	Auth        bool
+	IsStaff     bool
+	LastEventID uint64
+	Images      []models.Upload
+	CanComment  bool
+	Breadcrumbs []models.Forum
+	Post        views.PostView
+	Comments    []views.CommentView
+	// Reactions are the counts of every kind offered on posts.
+	Reactions []models.ReactionCount
+	// CommentKinds are offered on comments added by live updates.
+	CommentKinds []models.ReactionKind
+	IsBookmarked bool
+	FollowState  string
+	// Poll is nil when the post has none.
+	Poll *models.Poll
+	// FirstUnread is the first comment added since the user last read the
+	// thread, or 0.
+	FirstUnread int
 }
 
 func (p *PostHanlder) stringsToInts(str []string) ([]int, error) {
@@ -55,12 +90,18 @@ func (p *PostHanlder) convertPostToView(post models.PostWithCats) (views.PostVie
 		Id:         post.ID,
 		AuthorName: user.Username,
 		Content:    post.Content,
-		Title:      post.Title,
-		Cats:       post.Cats,
+		// Sanitized by the markdown package when the post was saved.
+		ContentHTML: template.HTML(post.ContentHTML),
+		Title:       post.Title,
+		Cats:        post.Cats,
+		CreatedAt:   post.CreatedAt,
+		Pending:     post.Pending,
 	}, nil
 }
 
-func (p *PostHanlder) convertCommentToView(comments []models.Comment) ([]views.CommentView, error) {
+// convertCommentToView prepares comments for display to the user uid, who is
+// empty for guests.
+func (p *PostHanlder) convertCommentToView(comments []models.Comment, uid string) ([]views.CommentView, error) {
 	var v []views.CommentView
 	for _, val := range comments {
 		user, err := p.Service.UserService.GetUserByID(val.UID)
@@ -68,11 +109,11 @@ func (p *PostHanlder) convertCommentToView(comments []models.Comment) ([]views.C
 			return nil, err
 		}
 
-		likes, dislikes, err := p.Service.ReactionService.GetReactionCountsForComment(val.ID)
+		reactions, err := p.Service.ReactionService.GetReactionsForComment(uid, val.ID)
 		if err != nil {
 			return nil, err
 		}
-		v = append(v, views.CommentView{Author: user.Username, Content: val.Content, ID: val.ID, IsLiked: false, IsDisliked: false, LikesCount: likes, DislikesCount: dislikes})
+		v = append(v, views.CommentView{Author: user.Username, Content: val.Content, ContentHTML: template.HTML(val.ContentHTML), ID: val.ID, Reactions: reactions, Pending: val.Pending})
 	}
 
 	return v, nil
@@ -106,8 +147,31 @@ func (p *PostHanlder) Index(w http.ResponseWriter, r *http.Request) {
 
 	user := getUserFromContext(r)
 
-	posts, err := p.Service.PostService.GetAllPosts()
+	sort := r.URL.Query().Get("sort")
+	if !ranking.ValidSort(sort) {
+		sort = ranking.SortHot
+	}
+	period := r.URL.Query().Get("t")
+	if _, ok := ranking.Since(period, time.Now()); !ok {
+		period = ranking.PeriodAll
+	}
+
+	pageNum, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+
+	forumIDs, err := p.Service.ForumService.ReadableForumIDs(user.Role)
 	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant fecth posts", http.StatusInternalServerError)
+		return
+	}
+
+	start := (pageNum - 1) * indexPageSize
+	posts, total, err := p.Service.RankingService.GetRankedPosts(sort, period, forumIDs, indexPageSize, start)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
 		http.Error(w, "Cant fecth posts", http.StatusInternalServerError)
 		return
 	}
@@ -125,13 +189,38 @@ func (p *PostHanlder) Index(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := page{
-		Posts: views,
-		Cats:  cats,
+		Posts:  views,
+		Cats:   cats,
+		Sort:   sort,
+		Period: period,
+		Page:   pageNum,
+	}
+	if pageNum > 1 {
+		data.PrevPage = pageNum - 1
+	}
+	if start+len(posts) < total {
+		data.NextPage = pageNum + 1
 	}
 
 	if (user != models.User{}) {
 		data.Auth = true
+		data.IsAdmin = user.IsAdmin()
+		data.IsStaff = user.IsStaff()
+		data.Verified = user.EmailVerified
 		data.Username = user.Username
+		data.Unread, err = p.Service.MessageService.GetUnreadCount(user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load messages", http.StatusInternalServerError)
+			return
+		}
+		counts, err := p.Service.ReadService.GetUnreadCounts(user.ID, viewIDs(data.Posts))
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load read markers", http.StatusInternalServerError)
+			return
+		}
+		markUnread(data.Posts, counts)
 	}
 
 	err = tmpl.Execute(w, data)
@@ -144,9 +233,12 @@ func (p *PostHanlder) Index(w http.ResponseWriter, r *http.Request) {
 
 func (p *PostHanlder) CreatePost(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
-		err := r.ParseForm()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		maxBytes := p.Service.UploadService.MaxBytes()
+		r.Body = http.MaxBytesReader(w, r.Body, maxPostImages*maxBytes+1<<20)
+
+		err := r.ParseMultipartForm(maxBytes)
+		if err != nil && err != http.ErrNotMultipart {
+			http.Error(w, "Request is too large", http.StatusRequestEntityTooLarge)
 			return
 		}
 
@@ -158,15 +250,115 @@ func (p *PostHanlder) CreatePost(w http.ResponseWriter, r *http.Request) {
 		content := r.FormValue("content")
 		title := r.FormValue("title")
 		cats := r.Form["cats"]
-		fmt.Println(content, cats)
 		catIds, err := p.stringsToInts(cats)
+		if err != nil {
+			http.Error(w, "cats not correct", http.StatusBadRequest)
+			return
+		}
 
-		if p.Service.PostService.CreatePost(models.Post{
+		forumID, err := strconv.Atoi(r.FormValue("forum"))
+		if err != nil {
+			http.Error(w, "forum not correct", http.StatusBadRequest)
+			return
+		}
+
+		poll, hasPoll, err := pollFromForm(r)
+		if err == nil && hasPoll {
+			poll, err = p.Service.PollService.CheckPoll(poll)
+		}
+		if err != nil {
+			http.Error(w, "Polls need a question of at most 200 characters, 2 to 10 different options of at most 100 characters and a closing time in the future", http.StatusBadRequest)
+			return
+		}
+
+		var files []*multipart.FileHeader
+		if r.MultipartForm != nil {
+			files = r.MultipartForm.File["images"]
+		}
+		if len(files) > maxPostImages {
+			http.Error(w, "Too many images", http.StatusBadRequest)
+			return
+		}
+
+		trust, err := p.Service.ReputationService.GetTrust(user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Post creation error", http.StatusInternalServerError)
+			return
+		}
+		if len(files) > 0 && !trust.Level.CanPostImages() {
+			http.Error(w, "New users cant post images yet", http.StatusForbidden)
+			return
+		}
+		if hasPoll && !trust.Level.CanCreatePolls() {
+			http.Error(w, "Your trust level does not allow polls yet", http.StatusForbidden)
+			return
+		}
+
+		uploads, message, err := saveUploads(p.Service, user.ID, files)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant save images", http.StatusInternalServerError)
+			return
+		}
+		if message != "" {
+			http.Error(w, message, http.StatusBadRequest)
+			return
+		}
+
+		var postPoll *models.Poll
+		if hasPoll {
+			postPoll = &poll
+		}
+
+		postID, err := p.Service.PostService.CreatePost(models.Post{
 			UID:     user.ID,
+			ForumID: forumID,
 			Title:   title,
 			Content: content,
-		}, catIds) != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}, catIds, postPoll)
+		if err != nil {
+			for _, upload := range uploads {
+				if err := p.Service.UploadService.DeleteUpload(upload); err != nil {
+					logger.GetLogger().Error(err.Error())
+				}
+			}
+
+			switch err {
+			case models.ErrForbidden:
+				http.Error(w, "You cant post in this forum", http.StatusForbidden)
+			case models.ErrEmailNotVerified:
+				http.Error(w, "Confirm your email before posting", http.StatusForbidden)
+			case models.ErrTrustTooLow:
+				http.Error(w, "New users cant post links yet", http.StatusForbidden)
+			case models.NoCatsSelected, models.NotFoundAnything, models.ValueMismatch:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Post creation error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		err = p.Service.UploadService.AttachToPost(uploads, postID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant attach images", http.StatusInternalServerError)
+			return
+		}
+
+		err = p.Service.MentionService.Record(user, postID, 0, content)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+		}
+
+		err = p.Service.ReadService.MarkRead(user.ID, postID, 0)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+		}
+
+		if !trust.Level.SkipsModeration() {
+			renderNotice(w, http.StatusOK, "Post awaiting review", "Thank you. Your post will be visible to others once a moderator approves it.")
 			return
 		}
 
@@ -184,7 +376,22 @@ func (p *PostHanlder) CreatePost(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Error parsing cats", 500)
 			return
 		}
-		err = tmpl.Execute(w, cats)
+		forums, err := p.Service.ForumService.GetForums()
+		if err != nil {
+			http.Error(w, "Error loading forums", 500)
+			return
+		}
+
+		user := getUserFromContext(r)
+		data := createPostPage{Cats: cats}
+		data.Selected, _ = strconv.Atoi(r.URL.Query().Get("forum"))
+		for _, forum := range forums {
+			if p.Service.ForumService.CanPost(user.Role, forum) {
+				data.Forums = append(data.Forums, forum)
+			}
+		}
+
+		err = tmpl.Execute(w, data)
 		if err != nil {
 			logger.GetLogger().Warn(err.Error())
 			http.Error(w, "Error executing template", 500)
@@ -236,71 +443,126 @@ func (p *PostHanlder) Post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !post.VisibleTo(user) {
+		http.Error(w, "Not found post", http.StatusNotFound)
+		return
+	}
+
+	forum, err := p.Service.ForumService.GetForumByID(post.ForumID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Post load problem", http.StatusInternalServerError)
+		return
+	}
+	if !p.Service.ForumService.CanRead(user.Role, forum) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	crumbs, err := p.Service.ForumService.GetBreadcrumbs(forum.ID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Post load problem", http.StatusInternalServerError)
+		return
+	}
+
 	postview, err := p.convertPostToView(post)
 	if err != nil {
 		http.Error(w, "Error converting post", http.StatusInternalServerError)
 		return
 	}
 
-	comments, err := p.Service.CommentService.GetCommentsByPostID(postID)
+	comments, err := p.Service.CommentService.GetCommentsByPostID(postID, user)
 	if err != nil {
 		http.Error(w, "Cant load comments", http.StatusInternalServerError)
 		return
 	}
 
-	comviews, err := p.convertCommentToView(comments)
+	comviews, err := p.convertCommentToView(comments, user.ID)
 	if err != nil {
 		http.Error(w, "Error converting comments", http.StatusInternalServerError)
 		return
 	}
 
-	Likes, Dislikes, err := p.Service.ReactionService.GetReactionCountsForPost(postID)
+	reactions, err := p.Service.ReactionService.GetReactionsForPost(user.ID, postID)
 	if err != nil {
 		logger.GetLogger().Error(err.Error())
 		http.Error(w, "Error getting reaction counts", http.StatusInternalServerError)
 		return
 	}
 
+	images, err := p.Service.UploadService.GetUploadsByPostID(postID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load images", http.StatusInternalServerError)
+		return
+	}
+
+	poll, err := p.Service.PollService.GetPoll(user.ID, postID)
+	if err != nil && err != models.NotFoundAnything {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load poll", http.StatusInternalServerError)
+		return
+	}
+
 	data := showPost{
-		Post:          postview,
-		Comments:      comviews,
-		LikesCount:    Likes,
-		DislikesCount: Dislikes,
-		IsLiked:       false,
-		IsDisliked:    false,
+		LastEventID:  p.Service.Events.LastID(),
+		Images:       images,
+		Breadcrumbs:  crumbs,
+		Post:         postview,
+		Comments:     comviews,
+		Reactions:    reactions,
+		CommentKinds: p.Service.ReactionService.Kinds(models.ReactionTargetComment).Kinds,
+	}
+	if poll.PostID != 0 {
+		data.Poll = &poll
 	}
 	if (user != models.User{}) {
 		data.Auth = true
-		sign, err := p.Service.ReactionService.GetReactionSignForPost(user.ID, postID)
+		data.IsStaff = user.IsStaff()
+		data.CanComment = user.EmailVerified && p.Service.ForumService.CanPost(user.Role, forum)
+		bookmarked, bookmarkedComments, err := p.Service.BookmarkService.GetBookmarkedIDs(user.ID, postID)
 		if err != nil {
-			http.Error(w, "Cant load reaction for post", http.StatusInternalServerError)
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load bookmarks", http.StatusInternalServerError)
 			return
 		}
+		data.IsBookmarked = bookmarked
 
-		switch sign {
-		case 1:
-			data.IsLiked = true
-			break
-		case -1:
-			data.IsDisliked = true
-			break
+		data.FollowState, err = p.Service.FollowService.GetFollowState(user.ID, models.FollowThread, strconv.Itoa(postID))
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load follows", http.StatusInternalServerError)
+			return
 		}
 
 		for i, val := range data.Comments {
-			r, err := p.Service.ReactionService.GetReactionSignForComment(user.ID, val.ID)
-			if err != nil {
-				http.Error(w, "Cant load reactions for comments", http.StatusInternalServerError)
-				return
+			data.Comments[i].IsBookmarked = bookmarkedComments[val.ID]
+		}
+
+		lastRead, visited, err := p.Service.ReadService.GetLastRead(user.ID, postID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load read markers", http.StatusInternalServerError)
+			return
+		}
+		last := 0
+		for i, val := range data.Comments {
+			if visited && val.ID > lastRead {
+				data.Comments[i].Unread = true
+				if data.FirstUnread == 0 {
+					data.FirstUnread = val.ID
+				}
 			}
-			switch r {
-			case 1:
-				data.Comments[i].IsLiked = true
-				break
-			case -1:
-				data.Comments[i].IsLiked = true
-				break
+			// Held comments are left unread so that others still see
+			// them as new once they are approved.
+			if !val.Pending {
+				last = val.ID
 			}
-
+		}
+		// Only the comments shown are marked read, not ones added since.
+		if err := p.Service.ReadService.MarkRead(user.ID, postID, last); err != nil {
+			logger.GetLogger().Error(err.Error())
 		}
 	}
 
@@ -311,3 +573,66 @@ func (p *PostHanlder) Post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// Preview renders the Markdown in the content field the way it will appear
+// once posted.
+func (p *PostHanlder) Preview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Request is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(markdown.Render(r.FormValue("content"))))
+}
+
+// DeletePost removes a post for staff. The author gets a moderation
+// notification.
+func (p *PostHanlder) DeletePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	postID, err := strconv.Atoi(r.FormValue("postID"))
+	if err != nil {
+		http.Error(w, "Invalid post", http.StatusBadRequest)
+		return
+	}
+
+	err = p.Service.PostService.DeletePost(postID, user.ID)
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything:
+			http.Error(w, "Not found post", http.StatusNotFound)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant delete post", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// PreviewScript serves the script behind the Preview buttons.
+func (p *PostHanlder) PreviewScript(w http.ResponseWriter, r *http.Request) {
+	serveScript(w, r, "./ui/static/preview.js")
+}
+
+// HighlightCSS serves the stylesheet for highlighted code blocks.
+func (p *PostHanlder) HighlightCSS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write([]byte(markdown.CSS()))
+}
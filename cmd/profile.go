@@ -0,0 +1,243 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"forum/pkg/utils/validators"
+	"forum/pkg/views"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const profilePageSize = 10
+
+type profilePage struct {
+	User    models.User
+	Stats   models.UserStats
+	Trust   models.Reputation
+	IsOwner bool
+	// Auth is set for logged in viewers, who can follow or mute the user.
+	Auth        bool
+	FollowState string
+	IsBlocked   bool
+	Tab         string
+	Posts       []views.PostView
+	Comments    []models.Comment
+	Page        int
+	PrevPage    int
+	NextPage    int
+}
+
+type profileSettingsPage struct {
+	Avatar      string
+	DisplayName string
+	Bio         string
+	Error       string
+}
+
+type ProfileHandler struct {
+	Service *services.Service
+	posts   *PostHanlder
+}
+
+func NewProfileHandler(Service *services.Service) *ProfileHandler {
+	return &ProfileHandler{
+		Service: Service,
+		posts:   NewPostHandler(Service),
+	}
+}
+
+// Profile serves /u/{username}. The posts or comments of the user are shown
+// page by page depending on the tab query parameter.
+func (h *ProfileHandler) Profile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := strings.TrimPrefix(r.URL.Path, "/u/")
+	if username == "" || strings.Contains(username, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := h.Service.UserService.GetUserByUsername(username)
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything:
+			http.NotFound(w, r)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load profile", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if user.Username != username {
+		http.Redirect(w, r, "/u/"+user.Username, http.StatusMovedPermanently)
+		return
+	}
+
+	stats, err := h.Service.UserService.GetUserStats(user.ID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load profile", http.StatusInternalServerError)
+		return
+	}
+
+	trust, err := h.Service.ReputationService.GetTrust(user.ID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load profile", http.StatusInternalServerError)
+		return
+	}
+
+	viewer := getUserFromContext(r)
+
+	pageNum, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+
+	data := profilePage{
+		User:    user,
+		Stats:   stats,
+		Trust:   trust,
+		IsOwner: viewer.ID == user.ID,
+		Tab:     r.URL.Query().Get("tab"),
+		Page:    pageNum,
+	}
+
+	if (viewer != models.User{}) && !data.IsOwner {
+		data.Auth = true
+		data.FollowState, err = h.Service.FollowService.GetFollowState(viewer.ID, models.FollowUser, user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load profile", http.StatusInternalServerError)
+			return
+		}
+		data.IsBlocked, err = h.Service.MessageService.IsBlocked(viewer.ID, user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load profile", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	forumIDs, err := h.Service.ForumService.ReadableForumIDs(viewer.Role)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load profile", http.StatusInternalServerError)
+		return
+	}
+
+	var total int
+	start := (pageNum - 1) * profilePageSize
+
+	if data.Tab == "comments" {
+		data.Comments, total, err = h.Service.CommentService.GetCommentsPageByUID(user.ID, forumIDs, profilePageSize, start)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant fetch comments", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		data.Tab = "posts"
+
+		var posts []models.PostWithCats
+		posts, total, err = h.Service.PostService.GetPostsPageByUID(user.ID, forumIDs, profilePageSize, start)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant fetch posts", http.StatusInternalServerError)
+			return
+		}
+
+		data.Posts, err = h.posts.converterPOSTS(posts)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load views", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if pageNum > 1 {
+		data.PrevPage = pageNum - 1
+	}
+	if start+profilePageSize < total {
+		data.NextPage = pageNum + 1
+	}
+
+	renderPage(w, http.StatusOK, "./ui/templates/profile.html", data)
+}
+
+func (h *ProfileHandler) Settings(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if r.Method == http.MethodPost {
+		maxBytes := h.Service.UploadService.MaxBytes()
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+
+		err := r.ParseMultipartForm(maxBytes)
+		if err != nil && err != http.ErrNotMultipart {
+			http.Error(w, "Request is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		displayName := strings.TrimSpace(r.FormValue("displayName"))
+		bio := strings.TrimSpace(r.FormValue("bio"))
+		data := profileSettingsPage{Avatar: user.Avatar, DisplayName: displayName, Bio: bio}
+
+		if utf8.RuneCountInString(displayName) > 30 {
+			data.Error = "Display name must be at most 30 characters"
+		} else if validators.TextLengthValidate(bio, 1000) != nil {
+			data.Error = "Bio is too long"
+		}
+		if data.Error != "" {
+			renderPage(w, http.StatusBadRequest, "./ui/templates/profileSettings.html", data)
+			return
+		}
+
+		if r.MultipartForm != nil && len(r.MultipartForm.File["avatar"]) > 0 {
+			uploads, message, err := saveUploads(h.Service, user.ID, r.MultipartForm.File["avatar"][:1])
+			if err != nil {
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant save avatar", http.StatusInternalServerError)
+				return
+			}
+			if message != "" {
+				data.Error = message
+				renderPage(w, http.StatusBadRequest, "./ui/templates/profileSettings.html", data)
+				return
+			}
+
+			err = h.Service.UserService.UpdateAvatar(user.ID, uploads[0].ThumbURL())
+			if err != nil {
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant save avatar", http.StatusInternalServerError)
+				return
+			}
+
+			// The new avatar is saved, a leftover old one is only logged.
+			err = h.Service.UploadService.DeleteAvatar(user.ID, user.Avatar)
+			if err != nil {
+				logger.GetLogger().Error(err.Error())
+			}
+		}
+
+		err = h.Service.UserService.UpdateProfile(user.ID, displayName, bio)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant save profile", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/u/"+user.Username, http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		renderPage(w, http.StatusOK, "./ui/templates/profileSettings.html", profileSettingsPage{Avatar: user.Avatar, DisplayName: user.DisplayName, Bio: user.Bio})
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -43,13 +43,7 @@ func (h *ReactionHandler) ReactPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sign := r.FormValue("sign")
-
-	signint, err := strconv.Atoi(sign)
-	if err != nil {
-		http.Error(w, "sign convert error", http.StatusInternalServerError)
-		return
-	}
+	kind := r.FormValue("kind")
 
 	_, err = h.Service.PostService.GetPostByID(postint)
 	if err != nil {
@@ -57,12 +51,16 @@ func (h *ReactionHandler) ReactPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Service.ReactionService.SubmitReactionForPost(models.Reaction{SubjectID: postint, UID: user.ID, Sign: signint})
+	err = h.Service.ReactionService.SubmitReactionForPost(models.Reaction{SubjectID: postint, UID: user.ID, Kind: kind})
 
 	if err != nil {
 		switch err {
-		case models.SignIsMismatch:
-			http.Error(w, "Sign not correct", http.StatusBadRequest)
+		case models.ErrUnknownReaction:
+			http.Error(w, "Reaction not correct", http.StatusBadRequest)
+		case models.NotFoundAnything:
+			http.Error(w, "Not found", http.StatusNotFound)
+		case models.ErrForbidden:
+			http.Error(w, "Forbidden", http.StatusForbidden)
 		default:
 			http.Error(w, "Cant react", http.StatusInternalServerError)
 		}
@@ -104,13 +102,7 @@ func (h *ReactionHandler) ReactComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sign := r.FormValue("sign")
-
-	signint, err := strconv.Atoi(sign)
-	if err != nil {
-		http.Error(w, "sign convert error", http.StatusInternalServerError)
-		return
-	}
+	kind := r.FormValue("kind")
 
 	_, err = h.Service.PostService.GetPostByID(postint)
 	if err != nil {
@@ -118,12 +110,16 @@ func (h *ReactionHandler) ReactComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Service.ReactionService.SubmitReactionForComment(models.Reaction{SubjectID: comint, UID: user.ID, Sign: signint})
+	err = h.Service.ReactionService.SubmitReactionForComment(models.Reaction{SubjectID: comint, UID: user.ID, Kind: kind})
 
 	if err != nil {
 		switch err {
-		case models.SignIsMismatch:
-			http.Error(w, "Sign not correct", http.StatusBadRequest)
+		case models.ErrUnknownReaction:
+			http.Error(w, "Reaction not correct", http.StatusBadRequest)
+		case models.NotFoundAnything:
+			http.Error(w, "Not found", http.StatusNotFound)
+		case models.ErrForbidden:
+			http.Error(w, "Forbidden", http.StatusForbidden)
 		default:
 			http.Error(w, "Cant react", http.StatusInternalServerError)
 		}
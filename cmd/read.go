@@ -0,0 +1,69 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"forum/pkg/views"
+	"net/http"
+)
+
+type ReadHandler struct {
+	Service *services.Service
+}
+
+func NewReadHandler(Service *services.Service) *ReadHandler {
+	return &ReadHandler{
+		Service: Service,
+	}
+}
+
+// MarkCategoryRead marks every thread of the category with the slug in the
+// category field read and goes back to the category.
+func (h *ReadHandler) MarkCategoryRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	cat, err := h.Service.CategoryService.GetCategoryBySlug(r.FormValue("category"))
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything:
+			http.Error(w, "Category not found", http.StatusNotFound)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant mark as read", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := h.Service.ReadService.MarkCategoryRead(user.ID, cat.ID); err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant mark as read", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/c/"+cat.Slug, http.StatusSeeOther)
+}
+
+// viewIDs returns the IDs of posts, to look up their unread counts.
+func viewIDs(posts []views.PostView) []int {
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.Id
+	}
+	return ids
+}
+
+// markUnread copies the unread counts of ReadService.GetUnreadCounts onto
+// posts.
+func markUnread(posts []views.PostView, counts map[int]int) {
+	for i := range posts {
+		unread, ok := counts[posts[i].Id]
+		posts[i].Unread = unread
+		posts[i].Unseen = !ok
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"forum/pkg/utils/logger"
+	"html/template"
+	"net/http"
+)
+
+type notice struct {
+	Title   string
+	Message string
+}
+
+func renderPage(w http.ResponseWriter, status int, file string, data interface{}) {
+	tmpl, err := template.ParseFiles(file)
+	if err != nil {
+		http.Error(w, "Error parsing templates", 500)
+		return
+	}
+
+	w.WriteHeader(status)
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		logger.GetLogger().Warn(err.Error())
+		http.Error(w, "Error executing template", 500)
+		return
+	}
+}
+
+// serveScript serves a JavaScript file of ui/static.
+func serveScript(w http.ResponseWriter, r *http.Request, file string) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	http.ServeFile(w, r, file)
+}
+
+func renderNotice(w http.ResponseWriter, status int, title, message string) {
+	renderPage(w, status, "./ui/templates/notice.html", notice{Title: title, Message: message})
+}
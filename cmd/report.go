@@ -0,0 +1,171 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"forum/pkg/utils/validators"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type reportsPage struct {
+	Reports []models.Report
+}
+
+type ReportHandler struct {
+	Service *services.Service
+}
+
+func NewReportHandler(Service *services.Service) *ReportHandler {
+	return &ReportHandler{
+		Service: Service,
+	}
+}
+
+// Report files a report about a post, or one of its comments when commentID
+// is set.
+func (h *ReportHandler) Report(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	postID, err := strconv.Atoi(r.FormValue("postID"))
+	if err != nil {
+		http.Error(w, "Invalid post", http.StatusBadRequest)
+		return
+	}
+
+	var commentID int
+	if value := r.FormValue("commentID"); value != "" {
+		commentID, err = strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid comment", http.StatusBadRequest)
+			return
+		}
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if validators.NonBlankValidate(reason) != nil || validators.TextLengthValidate(reason, 500) != nil {
+		renderNotice(w, http.StatusBadRequest, "Report not sent", "Please tell us briefly what is wrong, in at most 500 characters.")
+		return
+	}
+
+	_, err = h.Service.ReportService.FileReport(models.Report{
+		ReporterUID: user.ID,
+		PostID:      postID,
+		CommentID:   commentID,
+		Reason:      reason,
+	})
+	if err != nil {
+		switch err {
+		case models.ErrAlreadyReported:
+			renderNotice(w, http.StatusConflict, "Already reported", "You have already reported this. The staff will look into it.")
+		case models.NotFoundAnything, models.ValueMismatch:
+			http.Error(w, "Not found", http.StatusNotFound)
+		case models.ErrForbidden:
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant send report", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	renderNotice(w, http.StatusOK, "Report sent", "Thank you. The staff will look into it.")
+}
+
+// Approve publishes a post, or one of its comments when commentID is set,
+// that was held for review, and notifies the users it mentions.
+func (h *ReportHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	postID, err := strconv.Atoi(r.FormValue("postID"))
+	if err != nil {
+		http.Error(w, "Invalid post", http.StatusBadRequest)
+		return
+	}
+
+	var commentID int
+	if value := r.FormValue("commentID"); value != "" {
+		commentID, err = strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid comment", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var authorID, content string
+	if commentID != 0 {
+		comment, err := h.Service.CommentService.ApproveComment(commentID)
+		if err != nil {
+			approveError(w, err)
+			return
+		}
+		postID, authorID, content = comment.PostID, comment.UID, comment.Content
+	} else {
+		post, err := h.Service.PostService.ApprovePost(postID)
+		if err != nil {
+			approveError(w, err)
+			return
+		}
+		authorID, content = post.UID, post.Content
+	}
+
+	// The content is live; mentions held back with it are only sent now.
+	author, err := h.Service.UserService.GetUserByID(authorID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+	} else if err := h.Service.MentionService.Record(author, postID, commentID, content); err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
+
+	http.Redirect(w, r, "/moderate/reports", http.StatusSeeOther)
+}
+
+func approveError(w http.ResponseWriter, err error) {
+	switch err {
+	case models.NotFoundAnything:
+		http.Error(w, "Nothing awaiting review", http.StatusNotFound)
+	default:
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant approve", http.StatusInternalServerError)
+	}
+}
+
+// Reports lists open reports for staff and dismisses them.
+func (h *ReportHandler) Reports(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid report", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.Service.ReportService.DismissReport(id); err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant dismiss report", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/moderate/reports", http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		reports, err := h.Service.ReportService.GetReports()
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load reports", http.StatusInternalServerError)
+			return
+		}
+
+		renderPage(w, http.StatusOK, "./ui/templates/reports.html", reportsPage{Reports: reports})
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"net/http"
+)
+
+type leaderboardPage struct {
+	Users        []models.Reputation
+	Requirements []models.TrustRequirement
+	Auth         bool
+	// Trust is the standing of the viewer, when logged in.
+	Trust models.Reputation
+}
+
+type ReputationHandler struct {
+	Service *services.Service
+}
+
+func NewReputationHandler(Service *services.Service) *ReputationHandler {
+	return &ReputationHandler{
+		Service: Service,
+	}
+}
+
+// Leaderboard serves /leaderboard, the users with the highest reputation and
+// what each trust level takes.
+func (h *ReputationHandler) Leaderboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	users, err := h.Service.ReputationService.Leaderboard()
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	data := leaderboardPage{Users: users, Requirements: models.TrustRequirements}
+
+	user := getUserFromContext(r)
+	if (user != models.User{}) {
+		data.Auth = true
+		data.Trust, err = h.Service.ReputationService.GetTrust(user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load leaderboard", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	renderPage(w, http.StatusOK, "./ui/templates/leaderboard.html", data)
+}
@@ -6,11 +6,32 @@ import (
 
 // InitializeRoutes sets up the application routes
 func (app *Application) InitializeRoutes() {
-	auth := NewAuthHandler(app.Service)
+	auth := NewAuthHandler(app.Service, app.Config.ProviderNames())
 	post := NewPostHandler(app.Service)
 	middle := NewMiddle(app.Service)
 	reaction := NewReactionHandler(app.Service)
 	comment := NewCommentHandler(app.Service)
+	category := NewCategoryHandler(app.Service)
+	forum := NewForumHandler(app.Service)
+	email := NewEmailHandler(app.Service)
+	password := NewPasswordHandler(app.Service)
+	twoFactor := NewTwoFactorHandler(app.Service)
+	profile := NewProfileHandler(app.Service)
+	upload := NewUploadHandler(app.Service)
+	oauthLogin := NewOAuthHandler(auth, app.Config.OAuthProviders, app.Config.Secret)
+	api := NewAPIHandler(app.Service)
+	notification := NewNotificationHandler(app.Service)
+	live := NewEventsHandler(app.Service)
+	report := NewReportHandler(app.Service)
+	webhook := NewWebhookHandler(app.Service)
+	feeds := NewFeedHandler(app.Service, app.Config.BaseURL)
+	digest := NewDigestHandler(app.Service)
+	bookmark := NewBookmarkHandler(app.Service)
+	follow := NewFollowHandler(app.Service)
+	message := NewMessageHandler(app.Service)
+	poll := NewPollHandler(app.Service)
+	reputation := NewReputationHandler(app.Service)
+	read := NewReadHandler(app.Service)
 	app.Router.Handle("/login", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(auth.Login))))))
 	app.Router.Handle("/register", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(auth.Registration))))))
 	app.Router.Handle("/", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(post.Index))))))
@@ -20,5 +41,61 @@ func (app *Application) InitializeRoutes() {
 	app.Router.Handle("/submitComment", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(comment.SubmitComment)))))))
 	app.Router.Handle("/logout", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(auth.Logout)))))))
 	app.Router.Handle("/reactComment", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(reaction.ReactComment)))))))
+	app.Router.Handle("/c/", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(category.Category))))))
+	app.Router.Handle("/admin/categories", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(middle.RequireAdmin(http.HandlerFunc(category.Admin))))))))
+	app.Router.Handle("/forums", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(forum.Forums))))))
+	app.Router.Handle("/f/", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(forum.Forum))))))
+	app.Router.Handle("/admin/forums", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(middle.RequireAdmin(http.HandlerFunc(forum.Admin))))))))
+	app.Router.Handle("/verify", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(email.Verify))))))
+	app.Router.Handle("/verify/resend", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(email.Resend)))))))
+	app.Router.Handle("/settings/email", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(email.ChangeEmail)))))))
+	app.Router.Handle("/password/forgot", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(password.Forgot))))))
+	app.Router.Handle("/password/reset", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(password.Reset))))))
+	app.Router.Handle("/settings/password", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(password.Change)))))))
+	app.Router.Handle("/login/2fa", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(auth.LoginTwoFactor))))))
+	app.Router.Handle("/settings/2fa", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(twoFactor.Settings)))))))
+	app.Router.Handle("/admin/security", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(middle.RequireAdmin(http.HandlerFunc(twoFactor.AdminSecurity))))))))
+	app.Router.Handle("/oauth/", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(oauthLogin.Handle))))))
+	app.Router.Handle("/u/", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(profile.Profile))))))
+	app.Router.Handle("/settings/profile", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(profile.Settings)))))))
+	app.Router.Handle("/uploads/", middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(upload.Serve)))))
+	app.Router.Handle("/preview", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(post.Preview)))))))
+	app.Router.Handle("/preview.js", middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(post.PreviewScript)))))
+	app.Router.Handle("/highlight.css", middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(post.HighlightCSS)))))
+	app.Router.Handle("/moderate/deletePost", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(middle.RequireStaff(http.HandlerFunc(post.DeletePost))))))))
+	app.Router.Handle("/moderate/deleteComment", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(middle.RequireStaff(http.HandlerFunc(comment.DeleteComment))))))))
+	app.Router.Handle("/notifications", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(notification.Notifications)))))))
+	app.Router.Handle("/settings/notifications", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(notification.Settings)))))))
+	app.Router.Handle("/notifications.js", middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(notification.Script)))))
+	app.Router.Handle("/api/notifications/unread", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(api.UnreadNotifications))))))
+	app.Router.Handle("/events/post/", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(live.Post))))))
+	app.Router.Handle("/events/user", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(live.User)))))))
+	app.Router.Handle("/report", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(report.Report)))))))
+	app.Router.Handle("/moderate/approve", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(middle.RequireStaff(http.HandlerFunc(report.Approve))))))))
+	app.Router.Handle("/moderate/reports", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(middle.RequireStaff(http.HandlerFunc(report.Reports))))))))
+	app.Router.Handle("/admin/webhooks", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(middle.RequireAdmin(http.HandlerFunc(webhook.Admin))))))))
+	app.Router.Handle("/admin/webhooks/", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(middle.RequireAdmin(http.HandlerFunc(webhook.Webhook))))))))
+	app.Router.Handle("/mentions.js", middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(api.MentionsScript)))))
+	app.Router.Handle("/api/users/suggest", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(api.UserSuggest)))))))
+	app.Router.Handle("/feed.atom", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(feeds.Site))))))
+	app.Router.Handle("/feed.rss", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(feeds.Site))))))
+	app.Router.Handle("/feed/", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(feeds.Feed))))))
+	app.Router.Handle("/settings/digest", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(digest.Settings)))))))
+	app.Router.Handle("/digest/unsubscribe", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(digest.Unsubscribe))))))
+	app.Router.Handle("/bookmark", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(bookmark.Toggle)))))))
+	app.Router.Handle("/bookmarks", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(bookmark.Bookmarks)))))))
+	app.Router.Handle("/api/bookmarks", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(api.Bookmarks))))))
+	app.Router.Handle("/follow", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(follow.Follow)))))))
+	app.Router.Handle("/feed", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(follow.Feed)))))))
+	app.Router.Handle("/messages", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(message.Inbox)))))))
+	app.Router.Handle("/messages/new", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(message.New)))))))
+	app.Router.Handle("/messages/report", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(message.Report)))))))
+	app.Router.Handle("/messages/", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(message.Conversation)))))))
+	app.Router.Handle("/settings/blocks", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(message.Blocks)))))))
+	app.Router.Handle("/moderate/messages", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(middle.RequireStaff(http.HandlerFunc(message.Reports))))))))
+	app.Router.Handle("/poll/vote", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(poll.Vote)))))))
+	app.Router.Handle("/api/polls/", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(api.Poll))))))
+	app.Router.Handle("/leaderboard", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(http.HandlerFunc(reputation.Leaderboard))))))
+	app.Router.Handle("/markRead", middle.Authenticate(middle.LogRequest(middle.RecoverPanic(middle.SecureHeaders(middle.RequireAuthentication(http.HandlerFunc(read.MarkCategoryRead)))))))
 	app.Logger.Info("routs")
 }
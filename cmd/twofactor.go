@@ -0,0 +1,200 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"forum/pkg/utils/totp"
+	"html/template"
+	"net/http"
+)
+
+const twoFactorIssuer = "Forum"
+
+type twoFactorPage struct {
+	Enabled   bool
+	Required  bool
+	Secret    string
+	URI       template.URL
+	Codes     []string
+	Remaining int
+	Error     string
+}
+
+type adminSecurityPage struct {
+	RequireStaffTwoFactor bool
+}
+
+type TwoFactorHandler struct {
+	Service *services.Service
+}
+
+func NewTwoFactorHandler(Service *services.Service) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		Service: Service,
+	}
+}
+
+func (h *TwoFactorHandler) Settings(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	required, err := h.requiredFor(user)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load settings", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		code := r.FormValue("code")
+
+		switch r.FormValue("action") {
+		case "enable":
+			codes, err := h.Service.TwoFactorService.Enable(user.ID, code)
+			if err != nil {
+				switch err {
+				case models.ErrInvalidTwoFactorCode, models.ErrTwoFactorNotEnrolled:
+					h.renderEnrollment(w, http.StatusBadRequest, user, required, "Invalid code")
+				default:
+					logger.GetLogger().Error(err.Error())
+					http.Error(w, "Cant enable 2FA", http.StatusInternalServerError)
+				}
+				return
+			}
+			renderPage(w, http.StatusOK, "./ui/templates/twoFactor.html", twoFactorPage{Enabled: true, Required: required, Codes: codes, Remaining: len(codes)})
+		case "regenerate":
+			if !h.checkCode(w, user, required, code) {
+				return
+			}
+			codes, err := h.Service.TwoFactorService.RegenerateRecoveryCodes(user.ID)
+			if err != nil {
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant generate codes", http.StatusInternalServerError)
+				return
+			}
+			renderPage(w, http.StatusOK, "./ui/templates/twoFactor.html", twoFactorPage{Enabled: true, Required: required, Codes: codes, Remaining: len(codes)})
+		case "disable":
+			if required {
+				h.renderEnabled(w, http.StatusForbidden, user, required, "Your role requires two-factor authentication")
+				return
+			}
+			if _, err := h.Service.UserService.AuthenticateUser(user.Username, r.FormValue("password")); err != nil {
+				h.renderEnabled(w, http.StatusBadRequest, user, required, "Wrong password")
+				return
+			}
+			if !h.checkCode(w, user, required, code) {
+				return
+			}
+			err := h.Service.TwoFactorService.Disable(user.ID)
+			if err != nil {
+				logger.GetLogger().Error(err.Error())
+				http.Error(w, "Cant disable 2FA", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "/settings/2fa", http.StatusSeeOther)
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+		}
+	} else if r.Method == http.MethodGet {
+		if user.TOTPEnabled {
+			h.renderEnabled(w, http.StatusOK, user, required, "")
+		} else {
+			h.renderEnrollment(w, http.StatusOK, user, required, "")
+		}
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *TwoFactorHandler) AdminSecurity(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = h.Service.SettingsService.SetBool(services.SettingRequireStaffTwoFactor, r.FormValue("require_staff_2fa") == "on")
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant save settings", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/admin/security", http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		required, err := h.Service.SettingsService.GetBool(services.SettingRequireStaffTwoFactor)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load settings", http.StatusInternalServerError)
+			return
+		}
+
+		renderPage(w, http.StatusOK, "./ui/templates/adminSecurity.html", adminSecurityPage{RequireStaffTwoFactor: required})
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *TwoFactorHandler) requiredFor(user models.User) (bool, error) {
+	if !user.IsStaff() {
+		return false, nil
+	}
+	return h.Service.SettingsService.GetBool(services.SettingRequireStaffTwoFactor)
+}
+
+func (h *TwoFactorHandler) checkCode(w http.ResponseWriter, user models.User, required bool, code string) bool {
+	err := h.Service.TwoFactorService.VerifyCode(user.ID, code)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidTwoFactorCode, models.ErrTwoFactorNotEnrolled:
+			h.renderEnabled(w, http.StatusBadRequest, user, required, "Invalid code")
+		case models.ErrRateLimited:
+			h.renderEnabled(w, http.StatusTooManyRequests, user, required, "Too many wrong codes. Please try again later.")
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant check code", http.StatusInternalServerError)
+		}
+		return false
+	}
+	return true
+}
+
+// renderEnrollment shows the pending secret of user, starting a new
+// enrollment when there is none.
+func (h *TwoFactorHandler) renderEnrollment(w http.ResponseWriter, status int, user models.User, required bool, message string) {
+	secret := user.TOTPSecret
+	if secret == "" {
+		var err error
+		secret, err = h.Service.TwoFactorService.BeginEnrollment(user.ID)
+		if err != nil {
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant start enrollment", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	renderPage(w, status, "./ui/templates/twoFactor.html", twoFactorPage{
+		Required: required,
+		Secret:   secret,
+		URI:      template.URL(totp.URI(twoFactorIssuer, user.Username, secret)),
+		Error:    message,
+	})
+}
+
+func (h *TwoFactorHandler) renderEnabled(w http.ResponseWriter, status int, user models.User, required bool, message string) {
+	remaining, err := h.Service.TwoFactorService.RemainingRecoveryCodes(user.ID)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	renderPage(w, status, "./ui/templates/twoFactor.html", twoFactorPage{Enabled: true, Required: required, Remaining: remaining, Error: message})
+}
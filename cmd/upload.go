@@ -0,0 +1,93 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// maxPostImages is how many images can be attached to one post.
+const maxPostImages = 4
+
+type UploadHandler struct {
+	Service *services.Service
+}
+
+func NewUploadHandler(Service *services.Service) *UploadHandler {
+	return &UploadHandler{
+		Service: Service,
+	}
+}
+
+// Serve serves /uploads/{name}. Names are random and files never change, so
+// they can be cached forever.
+func (h *UploadHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/uploads/")
+
+	file, contentType, err := h.Service.UploadService.Open(name)
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything:
+			http.NotFound(w, r)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant open file", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, name, file.ModTime(), file)
+}
+
+// saveUploads stores the images in files for user. On failure nothing is
+// kept and the returned message explains the problem to the user, unless it
+// is an internal error.
+func saveUploads(service *services.Service, uid string, files []*multipart.FileHeader) ([]models.Upload, string, error) {
+	var uploads []models.Upload
+
+	discard := func() {
+		for _, upload := range uploads {
+			if err := service.UploadService.DeleteUpload(upload); err != nil {
+				logger.GetLogger().Error(err.Error())
+			}
+		}
+	}
+
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			discard()
+			return nil, "", err
+		}
+
+		upload, err := service.UploadService.Save(uid, file)
+		file.Close()
+		if err != nil {
+			discard()
+			switch err {
+			case models.ErrUploadTooLarge:
+				return nil, header.Filename + " is too large", nil
+			case models.ErrUnsupportedUpload:
+				return nil, header.Filename + " is not a JPEG, PNG, GIF or WebP image", nil
+			default:
+				return nil, "", err
+			}
+		}
+
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, "", nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/services"
+	"forum/pkg/utils/logger"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type adminWebhooksPage struct {
+	Webhooks []models.Webhook
+	Events   []string
+	Error    string
+}
+
+type adminWebhookPage struct {
+	Webhook    models.Webhook
+	Events     []string
+	Deliveries []models.WebhookDelivery
+	Error      string
+}
+
+type WebhookHandler struct {
+	Service *services.Service
+}
+
+func NewWebhookHandler(Service *services.Service) *WebhookHandler {
+	return &WebhookHandler{
+		Service: Service,
+	}
+}
+
+// Admin serves /admin/webhooks, listing the webhooks and creating new ones.
+func (h *WebhookHandler) Admin(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+
+		id, err := h.Service.WebhookService.CreateWebhook(strings.TrimSpace(r.FormValue("url")), r.PostForm["events"])
+		if err != nil {
+			if err == models.ValueMismatch {
+				h.renderAdmin(w, http.StatusBadRequest, "Enter an http or https URL and pick at least one event")
+				return
+			}
+			logger.GetLogger().Error(err.Error())
+			h.renderAdmin(w, http.StatusInternalServerError, models.ErrUnknown.Error())
+			return
+		}
+
+		http.Redirect(w, r, "/admin/webhooks/"+strconv.Itoa(id), http.StatusSeeOther)
+	} else if r.Method == http.MethodGet {
+		h.renderAdmin(w, http.StatusOK, "")
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Webhook serves /admin/webhooks/{id} with the settings and the delivery log
+// of one webhook.
+func (h *WebhookHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/admin/webhooks/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+
+		redirect := "/admin/webhooks/" + strconv.Itoa(id)
+
+		switch r.FormValue("action") {
+		case "update":
+			err = h.Service.WebhookService.UpdateWebhook(id, strings.TrimSpace(r.FormValue("url")), r.PostForm["events"], r.FormValue("active") != "")
+		case "delete":
+			err = h.Service.WebhookService.DeleteWebhook(id)
+			redirect = "/admin/webhooks"
+		case "test":
+			err = h.Service.WebhookService.SendTest(id)
+		case "redeliver":
+			deliveryID, convErr := strconv.Atoi(r.FormValue("delivery"))
+			if convErr != nil {
+				err = models.ValueMismatch
+				break
+			}
+			err = h.Service.WebhookService.Redeliver(deliveryID)
+		default:
+			err = models.ValueMismatch
+		}
+
+		switch err {
+		case nil:
+			http.Redirect(w, r, redirect, http.StatusSeeOther)
+		case models.NotFoundAnything:
+			http.NotFound(w, r)
+		case models.ValueMismatch:
+			h.renderWebhook(w, r, id, http.StatusBadRequest, "Enter an http or https URL and pick at least one event")
+		default:
+			logger.GetLogger().Error(err.Error())
+			h.renderWebhook(w, r, id, http.StatusInternalServerError, models.ErrUnknown.Error())
+		}
+	} else if r.Method == http.MethodGet {
+		h.renderWebhook(w, r, id, http.StatusOK, "")
+	} else {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *WebhookHandler) renderAdmin(w http.ResponseWriter, status int, message string) {
+	hooks, err := h.Service.WebhookService.GetWebhooks()
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	renderPage(w, status, "./ui/templates/adminWebhooks.html", adminWebhooksPage{
+		Webhooks: hooks,
+		Events:   models.WebhookEvents,
+		Error:    message,
+	})
+}
+
+func (h *WebhookHandler) renderWebhook(w http.ResponseWriter, r *http.Request, id int, status int, message string) {
+	hook, err := h.Service.WebhookService.GetWebhookByID(id)
+	if err != nil {
+		switch err {
+		case models.NotFoundAnything:
+			http.NotFound(w, r)
+		default:
+			logger.GetLogger().Error(err.Error())
+			http.Error(w, "Cant load webhook", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	deliveries, err := h.Service.WebhookService.GetDeliveries(id)
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+		http.Error(w, "Cant load deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	renderPage(w, status, "./ui/templates/adminWebhook.html", adminWebhookPage{
+		Webhook:    hook,
+		Events:     models.WebhookEvents,
+		Deliveries: deliveries,
+		Error:      message,
+	})
+}
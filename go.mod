@@ -8,3 +8,17 @@ require (
 )
 
 require github.com/mattn/go-sqlite3 v1.14.18
+
+require (
+	github.com/alecthomas/chroma/v2 v2.10.0
+	github.com/microcosm-cc/bluemonday v1.0.25
+	github.com/yuin/goldmark v1.5.6
+	golang.org/x/image v0.12.0
+)
+
+require (
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/dlclark/regexp2 v1.10.0 // indirect
+	github.com/gorilla/css v1.0.0 // indirect
+	golang.org/x/net v0.12.0 // indirect
+)
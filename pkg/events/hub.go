@@ -0,0 +1,204 @@
+// Package events is an in-process publish/subscribe hub used to push live
+// updates to browsers over Server-Sent Events.
+package events
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// backlogSize is how many recent events are kept per topic so that
+	// reconnecting clients can resume with Last-Event-ID.
+	backlogSize = 100
+	// bufferSize is how many events may wait for a slow subscriber before
+	// it is dropped.
+	bufferSize = 32
+	// idleTopicTTL is how long the backlog of a topic without subscribers
+	// and new events is kept.
+	idleTopicTTL = 10 * time.Minute
+	// sweepInterval is how often Publish and Subscribe look for idle
+	// topics at most.
+	sweepInterval = time.Minute
+)
+
+// Event is a message published on a topic. IDs grow across all topics.
+type Event struct {
+	ID   uint64
+	Type string
+	Data []byte
+}
+
+// Subscription receives the events of one topic. C is closed when the
+// subscription ends, either by Unsubscribe or because the subscriber fell
+// behind.
+type Subscription struct {
+	C     <-chan Event
+	c     chan Event
+	topic string
+}
+
+type topic struct {
+	subs    map[*Subscription]struct{}
+	backlog []Event
+	// evicted is the ID of the newest event of the topic that is not kept
+	// anymore.
+	evicted    uint64
+	lastActive time.Time
+}
+
+type Hub struct {
+	mu     sync.Mutex
+	lastID uint64
+	topics map[string]*topic
+	// swept is the ID of the newest event of a forgotten topic. Topics
+	// created again cannot tell whether it was theirs.
+	swept     uint64
+	lastSweep time.Time
+}
+
+func NewHub() *Hub {
+	return &Hub{topics: make(map[string]*topic)}
+}
+
+// PostTopic is the topic of the live updates of a post.
+func PostTopic(postID int) string {
+	return "post:" + strconv.Itoa(postID)
+}
+
+// UserTopic is the topic of the live updates of a user.
+func UserTopic(uid string) string {
+	return "user:" + uid
+}
+
+// Publish sends data encoded as JSON to the subscribers of name. A nil hub
+// drops the event, so services work without live updates.
+func (h *Hub) Publish(name, eventType string, data interface{}) error {
+	if h == nil {
+		return nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Topics are created by publishing too, so they are swept here as well
+	// as in Subscribe to stay bounded when nobody is listening.
+	h.sweep()
+
+	h.lastID++
+	event := Event{ID: h.lastID, Type: eventType, Data: payload}
+
+	t := h.topic(name)
+	if len(t.backlog) == backlogSize {
+		t.evicted = t.backlog[0].ID
+		t.backlog = append(t.backlog[:0], t.backlog[1:]...)
+	}
+	t.backlog = append(t.backlog, event)
+	t.lastActive = time.Now()
+
+	for sub := range t.subs {
+		select {
+		case sub.c <- event:
+		default:
+			// The subscriber is too slow. Dropping it keeps publishers from
+			// blocking; the client reconnects and resumes from the backlog.
+			h.remove(t, sub)
+		}
+	}
+
+	return nil
+}
+
+// LastID returns the ID of the newest event. Pages pass it to their first
+// connection so that nothing published while the page loads is missed.
+func (h *Hub) LastID() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastID
+}
+
+// Subscribe starts receiving the events of name. When lastID is not 0 the
+// events published after it are replayed first; ok is false when some of them
+// are no longer kept and the client has to reload instead.
+func (h *Hub) Subscribe(name string, lastID uint64) (sub *Subscription, replay []Event, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sweep()
+	t := h.topic(name)
+
+	ok = true
+	if lastID != 0 {
+		if lastID < t.evicted || lastID > h.lastID {
+			ok = false
+		}
+		for _, event := range t.backlog {
+			if event.ID > lastID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	c := make(chan Event, bufferSize)
+	sub = &Subscription{C: c, c: c, topic: name}
+	t.subs[sub] = struct{}{}
+
+	return sub, replay, ok
+}
+
+// Unsubscribe ends sub. It is safe to call more than once.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if t, ok := h.topics[sub.topic]; ok {
+		h.remove(t, sub)
+	}
+}
+
+func (h *Hub) topic(name string) *topic {
+	t, ok := h.topics[name]
+	if !ok {
+		t = &topic{subs: make(map[*Subscription]struct{}), evicted: h.swept, lastActive: time.Now()}
+		h.topics[name] = t
+	}
+	return t
+}
+
+// sweep forgets topics without subscribers or events for idleTopicTTL, at
+// most once every sweepInterval. It must be called with h.mu held.
+func (h *Hub) sweep() {
+	if time.Since(h.lastSweep) < sweepInterval {
+		return
+	}
+	h.lastSweep = time.Now()
+
+	for name, t := range h.topics {
+		if len(t.subs) > 0 || time.Since(t.lastActive) <= idleTopicTTL {
+			continue
+		}
+		if n := len(t.backlog); n > 0 && t.backlog[n-1].ID > h.swept {
+			h.swept = t.backlog[n-1].ID
+		}
+		delete(h.topics, name)
+	}
+}
+
+// remove must be called with h.mu held.
+func (h *Hub) remove(t *topic, sub *Subscription) {
+	if _, ok := t.subs[sub]; !ok {
+		return
+	}
+	delete(t.subs, sub)
+	close(sub.c)
+	if len(t.subs) == 0 {
+		t.lastActive = time.Now()
+	}
+}
@@ -0,0 +1,34 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishSweepsIdleTopics(t *testing.T) {
+	h := NewHub()
+	for i := 1; i <= 3; i++ {
+		if err := h.Publish(PostTopic(i), "comment", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nobody subscribed; make the topics idle and the sweep due.
+	for _, topic := range h.topics {
+		topic.lastActive = time.Now().Add(-idleTopicTTL - time.Second)
+	}
+	h.lastSweep = time.Time{}
+
+	if err := h.Publish(PostTopic(4), "comment", 4); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.topics) != 1 {
+		t.Fatalf("%d topics kept, want 1", len(h.topics))
+	}
+
+	// Clients of a forgotten topic are told to reload.
+	_, _, ok := h.Subscribe(PostTopic(1), 1)
+	if ok {
+		t.Fatal("resuming a forgotten topic succeeded")
+	}
+}
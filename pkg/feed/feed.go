@@ -0,0 +1,204 @@
+// Package feed writes Atom and RSS documents for the forum. Entry content
+// must already be sanitized HTML; it is escaped into the XML and its relative
+// links are made absolute so that feed readers can follow them.
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+type Feed struct {
+	Title       string
+	Description string
+	// Link is the page the feed mirrors and Self the URL of the feed, both
+	// absolute.
+	Link string
+	Self string
+	// Created is when the subject of the feed appeared; it stands in for the
+	// update time while the feed has no entries.
+	Created time.Time
+	Entries []Entry
+}
+
+type Entry struct {
+	Title     string
+	Link      string
+	Author    string
+	Published time.Time
+	Updated   time.Time
+	// HTML is the sanitized body with links relative to the site root.
+	HTML string
+}
+
+// Updated is the newest update of any entry, or Created for an empty feed.
+func (f Feed) Updated() time.Time {
+	updated := f.Created
+	for _, e := range f.Entries {
+		if e.Updated.After(updated) {
+			updated = e.Updated
+		}
+	}
+	return updated.UTC()
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    *atomAuthor `xml:"author,omitempty"`
+	Content   atomText    `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+// Atom encodes f as an Atom 1.0 document.
+func (f Feed) Atom() ([]byte, error) {
+	doc := atomFeed{
+		Title:    f.Title,
+		Subtitle: f.Description,
+		ID:       f.Self,
+		Updated:  f.Updated().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.Self},
+			{Rel: "alternate", Type: "text/html", Href: f.Link},
+		},
+	}
+
+	for _, e := range f.Entries {
+		entry := atomEntry{
+			Title:     e.Title,
+			ID:        e.Link,
+			Link:      atomLink{Rel: "alternate", Type: "text/html", Href: e.Link},
+			Published: e.Published.UTC().Format(time.RFC3339),
+			Updated:   e.Updated.UTC().Format(time.RFC3339),
+			Content:   atomText{Type: "html", Body: absolutize(e.HTML, siteRoot(f.Link))},
+		}
+		if e.Author != "" {
+			entry.Author = &atomAuthor{Name: e.Author}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return encode(doc)
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Creator     string  `xml:"dc:creator,omitempty"`
+	Description string  `xml:"description"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// RSS encodes f as an RSS 2.0 document.
+func (f Feed) RSS() ([]byte, error) {
+	description := f.Description
+	if description == "" {
+		description = f.Title
+	}
+
+	doc := rssFeed{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   description,
+			LastBuildDate: f.Updated().Format(time.RFC1123Z),
+			Self:          atomLink{Rel: "self", Type: "application/rss+xml", Href: f.Self},
+		},
+	}
+
+	for _, e := range f.Entries {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       e.Title,
+			Link:        e.Link,
+			GUID:        rssGUID{IsPermaLink: "true", Value: e.Link},
+			PubDate:     e.Published.UTC().Format(time.RFC1123Z),
+			Creator:     e.Author,
+			Description: absolutize(e.HTML, siteRoot(f.Link)),
+		})
+	}
+
+	return encode(doc)
+}
+
+func encode(doc interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// siteRoot returns the scheme and host of an absolute URL.
+func siteRoot(link string) string {
+	if i := strings.Index(link, "://"); i >= 0 {
+		if j := strings.Index(link[i+3:], "/"); j >= 0 {
+			return link[:i+3+j]
+		}
+	}
+	return link
+}
+
+// absolutize prefixes root-relative href and src attributes with root. The
+// sanitizer always writes attributes in double quotes.
+func absolutize(html, root string) string {
+	html = strings.ReplaceAll(html, `href="/`, `href="`+root+`/`)
+	html = strings.ReplaceAll(html, `src="/`, `src="`+root+`/`)
+	// Protocol-relative URLs were turned into root-relative ones above.
+	html = strings.ReplaceAll(html, `href="`+root+`//`, `href="//`)
+	html = strings.ReplaceAll(html, `src="`+root+`//`, `src="//`)
+	return html
+}
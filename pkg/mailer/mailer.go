@@ -0,0 +1,18 @@
+package mailer
+
+// Message is a single outgoing email. HTML is optional; when set the message
+// is sent as multipart/alternative with Text as the plain part.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers are added to the message as they are, for instance
+	// List-Unsubscribe.
+	Headers map[string]string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileOutbox writes every message as an .eml file into Dir instead of
+// delivering it. Meant for local development.
+type FileOutbox struct {
+	Dir  string
+	From string
+	mu   sync.Mutex
+	seq  int
+}
+
+func NewFileOutbox(dir, from string) *FileOutbox {
+	return &FileOutbox{Dir: dir, From: from}
+}
+
+func (o *FileOutbox) Send(msg Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := os.MkdirAll(o.Dir, 0755); err != nil {
+		return err
+	}
+
+	o.seq++
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%03d-%s.eml", time.Now().Format("20060102-150405"), o.seq, recipient)
+
+	return os.WriteFile(filepath.Join(o.Dir, name), Build(o.From, msg), 0644)
+}
+
+// MemoryOutbox keeps sent messages in memory.
+type MemoryOutbox struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+func (o *MemoryOutbox) Send(msg Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of everything sent so far.
+func (o *MemoryOutbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]Message(nil), o.messages...)
+}
@@ -0,0 +1,77 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMTPMailer sends messages through an SMTP relay.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTPMailer(addr, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		Addr:     addr,
+		Username: username,
+		Password: password,
+		From:     from,
+	}
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, Build(m.From, msg))
+}
+
+// Build renders msg as an RFC 5322 message.
+func Build(from string, msg Message) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+
+	names := make([]string, 0, len(msg.Headers))
+	for name := range msg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, msg.Headers[name])
+	}
+
+	if msg.HTML == "" {
+		fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		buf.WriteString(msg.Text)
+		return buf.Bytes()
+	}
+
+	boundary := uuid.New().String()
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&buf, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", boundary, msg.Text)
+	fmt.Fprintf(&buf, "--%s\r\nContent-Type: text/html; charset=utf-8\r\n\r\n%s\r\n", boundary, msg.HTML)
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes()
+}
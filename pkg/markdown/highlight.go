@@ -0,0 +1,87 @@
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// highlightStyle colors the classes written by the highlighter, see CSS.
+const highlightStyle = "github"
+
+var formatter = chromahtml.New(
+	chromahtml.WithClasses(true),
+	chromahtml.WithLineNumbers(true),
+	// Numbers live in their own table cell so selecting the code does not
+	// copy them.
+	chromahtml.LineNumbersInTable(true),
+)
+
+// CSS returns the stylesheet for highlighted code blocks.
+func CSS() string {
+	var buf bytes.Buffer
+	if err := formatter.WriteCSS(&buf, styles.Get(highlightStyle)); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// highlighter renders fenced code blocks with a known language tag as
+// highlighted HTML, followed by a collapsed plain copy of the code. Other code
+// blocks are rendered like goldmark does.
+type highlighter struct{}
+
+func (h highlighter) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, h.renderFencedCodeBlock)
+}
+
+func (h highlighter) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.FencedCodeBlock)
+
+	var code strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+
+	language := string(n.Language(source))
+	var lexer chroma.Lexer
+	if language != "" {
+		lexer = lexers.Get(language)
+	}
+
+	if lexer == nil {
+		w.WriteString("<pre><code")
+		if language != "" {
+			w.WriteString(` class="language-` + html.EscapeString(language) + `"`)
+		}
+		w.WriteString(">" + html.EscapeString(code.String()) + "</code></pre>\n")
+		return ast.WalkSkipChildren, nil
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code.String())
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	w.WriteString(`<div class="code-block">`)
+	if err := formatter.Format(w, styles.Get(highlightStyle), iterator); err != nil {
+		return ast.WalkStop, err
+	}
+	w.WriteString("<details><summary>Plain text</summary><pre><code>" + html.EscapeString(code.String()) + "</code></pre></details></div>\n")
+
+	return ast.WalkSkipChildren, nil
+}
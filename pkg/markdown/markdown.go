@@ -0,0 +1,84 @@
+// Package markdown turns user written Markdown into HTML that is safe to
+// embed in pages.
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// Version identifies the output of Render. Bump it whenever the rendering
+// changes so HTML cached in the database is rebuilt.
+const Version = 3
+
+var (
+	converter = goldmark.New(
+		goldmark.WithExtensions(
+			extension.Table,
+			extension.Strikethrough,
+			extension.Linkify,
+			extension.TaskList,
+		),
+		goldmark.WithParserOptions(
+			parser.WithInlineParsers(util.Prioritized(mentionParser{}, 500)),
+		),
+		goldmark.WithRendererOptions(
+			html.WithHardWraps(),
+			renderer.WithNodeRenderers(
+				util.Prioritized(highlighter{}, 100),
+				util.Prioritized(mentionRenderer{}, 100),
+			),
+		),
+	)
+
+	policy = newPolicy()
+)
+
+// Render converts CommonMark with tables, autolinks and fenced code to
+// sanitized HTML, highlighting code blocks tagged with a language and linking
+// @username mentions to profiles. Raw HTML in src is dropped.
+func Render(src string) string {
+	var buf bytes.Buffer
+	if err := converter.Convert([]byte(src), &buf); err != nil {
+		return policy.Sanitize(src)
+	}
+	return policy.Sanitize(buf.String())
+}
+
+// newPolicy allows the elements goldmark produces and nothing else.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowElements("p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6",
+		"blockquote", "pre", "code", "em", "strong", "del",
+		"ul", "ol", "li", "table", "thead", "tbody", "tr", "th", "td")
+
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^mention$`)).OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowRelativeURLs(true)
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	p.AllowAttrs("src", "alt", "title").OnElements("img")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("align").Matching(bluemonday.CellAlign).OnElements("th", "td")
+	p.AllowStyles("text-align").MatchingEnum("left", "right", "center").OnElements("th", "td")
+	p.AllowAttrs("class").Matching(bluemonday.SpaceSeparatedTokens).OnElements("code")
+
+	// Highlighted code blocks.
+	p.AllowElements("div", "span", "details", "summary")
+	p.AllowAttrs("class").Matching(bluemonday.SpaceSeparatedTokens).OnElements("div", "span", "pre", "table", "td")
+	p.AllowAttrs("type", "checked", "disabled").OnElements("input")
+
+	return p
+}
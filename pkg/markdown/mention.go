@@ -0,0 +1,103 @@
+package markdown
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindMention is the node kind of @username mentions.
+var KindMention = ast.NewNodeKind("Mention")
+
+// Mention is an @username reference to another user.
+type Mention struct {
+	ast.BaseInline
+	Username string
+}
+
+func (n *Mention) Kind() ast.NodeKind {
+	return KindMention
+}
+
+func (n *Mention) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Username": n.Username}, nil)
+}
+
+// Mentions returns the distinct usernames mentioned in src, in order of
+// appearance. Mentions inside code are ignored.
+func Mentions(src string) []string {
+	source := []byte(src)
+	doc := converter.Parser().Parse(text.NewReader(source))
+
+	var names []string
+	seen := make(map[string]bool)
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if mention, ok := node.(*Mention); ok && entering {
+			key := strings.ToLower(mention.Username)
+			if !seen[key] {
+				seen[key] = true
+				names = append(names, mention.Username)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	return names
+}
+
+// mentionParser recognizes @username where username is 2 to 10 letters,
+// digits, dots, dashes or underscores not preceded by a word character, so
+// email addresses are left alone.
+type mentionParser struct{}
+
+func (p mentionParser) Trigger() []byte {
+	return []byte{'@'}
+}
+
+func (p mentionParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if prev := block.PrecendingCharacter(); unicode.IsLetter(prev) || unicode.IsDigit(prev) || prev == '_' {
+		return nil
+	}
+
+	line, _ := block.PeekLine()
+	end := 1
+	for end < len(line) && isMentionChar(line[end]) {
+		end++
+	}
+	// A trailing dot ends the sentence rather than the name.
+	for end > 1 && line[end-1] == '.' {
+		end--
+	}
+
+	name := line[1:end]
+	if len(name) < 2 || len(name) > 10 || bytes.IndexByte(name, '@') >= 0 {
+		return nil
+	}
+
+	block.Advance(end)
+	return &Mention{Username: string(name)}
+}
+
+func isMentionChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.'
+}
+
+type mentionRenderer struct{}
+
+func (r mentionRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindMention, r.renderMention)
+}
+
+func (r mentionRenderer) renderMention(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		name := node.(*Mention).Username
+		w.WriteString(`<a href="/u/` + name + `" class="mention">@` + name + `</a>`)
+	}
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,20 @@
+-- Adds bookmarks. Run once on databases created before bookmarks:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/bookmarks.sql
+BEGIN TRANSACTION;
+
+CREATE TABLE bookmarks (
+                           id INTEGER PRIMARY KEY AUTOINCREMENT,
+                           uid VARCHAR,
+                           post_id INTEGER,
+                           comment_id INTEGER,
+                           folder VARCHAR DEFAULT '',
+                           note TEXT DEFAULT '',
+                           created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                           FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                           FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+                           FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX bookmarks_subject_idx ON bookmarks (uid, post_id, COALESCE(comment_id, 0));
+
+COMMIT;
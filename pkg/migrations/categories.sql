@@ -0,0 +1,18 @@
+-- Adds user roles and the slug, description, color and order of categories.
+-- Existing categories get the slug category-<id>. Run once on databases
+-- created before category administration:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/categories.sql
+BEGIN TRANSACTION;
+
+ALTER TABLE users ADD COLUMN role VARCHAR DEFAULT 'user';
+
+ALTER TABLE categories ADD COLUMN slug VARCHAR;
+ALTER TABLE categories ADD COLUMN description VARCHAR DEFAULT '';
+ALTER TABLE categories ADD COLUMN color VARCHAR DEFAULT '#888888';
+ALTER TABLE categories ADD COLUMN sort_order INTEGER DEFAULT 0;
+
+UPDATE categories SET slug = 'category-' || id, sort_order = id;
+
+CREATE UNIQUE INDEX categories_slug_idx ON categories (slug);
+
+COMMIT;
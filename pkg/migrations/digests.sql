@@ -0,0 +1,29 @@
+-- Adds email digest subscriptions. Run once on databases created before
+-- digests:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/digests.sql
+BEGIN TRANSACTION;
+
+CREATE TABLE digest_subscriptions (
+                                      uid VARCHAR PRIMARY KEY,
+                                      frequency VARCHAR NOT NULL,
+                                      last_sent_at DATETIME,
+                                      FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE digest_categories (
+                                   uid VARCHAR,
+                                   category_id INTEGER,
+                                   PRIMARY KEY (uid, category_id),
+                                   FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                                   FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+CREATE TABLE digest_deliveries (
+                                   uid VARCHAR,
+                                   period VARCHAR,
+                                   created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                                   PRIMARY KEY (uid, period),
+                                   FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+COMMIT;
@@ -0,0 +1,24 @@
+-- Adds follows and the last visit of the feed. Run once on databases
+-- created before following:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/follows.sql
+BEGIN TRANSACTION;
+
+CREATE TABLE follows (
+                         uid VARCHAR,
+                         kind VARCHAR,
+                         target_id VARCHAR,
+                         state VARCHAR DEFAULT 'follow',
+                         created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                         PRIMARY KEY (uid, kind, target_id),
+                         FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX follows_target_idx ON follows (kind, target_id, state);
+
+CREATE TABLE feed_visits (
+                             uid VARCHAR PRIMARY KEY,
+                             visited_at DATETIME,
+                             FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+COMMIT;
@@ -0,0 +1,61 @@
+-- Adds forums and moves every existing post into the General forum. Posts
+-- and comments get a creation time; older rows did not record one and get
+-- the time of the upgrade. Run once on databases created before forums:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/forums.sql
+PRAGMA foreign_keys = OFF;
+
+BEGIN TRANSACTION;
+
+CREATE TABLE forums (
+                        id INTEGER PRIMARY KEY AUTOINCREMENT,
+                        parent_id INTEGER,
+                        name VARCHAR,
+                        slug VARCHAR UNIQUE,
+                        description VARCHAR DEFAULT '',
+                        sort_order INTEGER DEFAULT 0,
+                        read_role VARCHAR DEFAULT 'guest',
+                        post_role VARCHAR DEFAULT 'user',
+                        FOREIGN KEY (parent_id) REFERENCES forums(id) ON DELETE CASCADE
+);
+
+INSERT INTO forums (name, slug, description, sort_order, read_role, post_role) VALUES
+                                  ('General', 'general', 'Everything else', 1, 'guest', 'user'),
+                                  ('Staff', 'staff', 'Moderators and administrators only', 2, 'moderator', 'moderator');
+
+CREATE TABLE posts_new (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       title VARCHAR,
+                       content VARCHAR,
+                       UID VARCHAR,
+                       forum_id INTEGER,
+                       created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                       FOREIGN KEY (UID) REFERENCES users(id) ON DELETE CASCADE,
+                       FOREIGN KEY (forum_id) REFERENCES forums(id)
+);
+
+INSERT INTO posts_new (id, title, content, UID, forum_id)
+SELECT id, title, content, UID, (SELECT id FROM forums WHERE slug = 'general') FROM posts;
+
+DROP TABLE posts;
+ALTER TABLE posts_new RENAME TO posts;
+
+CREATE INDEX posts_forum_idx ON posts (forum_id, created_at);
+
+CREATE TABLE comments_new (
+                          id INTEGER PRIMARY KEY AUTOINCREMENT,
+                          uid VARCHAR,
+                          post_id INTEGER,
+                          content VARCHAR,
+                          created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                          FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                          FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+INSERT INTO comments_new (id, uid, post_id, content) SELECT id, uid, post_id, content FROM comments;
+
+DROP TABLE comments;
+ALTER TABLE comments_new RENAME TO comments;
+
+COMMIT;
+
+PRAGMA foreign_keys = ON;
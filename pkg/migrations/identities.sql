@@ -0,0 +1,16 @@
+-- Adds the OAuth identities linked to accounts. Run once on databases
+-- created before OAuth login:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/identities.sql
+BEGIN TRANSACTION;
+
+CREATE TABLE user_identities (
+                                 provider VARCHAR,
+                                 subject VARCHAR,
+                                 uid VARCHAR,
+                                 email VARCHAR,
+                                 created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                                 PRIMARY KEY (provider, subject),
+                                 FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+COMMIT;
@@ -0,0 +1,13 @@
+-- Adds the cached HTML of posts and comments. The server renders the
+-- existing rows when it starts. Run once on databases created before
+-- Markdown:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/markdown.sql
+BEGIN TRANSACTION;
+
+ALTER TABLE posts ADD COLUMN content_html VARCHAR DEFAULT '';
+ALTER TABLE posts ADD COLUMN html_version INTEGER DEFAULT 0;
+
+ALTER TABLE comments ADD COLUMN content_html VARCHAR DEFAULT '';
+ALTER TABLE comments ADD COLUMN html_version INTEGER DEFAULT 0;
+
+COMMIT;
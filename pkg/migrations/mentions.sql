@@ -0,0 +1,28 @@
+-- Adds @mentions, the index behind username autocomplete and makes
+-- usernames unique regardless of case, as mentions match them. Run once on
+-- databases created before mentions:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/mentions.sql
+-- The script stops if two users share a name that differs only in case;
+-- rename one of those listed by
+--   SELECT username FROM users GROUP BY username COLLATE NOCASE HAVING COUNT(*) > 1;
+BEGIN TRANSACTION;
+
+CREATE INDEX users_username_prefix_idx ON users (username COLLATE NOCASE);
+CREATE UNIQUE INDEX users_username_nocase_idx ON users (username COLLATE NOCASE);
+
+CREATE TABLE mentions (
+                          id INTEGER PRIMARY KEY AUTOINCREMENT,
+                          uid VARCHAR,
+                          author_uid VARCHAR,
+                          post_id INTEGER,
+                          comment_id INTEGER,
+                          created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                          FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                          FOREIGN KEY (author_uid) REFERENCES users(id) ON DELETE CASCADE,
+                          FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+                          FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX mentions_uid_idx ON mentions (uid, created_at);
+
+COMMIT;
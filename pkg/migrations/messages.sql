@@ -0,0 +1,60 @@
+-- Adds private conversations, blocks and message reports. Run once on
+-- databases created before private messages:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/messages.sql
+BEGIN TRANSACTION;
+
+CREATE TABLE conversations (
+                               id INTEGER PRIMARY KEY AUTOINCREMENT,
+                               creator_uid VARCHAR NOT NULL,
+                               subject VARCHAR NOT NULL,
+                               created_at DATETIME NOT NULL,
+                               updated_at DATETIME NOT NULL,
+                               FOREIGN KEY (creator_uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX conversations_creator_idx ON conversations (creator_uid, created_at);
+
+CREATE TABLE conversation_members (
+                                      conversation_id INTEGER NOT NULL,
+                                      uid VARCHAR NOT NULL,
+                                      last_read_id INTEGER NOT NULL DEFAULT 0,
+                                      PRIMARY KEY (conversation_id, uid),
+                                      FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+                                      FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX conversation_members_uid_idx ON conversation_members (uid);
+
+CREATE TABLE messages (
+                          id INTEGER PRIMARY KEY AUTOINCREMENT,
+                          conversation_id INTEGER NOT NULL,
+                          uid VARCHAR NOT NULL,
+                          content TEXT NOT NULL,
+                          created_at DATETIME NOT NULL,
+                          FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+                          FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX messages_conversation_idx ON messages (conversation_id, id);
+
+CREATE TABLE user_blocks (
+                             uid VARCHAR NOT NULL,
+                             blocked_uid VARCHAR NOT NULL,
+                             created_at DATETIME NOT NULL,
+                             PRIMARY KEY (uid, blocked_uid),
+                             FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                             FOREIGN KEY (blocked_uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE message_reports (
+                                 id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                 reporter_uid VARCHAR NOT NULL,
+                                 message_id INTEGER NOT NULL,
+                                 reason TEXT NOT NULL,
+                                 created_at DATETIME NOT NULL,
+                                 UNIQUE (reporter_uid, message_id),
+                                 FOREIGN KEY (reporter_uid) REFERENCES users(id) ON DELETE CASCADE,
+                                 FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+COMMIT;
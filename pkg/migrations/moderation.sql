@@ -0,0 +1,11 @@
+-- Adds the pending flag that hides the posts and comments of new users until
+-- the staff approve them. Content already queued for review stays visible.
+-- Run once on databases created before the hold:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/moderation.sql
+BEGIN TRANSACTION;
+
+ALTER TABLE posts ADD COLUMN pending BOOLEAN NOT NULL DEFAULT 0;
+
+ALTER TABLE comments ADD COLUMN pending BOOLEAN NOT NULL DEFAULT 0;
+
+COMMIT;
@@ -0,0 +1,30 @@
+-- Adds notifications and the preferences that turn each kind off. Run once
+-- on databases created before notifications:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/notifications.sql
+BEGIN TRANSACTION;
+
+CREATE TABLE notifications (
+                               id INTEGER PRIMARY KEY AUTOINCREMENT,
+                               uid VARCHAR,
+                               actor_uid VARCHAR,
+                               type VARCHAR,
+                               post_id INTEGER,
+                               comment_id INTEGER,
+                               title VARCHAR,
+                               read_at DATETIME,
+                               created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                               FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                               FOREIGN KEY (actor_uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_uid_idx ON notifications (uid, read_at);
+
+CREATE TABLE notification_preferences (
+                                          uid VARCHAR,
+                                          type VARCHAR,
+                                          enabled INTEGER DEFAULT 1,
+                                          PRIMARY KEY (uid, type),
+                                          FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+COMMIT;
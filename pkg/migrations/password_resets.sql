@@ -0,0 +1,23 @@
+-- Adds password reset tokens and the requests counted by their rate limit.
+-- Run once on databases created before password resets:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/password_resets.sql
+BEGIN TRANSACTION;
+
+CREATE TABLE password_resets (
+                                 token_hash VARCHAR PRIMARY KEY,
+                                 uid VARCHAR,
+                                 expires_at DATETIME,
+                                 used INTEGER DEFAULT 0,
+                                 FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE password_reset_requests (
+                                         email VARCHAR NOT NULL,
+                                         ip VARCHAR NOT NULL,
+                                         created_at DATETIME NOT NULL
+);
+
+CREATE INDEX password_reset_requests_email_idx ON password_reset_requests (email, created_at);
+CREATE INDEX password_reset_requests_ip_idx ON password_reset_requests (ip, created_at);
+
+COMMIT;
@@ -0,0 +1,42 @@
+-- Adds polls. Run once on databases created before polls:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/polls.sql
+BEGIN TRANSACTION;
+
+CREATE TABLE polls (
+                       post_id INTEGER PRIMARY KEY,
+                       question VARCHAR NOT NULL,
+                       multiple BOOLEAN NOT NULL DEFAULT 0,
+                       anonymous BOOLEAN NOT NULL DEFAULT 0,
+                       closes_at DATETIME,
+                       FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE TABLE poll_options (
+                              id INTEGER PRIMARY KEY AUTOINCREMENT,
+                              post_id INTEGER NOT NULL,
+                              position INTEGER NOT NULL,
+                              label VARCHAR NOT NULL,
+                              FOREIGN KEY (post_id) REFERENCES polls(post_id) ON DELETE CASCADE
+);
+
+CREATE INDEX poll_options_post_idx ON poll_options (post_id, position);
+
+CREATE TABLE poll_ballots (
+                              post_id INTEGER NOT NULL,
+                              uid VARCHAR NOT NULL,
+                              created_at DATETIME NOT NULL,
+                              PRIMARY KEY (post_id, uid),
+                              FOREIGN KEY (post_id) REFERENCES polls(post_id) ON DELETE CASCADE,
+                              FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE poll_votes (
+                            post_id INTEGER NOT NULL,
+                            uid VARCHAR NOT NULL,
+                            option_id INTEGER NOT NULL,
+                            PRIMARY KEY (post_id, uid, option_id),
+                            FOREIGN KEY (post_id, uid) REFERENCES poll_ballots(post_id, uid) ON DELETE CASCADE,
+                            FOREIGN KEY (option_id) REFERENCES poll_options(id) ON DELETE CASCADE
+);
+
+COMMIT;
@@ -0,0 +1,38 @@
+-- Adds the display name, bio, avatar and join date of users. Existing users
+-- did not record when they joined, and the times of their posts may be those
+-- of an upgrade too, so they get 1970-01-01: trust levels count them as long
+-- standing and profiles leave the date out. Run once on databases created
+-- before profiles, after twofactor.sql:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/profiles.sql
+PRAGMA foreign_keys = OFF;
+
+BEGIN TRANSACTION;
+
+CREATE TABLE users_new (
+                       id VARCHAR PRIMARY KEY,
+                       username VARCHAR UNIQUE,
+                       email VARCHAR UNIQUE,
+                       password VARCHAR(60),
+                       role VARCHAR DEFAULT 'user',
+                       email_verified INTEGER DEFAULT 0,
+                       totp_secret VARCHAR DEFAULT '',
+                       totp_enabled INTEGER DEFAULT 0,
+                       totp_last_step INTEGER DEFAULT 0,
+                       display_name VARCHAR DEFAULT '',
+                       bio VARCHAR DEFAULT '',
+                       avatar VARCHAR DEFAULT '',
+                       created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO users_new (id, username, email, password, role, email_verified, totp_secret, totp_enabled, totp_last_step, created_at)
+SELECT id, username, email, password, role, email_verified, totp_secret, totp_enabled, totp_last_step, '1970-01-01 00:00:00' FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE INDEX posts_uid_idx ON posts (uid, created_at);
+CREATE INDEX comments_uid_idx ON comments (uid, created_at);
+
+COMMIT;
+
+PRAGMA foreign_keys = ON;
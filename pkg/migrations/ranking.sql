@@ -0,0 +1,22 @@
+-- Adds the materialised ranking scores of posts. Run once on databases
+-- created before the hot, top and controversial listings; the server scores
+-- the existing posts when it starts:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/ranking.sql
+BEGIN TRANSACTION;
+
+CREATE TABLE post_scores (
+                             post_id INTEGER PRIMARY KEY,
+                             ups INTEGER NOT NULL DEFAULT 0,
+                             downs INTEGER NOT NULL DEFAULT 0,
+                             comments INTEGER NOT NULL DEFAULT 0,
+                             score INTEGER NOT NULL DEFAULT 0,
+                             hot REAL NOT NULL DEFAULT 0,
+                             controversy REAL NOT NULL DEFAULT 0,
+                             FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX post_scores_hot_idx ON post_scores (hot);
+CREATE INDEX post_scores_score_idx ON post_scores (score);
+CREATE INDEX post_scores_controversy_idx ON post_scores (controversy);
+
+COMMIT;
@@ -0,0 +1,33 @@
+-- Moves the like/dislike rows of posts_reactions and comments_reactions
+-- into the reactions table, which holds any configured kind. Run once on
+-- databases created before emoji reactions:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/reactions.sql
+BEGIN TRANSACTION;
+
+CREATE TABLE reactions (
+                           user_id VARCHAR NOT NULL,
+                           target VARCHAR NOT NULL,
+                           target_id INTEGER NOT NULL,
+                           kind VARCHAR NOT NULL,
+                           weight INTEGER NOT NULL DEFAULT 0,
+                           created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                           PRIMARY KEY (user_id, target, target_id, kind),
+                           FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX reactions_target_idx ON reactions (target, target_id, kind);
+
+INSERT INTO reactions (user_id, target, target_id, kind, weight)
+SELECT user_id, 'post', post_id, CASE WHEN sign > 0 THEN 'like' ELSE 'dislike' END, CASE WHEN sign > 0 THEN 1 ELSE -1 END
+FROM posts_reactions
+WHERE sign IN (1, -1);
+
+INSERT INTO reactions (user_id, target, target_id, kind, weight)
+SELECT user_id, 'comment', comment_id, CASE WHEN sign > 0 THEN 'like' ELSE 'dislike' END, CASE WHEN sign > 0 THEN 1 ELSE -1 END
+FROM comments_reactions
+WHERE sign IN (1, -1);
+
+DROP TABLE posts_reactions;
+DROP TABLE comments_reactions;
+
+COMMIT;
@@ -0,0 +1,19 @@
+-- Adds the reputation score of users and fills it from the reactions other
+-- users left on their posts and comments. Run once on databases created
+-- before reputation, after reactions.sql:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/reputation.sql
+BEGIN TRANSACTION;
+
+ALTER TABLE users ADD COLUMN reputation INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX users_reputation_idx ON users (reputation);
+
+UPDATE users SET reputation =
+    (SELECT COALESCE(SUM(r.weight), 0) FROM reactions r
+     JOIN posts p ON p.id = r.target_id
+     WHERE r.target = 'post' AND p.uid = users.id AND r.user_id != users.id)
+  + (SELECT COALESCE(SUM(r.weight), 0) FROM reactions r
+     JOIN comments c ON c.id = r.target_id
+     WHERE r.target = 'comment' AND c.uid = users.id AND r.user_id != users.id);
+
+COMMIT;
@@ -3,9 +3,35 @@ PRAGMA foreign_keys = ON;
 
 CREATE TABLE IF NOT EXISTS users (
                        id VARCHAR PRIMARY KEY,
-                       username VARCHAR UNIQUE,
+                       username VARCHAR UNIQUE COLLATE NOCASE,
                        email VARCHAR UNIQUE,
-                       password VARCHAR(60)
+                       password VARCHAR(60),
+                       role VARCHAR DEFAULT 'user',
+                       email_verified INTEGER DEFAULT 0,
+                       totp_secret VARCHAR DEFAULT '',
+                       totp_enabled INTEGER DEFAULT 0,
+                       totp_last_step INTEGER DEFAULT 0,
+                       display_name VARCHAR DEFAULT '',
+                       bio VARCHAR DEFAULT '',
+                       avatar VARCHAR DEFAULT '',
+                       created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                       reputation INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX users_reputation_idx ON users (reputation);
+
+CREATE INDEX users_username_prefix_idx ON users (username COLLATE NOCASE);
+
+CREATE TABLE forums (
+                        id INTEGER PRIMARY KEY AUTOINCREMENT,
+                        parent_id INTEGER,
+                        name VARCHAR,
+                        slug VARCHAR UNIQUE,
+                        description VARCHAR DEFAULT '',
+                        sort_order INTEGER DEFAULT 0,
+                        read_role VARCHAR DEFAULT 'guest',
+                        post_role VARCHAR DEFAULT 'user',
+                        FOREIGN KEY (parent_id) REFERENCES forums(id) ON DELETE CASCADE
 );
 
 CREATE TABLE posts (
@@ -13,21 +39,41 @@ CREATE TABLE posts (
                        title VARCHAR,
                        content VARCHAR,
                        UID VARCHAR,
-                       FOREIGN KEY (UID) REFERENCES users(id) ON DELETE CASCADE
+                       forum_id INTEGER,
+                       created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                       content_html VARCHAR DEFAULT '',
+                       html_version INTEGER DEFAULT 0,
+                       pending BOOLEAN NOT NULL DEFAULT 0,
+                       FOREIGN KEY (UID) REFERENCES users(id) ON DELETE CASCADE,
+                       FOREIGN KEY (forum_id) REFERENCES forums(id)
 );
 
+CREATE INDEX posts_forum_idx ON posts (forum_id, created_at);
+CREATE INDEX posts_uid_idx ON posts (uid, created_at);
+
 CREATE TABLE comments (
                           id INTEGER PRIMARY KEY AUTOINCREMENT,
                           uid VARCHAR,
                           post_id INTEGER,
                           content VARCHAR,
+                          created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                          content_html VARCHAR DEFAULT '',
+                          html_version INTEGER DEFAULT 0,
+                          pending BOOLEAN NOT NULL DEFAULT 0,
                           FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
                           FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
 );
 
+CREATE INDEX comments_uid_idx ON comments (uid, created_at);
+CREATE INDEX comments_post_idx ON comments (post_id, id);
+
 CREATE TABLE categories (
                             id INTEGER PRIMARY KEY AUTOINCREMENT,
-                            name VARCHAR
+                            name VARCHAR,
+                            slug VARCHAR UNIQUE,
+                            description VARCHAR DEFAULT '',
+                            color VARCHAR DEFAULT '#888888',
+                            sort_order INTEGER DEFAULT 0
 );
 
 CREATE TABLE post_cats (
@@ -46,33 +92,345 @@ CREATE TABLE sessions (
                           FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
 );
 
-CREATE TABLE posts_reactions (
-                                 user_id VARCHAR,
-                                 post_id INTEGER,
-                                 sign INTEGER,
-                                 PRIMARY KEY (user_id, post_id),
-                                 FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-                                 FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
-);
-
-CREATE TABLE comments_reactions (
-                                    user_id VARCHAR,
-                                    comment_id INTEGER,
-                                    sign INTEGER,
-                                    PRIMARY KEY (user_id, comment_id),
-                                    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-                                    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
-);
-
-INSERT INTO categories (name) VALUES
-                                  ('Category 1'),
-                                  ('Category 2'),
-                                  ('Category 3'),
-                                  ('Category 4'),
-                                  ('Category 5'),
-                                  ('Category 6'),
-                                  ('Category 7'),
-                                  ('Category 8'),
-                                  ('Category 9'),
-                                  ('Category 10');
+CREATE TABLE reactions (
+                           user_id VARCHAR NOT NULL,
+                           target VARCHAR NOT NULL,
+                           target_id INTEGER NOT NULL,
+                           kind VARCHAR NOT NULL,
+                           weight INTEGER NOT NULL DEFAULT 0,
+                           created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                           PRIMARY KEY (user_id, target, target_id, kind),
+                           FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX reactions_target_idx ON reactions (target, target_id, kind);
+
+CREATE TABLE uploads (
+                         id VARCHAR PRIMARY KEY,
+                         uid VARCHAR,
+                         post_id INTEGER,
+                         content_type VARCHAR,
+                         ext VARCHAR,
+                         width INTEGER,
+                         height INTEGER,
+                         size INTEGER,
+                         created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                         FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                         FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX uploads_post_idx ON uploads (post_id);
+
+CREATE TABLE mentions (
+                          id INTEGER PRIMARY KEY AUTOINCREMENT,
+                          uid VARCHAR,
+                          author_uid VARCHAR,
+                          post_id INTEGER,
+                          comment_id INTEGER,
+                          created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                          FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                          FOREIGN KEY (author_uid) REFERENCES users(id) ON DELETE CASCADE,
+                          FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+                          FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX mentions_uid_idx ON mentions (uid, created_at);
+
+CREATE TABLE notifications (
+                               id INTEGER PRIMARY KEY AUTOINCREMENT,
+                               uid VARCHAR,
+                               actor_uid VARCHAR,
+                               type VARCHAR,
+                               post_id INTEGER,
+                               comment_id INTEGER,
+                               title VARCHAR,
+                               read_at DATETIME,
+                               created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                               FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                               FOREIGN KEY (actor_uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_uid_idx ON notifications (uid, read_at);
+
+CREATE TABLE notification_preferences (
+                                          uid VARCHAR,
+                                          type VARCHAR,
+                                          enabled INTEGER DEFAULT 1,
+                                          PRIMARY KEY (uid, type),
+                                          FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE reports (
+                         id INTEGER PRIMARY KEY AUTOINCREMENT,
+                         reporter_uid VARCHAR,
+                         post_id INTEGER,
+                         comment_id INTEGER,
+                         reason TEXT,
+                         created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                         FOREIGN KEY (reporter_uid) REFERENCES users(id) ON DELETE CASCADE,
+                         FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+                         FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE TABLE webhooks (
+                          id INTEGER PRIMARY KEY AUTOINCREMENT,
+                          url VARCHAR NOT NULL,
+                          secret VARCHAR NOT NULL,
+                          events VARCHAR NOT NULL,
+                          active INTEGER DEFAULT 1,
+                          created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries (
+                                    id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                    webhook_id INTEGER,
+                                    event VARCHAR,
+                                    payload TEXT,
+                                    status VARCHAR DEFAULT 'pending',
+                                    attempts INTEGER DEFAULT 0,
+                                    response_code INTEGER DEFAULT 0,
+                                    error TEXT DEFAULT '',
+                                    next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                                    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                                    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt_at);
+CREATE INDEX webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, id);
+
+CREATE TABLE digest_subscriptions (
+                                      uid VARCHAR PRIMARY KEY,
+                                      frequency VARCHAR NOT NULL,
+                                      last_sent_at DATETIME,
+                                      FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE digest_categories (
+                                   uid VARCHAR,
+                                   category_id INTEGER,
+                                   PRIMARY KEY (uid, category_id),
+                                   FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                                   FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+CREATE TABLE digest_deliveries (
+                                   uid VARCHAR,
+                                   period VARCHAR,
+                                   created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                                   PRIMARY KEY (uid, period),
+                                   FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE bookmarks (
+                           id INTEGER PRIMARY KEY AUTOINCREMENT,
+                           uid VARCHAR,
+                           post_id INTEGER,
+                           comment_id INTEGER,
+                           folder VARCHAR DEFAULT '',
+                           note TEXT DEFAULT '',
+                           created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                           FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                           FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+                           FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX bookmarks_subject_idx ON bookmarks (uid, post_id, COALESCE(comment_id, 0));
+
+CREATE TABLE follows (
+                         uid VARCHAR,
+                         kind VARCHAR,
+                         target_id VARCHAR,
+                         state VARCHAR DEFAULT 'follow',
+                         created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                         PRIMARY KEY (uid, kind, target_id),
+                         FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX follows_target_idx ON follows (kind, target_id, state);
+
+CREATE TABLE feed_visits (
+                             uid VARCHAR PRIMARY KEY,
+                             visited_at DATETIME,
+                             FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE conversations (
+                               id INTEGER PRIMARY KEY AUTOINCREMENT,
+                               creator_uid VARCHAR NOT NULL,
+                               subject VARCHAR NOT NULL,
+                               created_at DATETIME NOT NULL,
+                               updated_at DATETIME NOT NULL,
+                               FOREIGN KEY (creator_uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX conversations_creator_idx ON conversations (creator_uid, created_at);
+
+CREATE TABLE conversation_members (
+                                      conversation_id INTEGER NOT NULL,
+                                      uid VARCHAR NOT NULL,
+                                      last_read_id INTEGER NOT NULL DEFAULT 0,
+                                      PRIMARY KEY (conversation_id, uid),
+                                      FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+                                      FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX conversation_members_uid_idx ON conversation_members (uid);
+
+CREATE TABLE messages (
+                          id INTEGER PRIMARY KEY AUTOINCREMENT,
+                          conversation_id INTEGER NOT NULL,
+                          uid VARCHAR NOT NULL,
+                          content TEXT NOT NULL,
+                          created_at DATETIME NOT NULL,
+                          FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+                          FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX messages_conversation_idx ON messages (conversation_id, id);
+
+CREATE TABLE user_blocks (
+                             uid VARCHAR NOT NULL,
+                             blocked_uid VARCHAR NOT NULL,
+                             created_at DATETIME NOT NULL,
+                             PRIMARY KEY (uid, blocked_uid),
+                             FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                             FOREIGN KEY (blocked_uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE message_reports (
+                                 id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                 reporter_uid VARCHAR NOT NULL,
+                                 message_id INTEGER NOT NULL,
+                                 reason TEXT NOT NULL,
+                                 created_at DATETIME NOT NULL,
+                                 UNIQUE (reporter_uid, message_id),
+                                 FOREIGN KEY (reporter_uid) REFERENCES users(id) ON DELETE CASCADE,
+                                 FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+CREATE TABLE polls (
+                       post_id INTEGER PRIMARY KEY,
+                       question VARCHAR NOT NULL,
+                       multiple BOOLEAN NOT NULL DEFAULT 0,
+                       anonymous BOOLEAN NOT NULL DEFAULT 0,
+                       closes_at DATETIME,
+                       FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE TABLE poll_options (
+                              id INTEGER PRIMARY KEY AUTOINCREMENT,
+                              post_id INTEGER NOT NULL,
+                              position INTEGER NOT NULL,
+                              label VARCHAR NOT NULL,
+                              FOREIGN KEY (post_id) REFERENCES polls(post_id) ON DELETE CASCADE
+);
+
+CREATE INDEX poll_options_post_idx ON poll_options (post_id, position);
+
+CREATE TABLE poll_ballots (
+                              post_id INTEGER NOT NULL,
+                              uid VARCHAR NOT NULL,
+                              created_at DATETIME NOT NULL,
+                              PRIMARY KEY (post_id, uid),
+                              FOREIGN KEY (post_id) REFERENCES polls(post_id) ON DELETE CASCADE,
+                              FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE poll_votes (
+                            post_id INTEGER NOT NULL,
+                            uid VARCHAR NOT NULL,
+                            option_id INTEGER NOT NULL,
+                            PRIMARY KEY (post_id, uid, option_id),
+                            FOREIGN KEY (post_id, uid) REFERENCES poll_ballots(post_id, uid) ON DELETE CASCADE,
+                            FOREIGN KEY (option_id) REFERENCES poll_options(id) ON DELETE CASCADE
+);
+
+CREATE TABLE post_scores (
+                             post_id INTEGER PRIMARY KEY,
+                             ups INTEGER NOT NULL DEFAULT 0,
+                             downs INTEGER NOT NULL DEFAULT 0,
+                             comments INTEGER NOT NULL DEFAULT 0,
+                             score INTEGER NOT NULL DEFAULT 0,
+                             hot REAL NOT NULL DEFAULT 0,
+                             controversy REAL NOT NULL DEFAULT 0,
+                             FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX post_scores_hot_idx ON post_scores (hot);
+CREATE INDEX post_scores_score_idx ON post_scores (score);
+CREATE INDEX post_scores_controversy_idx ON post_scores (controversy);
+
+CREATE TABLE post_reads (
+                            uid VARCHAR NOT NULL,
+                            post_id INTEGER NOT NULL,
+                            last_comment_id INTEGER NOT NULL DEFAULT 0,
+                            PRIMARY KEY (uid, post_id),
+                            FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                            FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE TABLE password_resets (
+                                 token_hash VARCHAR PRIMARY KEY,
+                                 uid VARCHAR,
+                                 expires_at DATETIME,
+                                 used INTEGER DEFAULT 0,
+                                 FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE password_reset_requests (
+                                         email VARCHAR NOT NULL,
+                                         ip VARCHAR NOT NULL,
+                                         created_at DATETIME NOT NULL
+);
+
+CREATE INDEX password_reset_requests_email_idx ON password_reset_requests (email, created_at);
+CREATE INDEX password_reset_requests_ip_idx ON password_reset_requests (ip, created_at);
+
+CREATE TABLE user_identities (
+                                 provider VARCHAR,
+                                 subject VARCHAR,
+                                 uid VARCHAR,
+                                 email VARCHAR,
+                                 created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                                 PRIMARY KEY (provider, subject),
+                                 FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE recovery_codes (
+                                uid VARCHAR,
+                                code_hash VARCHAR,
+                                used INTEGER DEFAULT 0,
+                                PRIMARY KEY (uid, code_hash),
+                                FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE two_factor_failures (
+                                     uid VARCHAR NOT NULL,
+                                     token_hash VARCHAR NOT NULL DEFAULT '',
+                                     created_at DATETIME NOT NULL,
+                                     FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX two_factor_failures_uid_idx ON two_factor_failures (uid, created_at);
+
+CREATE TABLE settings (
+                          key VARCHAR PRIMARY KEY,
+                          value VARCHAR
+);
+
+INSERT INTO categories (name, slug, sort_order) VALUES
+                                  ('Category 1', 'category-1', 1),
+                                  ('Category 2', 'category-2', 2),
+                                  ('Category 3', 'category-3', 3),
+                                  ('Category 4', 'category-4', 4),
+                                  ('Category 5', 'category-5', 5),
+                                  ('Category 6', 'category-6', 6),
+                                  ('Category 7', 'category-7', 7),
+                                  ('Category 8', 'category-8', 8),
+                                  ('Category 9', 'category-9', 9),
+                                  ('Category 10', 'category-10', 10);
+
+INSERT INTO forums (name, slug, description, sort_order, read_role, post_role) VALUES
+                                  ('General', 'general', 'Everything else', 1, 'guest', 'user'),
+                                  ('Staff', 'staff', 'Moderators and administrators only', 2, 'moderator', 'moderator');
 
@@ -0,0 +1,32 @@
+-- Adds two-factor authentication, the failed attempts counted by its rate
+-- limit and the site settings holding the staff policy. Run once on databases created before two-factor authentication:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/twofactor.sql
+BEGIN TRANSACTION;
+
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR DEFAULT '';
+ALTER TABLE users ADD COLUMN totp_enabled INTEGER DEFAULT 0;
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER DEFAULT 0;
+
+CREATE TABLE recovery_codes (
+                                uid VARCHAR,
+                                code_hash VARCHAR,
+                                used INTEGER DEFAULT 0,
+                                PRIMARY KEY (uid, code_hash),
+                                FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE two_factor_failures (
+                                     uid VARCHAR NOT NULL,
+                                     token_hash VARCHAR NOT NULL DEFAULT '',
+                                     created_at DATETIME NOT NULL,
+                                     FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX two_factor_failures_uid_idx ON two_factor_failures (uid, created_at);
+
+CREATE TABLE settings (
+                          key VARCHAR PRIMARY KEY,
+                          value VARCHAR
+);
+
+COMMIT;
@@ -0,0 +1,17 @@
+-- Adds the read markers of threads. Run once on databases created before
+-- unread tracking:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/unread.sql
+BEGIN TRANSACTION;
+
+CREATE INDEX comments_post_idx ON comments (post_id, id);
+
+CREATE TABLE post_reads (
+                            uid VARCHAR NOT NULL,
+                            post_id INTEGER NOT NULL,
+                            last_comment_id INTEGER NOT NULL DEFAULT 0,
+                            PRIMARY KEY (uid, post_id),
+                            FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                            FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+COMMIT;
@@ -0,0 +1,21 @@
+-- Adds image uploads. Run once on databases created before uploads:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/uploads.sql
+BEGIN TRANSACTION;
+
+CREATE TABLE uploads (
+                         id VARCHAR PRIMARY KEY,
+                         uid VARCHAR,
+                         post_id INTEGER,
+                         content_type VARCHAR,
+                         ext VARCHAR,
+                         width INTEGER,
+                         height INTEGER,
+                         size INTEGER,
+                         created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                         FOREIGN KEY (uid) REFERENCES users(id) ON DELETE CASCADE,
+                         FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX uploads_post_idx ON uploads (post_id);
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- Adds email verification. Existing accounts count as verified so that they
+-- can keep posting; only new registrations confirm their address. Run once
+-- on databases created before email verification:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/verification.sql
+BEGIN TRANSACTION;
+
+ALTER TABLE users ADD COLUMN email_verified INTEGER DEFAULT 0;
+
+UPDATE users SET email_verified = 1;
+
+COMMIT;
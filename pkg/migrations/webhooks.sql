@@ -0,0 +1,44 @@
+-- Adds content reports, webhooks and their delivery queue. Run once on
+-- databases created before webhooks:
+--   sqlite3 -bail forum.sqlite < ./pkg/migrations/webhooks.sql
+BEGIN TRANSACTION;
+
+CREATE TABLE reports (
+                         id INTEGER PRIMARY KEY AUTOINCREMENT,
+                         reporter_uid VARCHAR,
+                         post_id INTEGER,
+                         comment_id INTEGER,
+                         reason TEXT,
+                         created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                         FOREIGN KEY (reporter_uid) REFERENCES users(id) ON DELETE CASCADE,
+                         FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+                         FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE TABLE webhooks (
+                          id INTEGER PRIMARY KEY AUTOINCREMENT,
+                          url VARCHAR NOT NULL,
+                          secret VARCHAR NOT NULL,
+                          events VARCHAR NOT NULL,
+                          active INTEGER DEFAULT 1,
+                          created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries (
+                                    id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                    webhook_id INTEGER,
+                                    event VARCHAR,
+                                    payload TEXT,
+                                    status VARCHAR DEFAULT 'pending',
+                                    attempts INTEGER DEFAULT 0,
+                                    response_code INTEGER DEFAULT 0,
+                                    error TEXT DEFAULT '',
+                                    next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                                    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                                    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt_at);
+CREATE INDEX webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, id);
+
+COMMIT;
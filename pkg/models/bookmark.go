@@ -0,0 +1,38 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// Bookmark saves a post, or one of its comments when CommentID is not 0, for
+// its owner. Folder and Note are optional and only shown to the owner.
+type Bookmark struct {
+	ID        int
+	UID       string
+	PostID    int
+	CommentID int
+	Folder    string
+	Note      string
+	CreatedAt time.Time
+	// Title and Cats belong to the post and Comment is the text of the
+	// bookmarked comment; they are filled when bookmarks are listed.
+	Title   string
+	Cats    []Category
+	Comment string
+}
+
+func (b Bookmark) Link() string {
+	link := "/post/" + strconv.Itoa(b.PostID)
+	if b.CommentID != 0 {
+		link += "#comment-" + strconv.Itoa(b.CommentID)
+	}
+	return link
+}
+
+// BookmarkFilter narrows a list of bookmarks down to one folder and one
+// category of posts. Zero values do not filter.
+type BookmarkFilter struct {
+	Folder     string
+	CategoryID int
+}
@@ -1,6 +1,10 @@
 package models
 
 type Category struct {
-	ID   int
-	Name string
+	ID          int
+	Name        string
+	Slug        string
+	Description string
+	Color       string
+	SortOrder   int
 }
@@ -1,8 +1,15 @@
 package models
 
+import "time"
+
 type Comment struct {
-	ID      int
-	UID     string
-	PostID  int
-	Content string
+	ID          int
+	UID         string
+	PostID      int
+	Content     string
+	ContentHTML string
+	CreatedAt   time.Time
+	// Pending comments wait for the staff to approve them and are only
+	// shown to their author and the staff.
+	Pending bool
 }
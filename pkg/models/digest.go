@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+const (
+	DigestOff    = ""
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DigestSettings is how often a user gets a digest email and which
+// categories its new posts come from.
+type DigestSettings struct {
+	Frequency  string
+	Categories []int
+}
+
+// Digest is the content of one digest email.
+type Digest struct {
+	Username  string
+	Frequency string
+	Since     time.Time
+	// Posts are new threads in the followed categories, Replies the threads
+	// of the user that got new comments and TopThreads the best liked new
+	// threads of the period.
+	Posts      []DigestPost
+	Replies    []DigestPost
+	TopThreads []DigestPost
+
+	SettingsURL    string
+	UnsubscribeURL string
+}
+
+// Empty tells whether there is nothing worth mailing.
+func (d Digest) Empty() bool {
+	return len(d.Posts) == 0 && len(d.Replies) == 0 && len(d.TopThreads) == 0
+}
+
+// DigestPost is a thread listed in a digest. Count is the number of new
+// replies or the score, depending on the section.
+type DigestPost struct {
+	ID     int
+	Title  string
+	Author string
+	URL    string
+	Count  int
+}
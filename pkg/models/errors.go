@@ -15,5 +15,24 @@ var (
 	NotFoundAnything         = errors.New("no data")
 	ValueMismatch            = errors.New("value is incorrect")
 	NoCatsSelected           = errors.New("no cats selected")
-	SignIsMismatch           = errors.New("sign is mismatched")
+	ErrUnknownReaction       = errors.New("unknown reaction")
+	UniqueConstraintSlug     = errors.New("duplicate slug")
+	ErrForbidden             = errors.New("forbidden")
+	ErrUnknown               = errors.New("unknown error")
+	ErrForumNotEmpty         = errors.New("forum is not empty")
+	ErrEmailNotVerified      = errors.New("email is not verified")
+	ErrResetTokenInvalid     = errors.New("reset token is invalid or expired")
+	ErrInvalidTwoFactorCode  = errors.New("invalid two-factor code")
+	ErrTwoFactorNotEnrolled  = errors.New("two-factor authentication is not set up")
+	ErrIdentityConflict      = errors.New("identity belongs to another account")
+	ErrIdentityNoEmail       = errors.New("identity has no email")
+	ErrPasswordBreached      = errors.New("password appears in a list of breached passwords")
+	ErrUploadTooLarge        = errors.New("upload is too large")
+	ErrUnsupportedUpload     = errors.New("upload is not a supported image")
+	ErrAlreadyReported       = errors.New("already reported")
+	ErrBlocked               = errors.New("user is blocked")
+	ErrRateLimited           = errors.New("too many requests")
+	ErrAlreadyVoted          = errors.New("already voted")
+	ErrPollClosed            = errors.New("poll is closed")
+	ErrTrustTooLow           = errors.New("trust level is too low")
 )
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Kinds of objects a user can follow or mute.
+const (
+	FollowUser     = "user"
+	FollowCategory = "category"
+	FollowThread   = "thread"
+)
+
+// A follow edge either follows or mutes its target.
+const (
+	FollowStateFollow = "follow"
+	FollowStateMute   = "mute"
+)
+
+// Follow is an edge from UID to the target of kind Kind. TargetID holds a
+// user ID, a category ID or a post ID depending on Kind.
+type Follow struct {
+	UID       string
+	Kind      string
+	TargetID  string
+	State     string
+	CreatedAt time.Time
+}
+
+// FeedEntry is a post in the personalized feed. ActiveAt is when the post was
+// created or, for followed threads, when it was last replied to; Reason names
+// the kind of follow that brought it in.
+type FeedEntry struct {
+	Post     PostWithCats
+	ActiveAt time.Time
+	Reason   string
+}
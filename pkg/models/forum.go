@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type Forum struct {
+	ID          int
+	ParentID    int
+	Name        string
+	Slug        string
+	Description string
+	SortOrder   int
+	ReadRole    string
+	PostRole    string
+}
+
+type ForumStats struct {
+	ThreadCount  int
+	PostCount    int
+	LastActivity time.Time
+}
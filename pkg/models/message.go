@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Conversation is a private exchange of messages between two or more users.
+type Conversation struct {
+	ID         int
+	Subject    string
+	CreatorUID string
+	CreatedAt  time.Time
+	// UpdatedAt is when the last message was sent.
+	UpdatedAt time.Time
+	// Members are the usernames of the participants, the viewer included.
+	Members []string
+	// Unread is how many messages from others the viewer has not seen.
+	Unread int
+}
+
+// Message is one message of a conversation.
+type Message struct {
+	ID             int
+	ConversationID int
+	UID            string
+	Author         string
+	Content        string
+	CreatedAt      time.Time
+}
+
+// MessageReport flags a private message for the staff, who can only read
+// messages that were reported.
+type MessageReport struct {
+	ID           int
+	ReporterUID  string
+	ReporterName string
+	Reason       string
+	CreatedAt    time.Time
+	Message      Message
+}
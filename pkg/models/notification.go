@@ -0,0 +1,74 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	NotifyReply      = "reply"
+	NotifyReaction   = "reaction"
+	NotifyMention    = "mention"
+	NotifyModeration = "moderation"
+	NotifyFollow     = "follow"
+)
+
+// NotificationTypes lists every notification type in the order they are
+// shown on the preferences page.
+var NotificationTypes = []string{NotifyReply, NotifyFollow, NotifyReaction, NotifyMention, NotifyModeration}
+
+type Notification struct {
+	ID        int
+	UID       string
+	ActorUID  string
+	ActorName string
+	Type      string
+	PostID    int
+	CommentID int
+	// Title is the title of the post at the time of the event, so that it
+	// can be shown after the post is deleted.
+	Title     string
+	Read      bool
+	CreatedAt time.Time
+}
+
+// Message describes the event for the notifications page.
+func (n Notification) Message() string {
+	switch n.Type {
+	case NotifyReply:
+		return n.ActorName + " replied to \"" + n.Title + "\""
+	case NotifyFollow:
+		return n.ActorName + " replied to \"" + n.Title + "\", which you follow"
+	case NotifyReaction:
+		if n.CommentID != 0 {
+			return n.ActorName + " reacted to your comment on \"" + n.Title + "\""
+		}
+		return n.ActorName + " reacted to \"" + n.Title + "\""
+	case NotifyMention:
+		return n.ActorName + " mentioned you in \"" + n.Title + "\""
+	case NotifyModeration:
+		if n.CommentID != 0 {
+			return n.ActorName + " removed your comment on \"" + n.Title + "\""
+		}
+		return n.ActorName + " removed \"" + n.Title + "\""
+	}
+	return n.Title
+}
+
+// Link is where the notification leads, or "" when its post is gone.
+func (n Notification) Link() string {
+	if n.Type == NotifyModeration && n.CommentID == 0 {
+		return ""
+	}
+	link := "/post/" + strconv.Itoa(n.PostID)
+	if n.CommentID != 0 && n.Type != NotifyModeration {
+		link += "#comment-" + strconv.Itoa(n.CommentID)
+	}
+	return link
+}
+
+// NotificationPreference tells whether events of Type are delivered.
+type NotificationPreference struct {
+	Type    string
+	Enabled bool
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Poll is attached to a post. Each user casts one ballot, choosing one
+// option or, for multiple choice polls, several.
+type Poll struct {
+	PostID    int
+	Question  string
+	Multiple  bool
+	Anonymous bool
+	// ClosesAt is when voting ends; the zero time keeps the poll open.
+	ClosesAt time.Time
+	Options  []PollOption
+	// Voters is how many users voted.
+	Voters int
+	// Voted is set when the viewer has voted.
+	Voted bool
+}
+
+type PollOption struct {
+	ID    int
+	Label string
+	Votes int
+	// Percent is the share of voters who chose the option.
+	Percent int
+	// VoterNames lists who chose the option, unless the poll is anonymous.
+	VoterNames []string
+	// Chosen is set when the viewer chose the option.
+	Chosen bool
+}
+
+// Closed reports whether voting has ended at now.
+func (p Poll) Closed(now time.Time) bool {
+	return !p.ClosesAt.IsZero() && !now.Before(p.ClosesAt)
+}
+
+// IsClosed reports whether voting has ended.
+func (p Poll) IsClosed() bool {
+	return p.Closed(time.Now())
+}
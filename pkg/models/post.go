@@ -1,16 +1,35 @@
 package models
 
+import "time"
+
 type Post struct {
 	ID      int
 	UID     string
+	ForumID int
 	Title   string
 	Content string
+	// ContentHTML is Content rendered from Markdown and sanitized.
+	ContentHTML string
+	CreatedAt   time.Time
+	// Pending posts wait for the staff to approve them and are only shown
+	// to their author and the staff.
+	Pending bool
 }
 
 type PostWithCats struct {
-	ID      int
-	UID     string
-	Title   string
-	Content string
-	Cats    []Category
+	ID          int
+	UID         string
+	ForumID     int
+	Title       string
+	Content     string
+	ContentHTML string
+	CreatedAt   time.Time
+	Pending     bool
+	Cats        []Category
+}
+
+// VisibleTo reports whether u may see the post: held posts are only shown
+// to their author and the staff.
+func (p PostWithCats) VisibleTo(u User) bool {
+	return !p.Pending || (u.ID != "" && p.UID == u.ID) || u.IsStaff()
 }
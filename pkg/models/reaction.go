@@ -1,7 +1,107 @@
 package models
 
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Targets reactions can be left on.
+const (
+	ReactionTargetPost    = "post"
+	ReactionTargetComment = "comment"
+)
+
+// The default reaction kinds.
+const (
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+)
+
+var DefaultReactionKinds = []ReactionKind{
+	{Name: ReactionLike, Emoji: "👍", Weight: 1},
+	{Name: ReactionDislike, Emoji: "👎", Weight: -1},
+}
+
 type Reaction struct {
 	SubjectID int
 	UID       string
-	Sign      int
+	Kind      string
+}
+
+// ReactionKind is an emoji users can react with. Weight counts towards the
+// karma of the author and the score of threads; kinds with a negative weight
+// do not notify the author.
+type ReactionKind struct {
+	Name   string
+	Emoji  string
+	Weight int
+}
+
+// ReactionSet is the kinds offered on one target and whether a user may
+// leave several of them at once or only one.
+type ReactionSet struct {
+	Kinds    []ReactionKind
+	Multiple bool
+}
+
+// Kind returns the kind called name.
+func (s ReactionSet) Kind(name string) (ReactionKind, bool) {
+	for _, kind := range s.Kinds {
+		if kind.Name == name {
+			return kind, true
+		}
+	}
+	return ReactionKind{}, false
+}
+
+type ReactionConfig struct {
+	Post    ReactionSet
+	Comment ReactionSet
+}
+
+// ReactionCount is how often one kind was left on a post or a comment.
+type ReactionCount struct {
+	Kind  ReactionKind
+	Count int
+	// Reacted is set when the viewer left this kind.
+	Reacted bool
+	// Users are the usernames of who reacted, in alphabetical order.
+	Users []string
+}
+
+// ParseReactionKinds reads a comma separated list of name:emoji:weight
+// entries. The weight may be left out and defaults to 0.
+func ParseReactionKinds(spec string) ([]ReactionKind, error) {
+	var kinds []ReactionKind
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.New("reaction " + strconv.Quote(entry) + " is not name:emoji:weight")
+		}
+		if seen[parts[0]] {
+			return nil, errors.New("reaction " + strconv.Quote(parts[0]) + " is listed twice")
+		}
+		seen[parts[0]] = true
+
+		kind := ReactionKind{Name: parts[0], Emoji: parts[1]}
+		if len(parts) == 3 {
+			weight, err := strconv.Atoi(parts[2])
+			if err != nil {
+				return nil, errors.New("reaction " + strconv.Quote(entry) + " has an invalid weight")
+			}
+			kind.Weight = weight
+		}
+		kinds = append(kinds, kind)
+	}
+	if len(kinds) == 0 {
+		return nil, errors.New("no reactions configured")
+	}
+	return kinds, nil
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Report flags a post, or a comment when CommentID is not 0, for the staff.
+type Report struct {
+	ID           int
+	ReporterUID  string
+	ReporterName string
+	PostID       int
+	CommentID    int
+	Reason       string
+	CreatedAt    time.Time
+	// Review is set for the reports that hold the content of a new user
+	// until it is approved.
+	Review bool
+}
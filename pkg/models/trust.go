@@ -0,0 +1,82 @@
+package models
+
+import "time"
+
+// TrustLevel grows with the reputation and the age of an account and
+// unlocks what a user may do.
+type TrustLevel int
+
+const (
+	TrustNew TrustLevel = iota
+	TrustBasic
+	TrustMember
+)
+
+// TrustRequirement is the reputation and account age needed for Level.
+type TrustRequirement struct {
+	Level    TrustLevel
+	MinScore int
+	MinAge   time.Duration
+}
+
+// TrustRequirements lists the levels above TrustNew, lowest first.
+var TrustRequirements = []TrustRequirement{
+	{Level: TrustBasic, MinScore: 0, MinAge: 24 * time.Hour},
+	{Level: TrustMember, MinScore: 10, MinAge: 7 * 24 * time.Hour},
+}
+
+// TrustLevelFor returns the highest level whose requirements score and age
+// meet.
+func TrustLevelFor(score int, age time.Duration) TrustLevel {
+	level := TrustNew
+	for _, req := range TrustRequirements {
+		if score >= req.MinScore && age >= req.MinAge {
+			level = req.Level
+		}
+	}
+	return level
+}
+
+func (l TrustLevel) Name() string {
+	switch l {
+	case TrustBasic:
+		return "Basic"
+	case TrustMember:
+		return "Member"
+	}
+	return "New"
+}
+
+// MinAgeDays is the account age required for l in whole days.
+func (r TrustRequirement) MinAgeDays() int {
+	return int(r.MinAge / (24 * time.Hour))
+}
+
+// CanPostLinks tells whether posts and comments may contain links.
+func (l TrustLevel) CanPostLinks() bool {
+	return l >= TrustBasic
+}
+
+// CanPostImages tells whether images may be attached to posts.
+func (l TrustLevel) CanPostImages() bool {
+	return l >= TrustBasic
+}
+
+// SkipsModeration tells whether new posts and comments go live without
+// being queued for review by the staff.
+func (l TrustLevel) SkipsModeration() bool {
+	return l >= TrustBasic
+}
+
+// CanCreatePolls tells whether polls may be attached to posts.
+func (l TrustLevel) CanCreatePolls() bool {
+	return l >= TrustMember
+}
+
+// Reputation is the standing of a user on the leaderboard.
+type Reputation struct {
+	Username  string
+	Score     int
+	CreatedAt time.Time
+	Level     TrustLevel
+}
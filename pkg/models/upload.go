@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+type Upload struct {
+	ID          string
+	UID         string
+	PostID      int
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+	Size        int
+	CreatedAt   time.Time
+}
+
+func (u Upload) URL() string {
+	return "/uploads/" + u.ID + u.Ext
+}
+
+func (u Upload) ThumbURL() string {
+	return "/uploads/" + u.ID + "_thumb" + u.Ext
+}
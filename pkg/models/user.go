@@ -1,8 +1,71 @@
 package models
 
+import "time"
+
+const (
+	RoleGuest     = "guest"
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleGuest:     0,
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
 type User struct {
 	ID       string
 	Username string
 	Password string
 	Email    string
+	Role     string
+
+	EmailVerified bool
+	TOTPSecret    string
+	TOTPEnabled   bool
+
+	DisplayName string
+	Bio         string
+	// Avatar is the URL of the profile picture, empty when there is none.
+	Avatar    string
+	CreatedAt time.Time
+}
+
+// UserStats summarizes the activity shown on a profile.
+type UserStats struct {
+	PostCount    int
+	CommentCount int
+	// Karma is the sum of reactions other users left on the posts and
+	// comments of the user.
+	Karma int
+}
+
+// Name is how the user is presented to others.
+func (u User) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Username
+}
+
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+func (u User) IsStaff() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+// HasRole reports whether role is at least as privileged as required.
+// Unknown or empty roles are treated as guests.
+func HasRole(role, required string) bool {
+	return roleRanks[role] >= roleRanks[required]
+}
+
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
 }
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	WebhookPostCreated    = "post.created"
+	WebhookCommentCreated = "comment.created"
+	WebhookReaction       = "reaction"
+	WebhookUserRegistered = "user.registered"
+	WebhookReportFiled    = "report.filed"
+	// WebhookPing is only sent by the "send test event" button.
+	WebhookPing = "ping"
+)
+
+// WebhookEvents lists the event types a webhook can subscribe to.
+var WebhookEvents = []string{WebhookPostCreated, WebhookCommentCreated, WebhookReaction, WebhookUserRegistered, WebhookReportFiled}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	ID  int
+	URL string
+	// Secret signs the payloads with HMAC-SHA256.
+	Secret    string
+	Events    []string
+	Active    bool
+	CreatedAt time.Time
+}
+
+func (w Webhook) Subscribed(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Webhook) EventList() string {
+	return strings.Join(w.Events, ", ")
+}
+
+type WebhookDelivery struct {
+	ID           int
+	WebhookID    int
+	Event        string
+	Payload      string
+	Status       string
+	Attempts     int
+	ResponseCode int
+	Error        string
+	NextAttempt  time.Time
+	CreatedAt    time.Time
+}
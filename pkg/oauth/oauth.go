@@ -0,0 +1,277 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider kinds. OIDC providers expose a standard userinfo endpoint, GitHub
+// style providers return a numeric id and list emails separately.
+const (
+	KindOIDC   = "oidc"
+	KindGitHub = "github"
+)
+
+var (
+	ErrExchange = errors.New("oauth: code exchange failed")
+	ErrIdentity = errors.New("oauth: cannot fetch identity")
+)
+
+// Provider describes one OAuth2 / OpenID Connect identity provider.
+type Provider struct {
+	Name         string
+	Kind         string
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	// EmailsURL lists the addresses of a GitHub style account.
+	EmailsURL   string
+	Scopes      []string
+	RedirectURL string
+
+	Client *http.Client
+}
+
+// Identity is what the forum learns about a user from a provider.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+}
+
+// Google returns a provider preset for Google accounts.
+func Google(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name:         "google",
+		Kind:         KindOIDC,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		UserInfoURL:  "https://openidconnect.googleapis.com/v1/userinfo",
+		Scopes:       []string{"openid", "email", "profile"},
+		RedirectURL:  redirectURL,
+	}
+}
+
+// GitHub returns a provider preset for GitHub accounts.
+func GitHub(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name:         "github",
+		Kind:         KindGitHub,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		UserInfoURL:  "https://api.github.com/user",
+		EmailsURL:    "https://api.github.com/user/emails",
+		Scopes:       []string{"read:user", "user:email"},
+		RedirectURL:  redirectURL,
+	}
+}
+
+// NewPKCE returns a random code verifier and its S256 challenge.
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	return verifier, Challenge(verifier), nil
+}
+
+// Challenge computes the S256 code challenge of verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RandomString returns n random bytes encoded as URL-safe base64.
+func RandomString(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// AuthCodeURL is where the user is sent to authorize the forum.
+func (p *Provider) AuthCodeURL(state, challenge string) string {
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", p.ClientID)
+	values.Set("redirect_uri", p.RedirectURL)
+	values.Set("scope", strings.Join(p.Scopes, " "))
+	values.Set("state", state)
+	values.Set("code_challenge", challenge)
+	values.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + values.Encode()
+}
+
+// Exchange trades an authorization code for an access token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", p.RedirectURL)
+	values.Set("client_id", p.ClientID)
+	values.Set("client_secret", p.ClientSecret)
+	values.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(values.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := p.do(req, &body); err != nil {
+		return "", err
+	}
+	if body.AccessToken == "" {
+		return "", fmt.Errorf("%w: %s", ErrExchange, body.Error)
+	}
+
+	return body.AccessToken, nil
+}
+
+// FetchIdentity loads the account behind accessToken.
+func (p *Provider) FetchIdentity(ctx context.Context, accessToken string) (Identity, error) {
+	switch p.Kind {
+	case KindGitHub:
+		return p.fetchGitHub(ctx, accessToken)
+	default:
+		return p.fetchOIDC(ctx, accessToken)
+	}
+}
+
+func (p *Provider) fetchOIDC(ctx context.Context, accessToken string) (Identity, error) {
+	var info struct {
+		Sub               string `json:"sub"`
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+	}
+	if err := p.get(ctx, p.UserInfoURL, accessToken, &info); err != nil {
+		return Identity{}, err
+	}
+	if info.Sub == "" {
+		return Identity{}, ErrIdentity
+	}
+
+	username := info.PreferredUsername
+	if username == "" {
+		username = info.Name
+	}
+	if username == "" {
+		username, _, _ = strings.Cut(info.Email, "@")
+	}
+
+	return Identity{
+		Subject:       info.Sub,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		Username:      username,
+	}, nil
+}
+
+func (p *Provider) fetchGitHub(ctx context.Context, accessToken string) (Identity, error) {
+	var info struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Email string `json:"email"`
+	}
+	if err := p.get(ctx, p.UserInfoURL, accessToken, &info); err != nil {
+		return Identity{}, err
+	}
+	if info.ID == 0 {
+		return Identity{}, ErrIdentity
+	}
+
+	ident := Identity{
+		Subject:  strconv.FormatInt(info.ID, 10),
+		Email:    info.Email,
+		Username: info.Login,
+	}
+
+	if p.EmailsURL == "" {
+		return ident, nil
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.get(ctx, p.EmailsURL, accessToken, &emails); err != nil {
+		return Identity{}, err
+	}
+	for _, e := range emails {
+		if e.Primary {
+			ident.Email = e.Email
+			ident.EmailVerified = e.Verified
+		}
+	}
+
+	return ident, nil
+}
+
+func (p *Provider) get(ctx context.Context, endpoint, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	if err := p.do(req, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrIdentity, err)
+	}
+	return nil
+}
+
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned %d", ErrExchange, req.URL.Host, resp.StatusCode)
+	}
+
+	return json.Unmarshal(data, v)
+}
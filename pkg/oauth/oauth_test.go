@@ -0,0 +1,193 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// mockIdP is a minimal authorization server issuing one code per
+// authorization request and checking PKCE on exchange.
+type mockIdP struct {
+	mu         sync.Mutex
+	challenges map[string]string
+	server     *httptest.Server
+	userinfo   interface{}
+	emails     interface{}
+}
+
+func newMockIdP(t *testing.T, userinfo, emails interface{}) *mockIdP {
+	m := &mockIdP{challenges: map[string]string{}, userinfo: userinfo, emails: emails}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "client" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		m.mu.Lock()
+		m.challenges["code-1"] = q.Get("code_challenge")
+		m.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code=code-1&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		m.mu.Lock()
+		challenge, ok := m.challenges[r.FormValue("code")]
+		delete(m.challenges, r.FormValue("code"))
+		m.mu.Unlock()
+		if !ok || Challenge(r.FormValue("code_verifier")) != challenge || r.FormValue("client_secret") != "secret" {
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "token-1", "token_type": "bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(m.userinfo)
+	})
+	mux.HandleFunc("/emails", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(m.emails)
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIdP) provider(kind string) *Provider {
+	p := &Provider{
+		Name:         "mock",
+		Kind:         kind,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		AuthURL:      m.server.URL + "/authorize",
+		TokenURL:     m.server.URL + "/token",
+		UserInfoURL:  m.server.URL + "/userinfo",
+		Scopes:       []string{"openid", "email"},
+		RedirectURL:  "http://forum.test/oauth/mock/callback",
+		Client:       m.server.Client(),
+	}
+	if kind == KindGitHub {
+		p.EmailsURL = m.server.URL + "/emails"
+	}
+	return p
+}
+
+// authorize follows the authorization redirect and returns the code and state
+// delivered to the redirect URI.
+func authorize(t *testing.T, p *Provider, state, challenge string) (string, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(p.AuthCodeURL(state, challenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestOIDCFlow(t *testing.T) {
+	idp := newMockIdP(t, map[string]interface{}{
+		"sub":                "abc",
+		"email":              "ann@example.com",
+		"email_verified":     true,
+		"preferred_username": "ann",
+	}, nil)
+	p := idp.provider(KindOIDC)
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := authorize(t, p, "state-1", challenge)
+	if state != "state-1" {
+		t.Fatalf("state = %q, want state-1", state)
+	}
+
+	token, err := p.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ident, err := p.FetchIdentity(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Identity{Subject: "abc", Email: "ann@example.com", EmailVerified: true, Username: "ann"}
+	if ident != want {
+		t.Fatalf("identity = %+v, want %+v", ident, want)
+	}
+}
+
+func TestGitHubFlow(t *testing.T) {
+	idp := newMockIdP(t,
+		map[string]interface{}{"id": 42, "login": "octo", "email": nil},
+		[]map[string]interface{}{
+			{"email": "old@example.com", "primary": false, "verified": true},
+			{"email": "octo@example.com", "primary": true, "verified": true},
+		})
+	p := idp.provider(KindGitHub)
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, p, "s", challenge)
+
+	token, err := p.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ident, err := p.FetchIdentity(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Identity{Subject: "42", Email: "octo@example.com", EmailVerified: true, Username: "octo"}
+	if ident != want {
+		t.Fatalf("identity = %+v, want %+v", ident, want)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	idp := newMockIdP(t, map[string]interface{}{"sub": "abc"}, nil)
+	p := idp.provider(KindOIDC)
+
+	_, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, p, "s", challenge)
+
+	if _, err := p.Exchange(context.Background(), code, "wrong-verifier"); err == nil {
+		t.Fatal("exchange with wrong verifier succeeded")
+	}
+}
+
+func TestChallengeMatchesRFC7636(t *testing.T) {
+	// Appendix B of RFC 7636.
+	got := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Fatalf("challenge = %s", got)
+	}
+}
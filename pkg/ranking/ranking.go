@@ -0,0 +1,102 @@
+// Package ranking scores posts for the sorted listings of the home page.
+// Scores only change on reactions and comments, so they are stored with the
+// post and the listings sort on them in SQL.
+package ranking
+
+import (
+	"math"
+	"time"
+)
+
+// Orders the home page can be sorted in.
+const (
+	SortHot           = "hot"
+	SortNew           = "new"
+	SortTop           = "top"
+	SortControversial = "controversial"
+)
+
+// Periods top and controversial listings can be limited to.
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodAll   = "all"
+)
+
+const (
+	// hotDecay is how many seconds of age cost a post as much as a tenfold
+	// drop of its score: a post needs ten times the score to rank as high as
+	// one posted 12.5 hours later.
+	hotDecay = 45000
+	// commentWeight is what a comment adds to the hot score of a post,
+	// relative to a like.
+	commentWeight = 0.5
+)
+
+// epoch is where the time part of hot scores starts. It only shifts all
+// scores by the same amount.
+var epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Score is the net score of a post with ups positive and downs negative
+// reaction points.
+func Score(ups, downs int) int {
+	return ups - downs
+}
+
+// Hot ranks a post by its score and its comments, decayed by age. The score
+// counts logarithmically, so the first reactions matter most, and every post
+// starts out higher than the posts before it, so the score of a post never
+// has to be updated as time passes.
+func Hot(ups, downs, comments int, created time.Time) float64 {
+	score := float64(Score(ups, downs)) + commentWeight*float64(comments)
+
+	order := math.Log10(math.Max(math.Abs(score), 1))
+	sign := 0.0
+	if score > 0 {
+		sign = 1
+	} else if score < 0 {
+		sign = -1
+	}
+
+	return sign*order + created.Sub(epoch).Seconds()/hotDecay
+}
+
+// Controversy ranks a post by how many reacted and how evenly they split
+// between ups and downs. Posts nobody disagrees on score 0.
+func Controversy(ups, downs int) float64 {
+	if ups <= 0 || downs <= 0 {
+		return 0
+	}
+
+	magnitude := float64(ups + downs)
+	balance := float64(ups) / float64(downs)
+	if ups > downs {
+		balance = float64(downs) / float64(ups)
+	}
+
+	return math.Pow(magnitude, balance)
+}
+
+// Since returns when the posts of period start as seen at now. It is false
+// for PeriodAll and unknown periods, which do not limit the listing.
+func Since(period string, now time.Time) (time.Time, bool) {
+	switch period {
+	case PeriodDay:
+		return now.AddDate(0, 0, -1), true
+	case PeriodWeek:
+		return now.AddDate(0, 0, -7), true
+	case PeriodMonth:
+		return now.AddDate(0, -1, 0), true
+	}
+	return time.Time{}, false
+}
+
+// ValidSort reports whether sort is one of the known orders.
+func ValidSort(sort string) bool {
+	switch sort {
+	case SortHot, SortNew, SortTop, SortControversial:
+		return true
+	}
+	return false
+}
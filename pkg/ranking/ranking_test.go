@@ -0,0 +1,118 @@
+package ranking
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	if got := Score(5, 2); got != 3 {
+		t.Fatalf("Score(5, 2) = %d, want 3", got)
+	}
+	if got := Score(0, 4); got != -4 {
+		t.Fatalf("Score(0, 4) = %d, want -4", got)
+	}
+}
+
+func TestHotPrefersNewerPosts(t *testing.T) {
+	older := Hot(10, 0, 0, epoch.Add(24*time.Hour))
+	newer := Hot(10, 0, 0, epoch.Add(48*time.Hour))
+	if newer <= older {
+		t.Fatalf("newer post scores %v, older %v", newer, older)
+	}
+}
+
+func TestHotPrefersHigherScores(t *testing.T) {
+	created := epoch.Add(time.Hour)
+	cases := []struct {
+		name          string
+		better, worse float64
+	}{
+		{"likes", Hot(10, 0, 0, created), Hot(1, 0, 0, created)},
+		{"dislikes", Hot(5, 0, 0, created), Hot(5, 3, 0, created)},
+		{"comments", Hot(1, 0, 6, created), Hot(1, 0, 0, created)},
+		{"negative", Hot(0, 0, 0, created), Hot(0, 10, 0, created)},
+	}
+	for _, c := range cases {
+		if c.better <= c.worse {
+			t.Errorf("%s: %v does not rank above %v", c.name, c.better, c.worse)
+		}
+	}
+}
+
+func TestHotDecay(t *testing.T) {
+	created := epoch.Add(time.Hour)
+	// Ten times the score is worth hotDecay seconds of age.
+	tenfold := Hot(100, 0, 0, created)
+	later := Hot(10, 0, 0, created.Add(hotDecay*time.Second))
+	if diff := tenfold - later; diff > 1e-9 || diff < -1e-9 {
+		t.Fatalf("tenfold score %v, later post %v, want equal", tenfold, later)
+	}
+}
+
+func TestHotIgnoresScoresBelowOne(t *testing.T) {
+	created := epoch.Add(time.Hour)
+	if Hot(0, 0, 0, created) != Hot(1, 0, 0, created) {
+		t.Fatal("a score of 1 ranks differently from 0")
+	}
+}
+
+func TestControversy(t *testing.T) {
+	cases := []struct {
+		ups, downs int
+		want       float64
+	}{
+		{0, 0, 0},
+		{10, 0, 0},
+		{0, 10, 0},
+		{5, 5, 10},
+		{1, 1, 2},
+	}
+	for _, c := range cases {
+		if got := Controversy(c.ups, c.downs); got != c.want {
+			t.Errorf("Controversy(%d, %d) = %v, want %v", c.ups, c.downs, got, c.want)
+		}
+	}
+
+	if Controversy(8, 2) != Controversy(2, 8) {
+		t.Error("Controversy is not symmetric")
+	}
+	if Controversy(5, 5) <= Controversy(9, 1) {
+		t.Error("an even split is not more controversial than a lopsided one")
+	}
+	if Controversy(50, 50) <= Controversy(5, 5) {
+		t.Error("more reactions are not more controversial")
+	}
+}
+
+func TestSince(t *testing.T) {
+	now := time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		period string
+		want   time.Time
+		ok     bool
+	}{
+		{PeriodDay, time.Date(2024, time.March, 30, 12, 0, 0, 0, time.UTC), true},
+		{PeriodWeek, time.Date(2024, time.March, 24, 12, 0, 0, 0, time.UTC), true},
+		{PeriodMonth, time.Date(2024, time.March, 2, 12, 0, 0, 0, time.UTC), true},
+		{PeriodAll, time.Time{}, false},
+		{"year", time.Time{}, false},
+	}
+	for _, c := range cases {
+		got, ok := Since(c.period, now)
+		if ok != c.ok || !got.Equal(c.want) {
+			t.Errorf("Since(%q) = %v, %v, want %v, %v", c.period, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestValidSort(t *testing.T) {
+	for _, sort := range []string{SortHot, SortNew, SortTop, SortControversial} {
+		if !ValidSort(sort) {
+			t.Errorf("ValidSort(%q) = false", sort)
+		}
+	}
+	if ValidSort("best") {
+		t.Error(`ValidSort("best") = true`)
+	}
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"database/sql"
+	"forum/pkg/models"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	bookmarkFolderLength = 50
+	bookmarkNoteLength   = 500
+)
+
+type BookmarkService struct {
+	db    *sql.DB
+	posts *PostService
+}
+
+func NewBookmarkService(db *sql.DB, posts *PostService) *BookmarkService {
+	return &BookmarkService{db: db, posts: posts}
+}
+
+// ToggleBookmark saves the post or comment of bookmark for bookmark.UID, or
+// removes the bookmark when it was already saved. It reports whether the
+// subject is bookmarked afterwards.
+func (s *BookmarkService) ToggleBookmark(bookmark models.Bookmark) (bool, error) {
+	if err := s.checkSubject(bookmark); err != nil {
+		return false, err
+	}
+
+	folder, note, err := cleanBookmark(bookmark.Folder, bookmark.Note)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := s.db.Exec("DELETE FROM bookmarks WHERE uid = $1 AND post_id = $2 AND COALESCE(comment_id, 0) = $3",
+		bookmark.UID, bookmark.PostID, bookmark.CommentID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected > 0 {
+		return false, nil
+	}
+
+	_, err = s.db.Exec("INSERT INTO bookmarks (uid, post_id, comment_id, folder, note, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		bookmark.UID, bookmark.PostID, nullableID(bookmark.CommentID), folder, note, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UpdateBookmark changes the folder and the note of a bookmark of uid.
+func (s *BookmarkService) UpdateBookmark(uid string, ID int, folder, note string) error {
+	folder, note, err := cleanBookmark(folder, note)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec("UPDATE bookmarks SET folder = $1, note = $2 WHERE id = $3 AND uid = $4", folder, note, ID, uid)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.NotFoundAnything
+	}
+
+	return nil
+}
+
+func (s *BookmarkService) DeleteBookmark(uid string, ID int) error {
+	result, err := s.db.Exec("DELETE FROM bookmarks WHERE id = $1 AND uid = $2", ID, uid)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.NotFoundAnything
+	}
+
+	return nil
+}
+
+// GetBookmarks returns limit bookmarks of uid matching filter, newest
+// first, starting at offset, and how many match in total. Bookmarks in
+// forums the user can no longer read are left out.
+func (s *BookmarkService) GetBookmarks(uid string, filter models.BookmarkFilter, limit, offset int) ([]models.Bookmark, int, error) {
+	var role string
+	err := s.db.QueryRow("SELECT role FROM users WHERE id = $1", uid).Scan(&role)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	forumIDs, err := readableForumIDs(s.db, role)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := `
+		FROM bookmarks b
+		JOIN posts p ON p.id = b.post_id
+		LEFT JOIN comments c ON c.id = b.comment_id
+		WHERE b.uid = $1 AND p.forum_id IN (` + intsToList(forumIDs) + `)`
+	args := []interface{}{uid}
+
+	if filter.Folder != "" {
+		args = append(args, filter.Folder)
+		where += " AND b.folder = $" + strconv.Itoa(len(args))
+	}
+	if filter.CategoryID != 0 {
+		args = append(args, filter.CategoryID)
+		where += " AND b.post_id IN (SELECT post_id FROM post_cats WHERE category_id = $" + strconv.Itoa(len(args)) + ")"
+	}
+
+	var total int
+	err = s.db.QueryRow("SELECT COUNT(*)"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+	rows, err := s.db.Query(`
+		SELECT b.id, b.uid, b.post_id, COALESCE(b.comment_id, 0), b.folder, b.note, b.created_at, p.title, COALESCE(c.content, '')`+where+`
+		ORDER BY b.created_at DESC, b.id DESC
+		LIMIT $`+strconv.Itoa(len(args)-1)+` OFFSET $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var bookmarks []models.Bookmark
+	var postIDs []int
+	for rows.Next() {
+		var b models.Bookmark
+		err := rows.Scan(&b.ID, &b.UID, &b.PostID, &b.CommentID, &b.Folder, &b.Note, &b.CreatedAt, &b.Title, &b.Comment)
+		if err != nil {
+			return nil, 0, err
+		}
+		bookmarks = append(bookmarks, b)
+		postIDs = append(postIDs, b.PostID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	cats, err := s.posts.getCatsForPosts(postIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range bookmarks {
+		bookmarks[i].Cats = cats[bookmarks[i].PostID]
+	}
+
+	return bookmarks, total, nil
+}
+
+// GetFolders returns the folder names uid has used, in alphabetical order.
+func (s *BookmarkService) GetFolders(uid string) ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT folder FROM bookmarks WHERE uid = $1 AND folder != '' ORDER BY folder", uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var folders []string
+	for rows.Next() {
+		var folder string
+		if err := rows.Scan(&folder); err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+
+	return folders, rows.Err()
+}
+
+// GetBookmarkedIDs tells whether uid bookmarked postID and which of its
+// comments they bookmarked.
+func (s *BookmarkService) GetBookmarkedIDs(uid string, postID int) (bool, map[int]bool, error) {
+	rows, err := s.db.Query("SELECT COALESCE(comment_id, 0) FROM bookmarks WHERE uid = $1 AND post_id = $2", uid, postID)
+	if err != nil {
+		return false, nil, err
+	}
+	defer rows.Close()
+
+	post := false
+	comments := make(map[int]bool)
+	for rows.Next() {
+		var commentID int
+		if err := rows.Scan(&commentID); err != nil {
+			return false, nil, err
+		}
+		if commentID == 0 {
+			post = true
+		} else {
+			comments[commentID] = true
+		}
+	}
+
+	return post, comments, rows.Err()
+}
+
+// checkSubject verifies that the bookmarked post exists and is readable and
+// that the comment, if any, belongs to it and is readable too.
+func (s *BookmarkService) checkSubject(bookmark models.Bookmark) error {
+	if bookmark.CommentID == 0 {
+		return checkPostAccess(s.db, bookmark.UID, bookmark.PostID, forumActionRead)
+	}
+
+	return checkCommentAccess(s.db, bookmark.UID, bookmark.PostID, bookmark.CommentID, forumActionRead)
+}
+
+func cleanBookmark(folder, note string) (string, string, error) {
+	folder = strings.TrimSpace(folder)
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(folder) > bookmarkFolderLength || utf8.RuneCountInString(note) > bookmarkNoteLength {
+		return "", "", models.ValueMismatch
+	}
+	return folder, note, nil
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"database/sql"
+	"forum/pkg/models"
+	"strconv"
+	"strings"
+)
+
+type CategoryService struct {
+	db *sql.DB
+}
+
+func NewCategoryService(db *sql.DB) *CategoryService {
+	return &CategoryService{db: db}
+}
+
+func (s *CategoryService) CreateCategory(cat models.Category) (int, error) {
+	if cat.Slug == "" {
+		cat.Slug = slugify(cat.Name)
+	}
+	if cat.Color == "" {
+		cat.Color = "#888888"
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Names without any ASCII letter or digit get a slug from their ID.
+	var slug interface{}
+	if cat.Slug != "" {
+		slug = cat.Slug
+	}
+
+	result, err := tx.Exec("INSERT INTO categories (name, slug, description, color, sort_order) VALUES ($1, $2, $3, $4, $5)",
+		cat.Name, slug, cat.Description, cat.Color, cat.SortOrder)
+	if err != nil {
+		if err.Error() == "UNIQUE constraint failed: categories.slug" {
+			return 0, models.UniqueConstraintSlug
+		}
+		return 0, err
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if cat.Slug == "" {
+		_, err := tx.Exec("UPDATE categories SET slug = $1 WHERE id = $2", fallbackSlug(int(newID)), newID)
+		if err != nil {
+			if err.Error() == "UNIQUE constraint failed: categories.slug" {
+				return 0, models.UniqueConstraintSlug
+			}
+			return 0, err
+		}
+	}
+
+	return int(newID), tx.Commit()
+}
+
+func (s *CategoryService) UpdateCategory(cat models.Category) error {
+	if cat.Slug == "" {
+		cat.Slug = slugify(cat.Name)
+	}
+	if cat.Slug == "" {
+		cat.Slug = fallbackSlug(cat.ID)
+	}
+
+	result, err := s.db.Exec("UPDATE categories SET name = $1, slug = $2, description = $3, color = $4, sort_order = $5 WHERE id = $6",
+		cat.Name, cat.Slug, cat.Description, cat.Color, cat.SortOrder, cat.ID)
+	if err != nil {
+		if err.Error() == "UNIQUE constraint failed: categories.slug" {
+			return models.UniqueConstraintSlug
+		}
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.NotFoundAnything
+	}
+
+	return nil
+}
+
+// ReorderCategories sets sort_order of the given categories to their position in ids.
+func (s *CategoryService) ReorderCategories(ids []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, id := range ids {
+		_, err := tx.Exec("UPDATE categories SET sort_order = $1 WHERE id = $2", i+1, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// MergeCategories moves every post of category src into dst and removes src.
+func (s *CategoryService) MergeCategories(srcID, dstID int) error {
+	if srcID == dstID {
+		return models.ValueMismatch
+	}
+
+	if _, err := s.GetCategoryByID(srcID); err != nil {
+		return err
+	}
+	if _, err := s.GetCategoryByID(dstID); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO post_cats (post_id, category_id) SELECT post_id, $1 FROM post_cats WHERE category_id = $2", dstID, srcID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM post_cats WHERE category_id = $1", srcID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO digest_categories (uid, category_id) SELECT uid, $1 FROM digest_categories WHERE category_id = $2", dstID, srcID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM digest_categories WHERE category_id = $1", srcID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO follows (uid, kind, target_id, state, created_at) SELECT uid, kind, CAST($1 AS TEXT), state, created_at FROM follows WHERE kind = 'category' AND target_id = CAST($2 AS TEXT)", dstID, srcID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM follows WHERE kind = 'category' AND target_id = CAST($1 AS TEXT)", srcID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM categories WHERE id = $1", srcID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *CategoryService) DeleteCategory(ID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM post_cats WHERE category_id = $1", ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM digest_categories WHERE category_id = $1", ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM follows WHERE kind = 'category' AND target_id = CAST($1 AS TEXT)", ID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM categories WHERE id = $1", ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.NotFoundAnything
+	}
+
+	return tx.Commit()
+}
+
+func (s *CategoryService) GetCategoryByID(ID int) (models.Category, error) {
+	var cat models.Category
+	err := s.db.QueryRow("SELECT id, name, slug, description, color, sort_order FROM categories WHERE id = $1", ID).Scan(
+		&cat.ID, &cat.Name, &cat.Slug, &cat.Description, &cat.Color, &cat.SortOrder)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.Category{}, models.NotFoundAnything
+		default:
+			return models.Category{}, err
+		}
+	}
+
+	return cat, nil
+}
+
+func (s *CategoryService) GetCategoryBySlug(slug string) (models.Category, error) {
+	var cat models.Category
+	err := s.db.QueryRow("SELECT id, name, slug, description, color, sort_order FROM categories WHERE slug = $1", slug).Scan(
+		&cat.ID, &cat.Name, &cat.Slug, &cat.Description, &cat.Color, &cat.SortOrder)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.Category{}, models.NotFoundAnything
+		default:
+			return models.Category{}, err
+		}
+	}
+
+	return cat, nil
+}
+
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// fallbackSlug is the slug of category ID when its name has nothing
+// slugify can keep.
+func fallbackSlug(ID int) string {
+	return "category-" + strconv.Itoa(ID)
+}
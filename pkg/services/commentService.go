@@ -2,32 +2,295 @@ package services
 
 import (
 	"database/sql"
+	"forum/pkg/events"
+	"forum/pkg/markdown"
 	"forum/pkg/models"
+	"forum/pkg/utils/logger"
+	"strconv"
 )
 
+const commentColumns = "id, uid, post_id, content, created_at, content_html, html_version, pending"
+
 type CommentService struct {
-	db *sql.DB
+	db            *sql.DB
+	notifications *NotificationService
+	hub           *events.Hub
+	webhooks      *WebhookService
+}
+
+func NewCommentService(db *sql.DB, notifications *NotificationService, hub *events.Hub, webhooks *WebhookService) *CommentService {
+	return &CommentService{db: db, notifications: notifications, hub: hub, webhooks: webhooks}
 }
 
-func NewCommentService(db *sql.DB) *CommentService {
-	return &CommentService{db: db}
+func (s *CommentService) SubmitCommentForPost(comment models.Comment) (int, error) {
+	if err := checkPostAccess(s.db, comment.UID, comment.PostID, forumActionPost); err != nil {
+		return 0, err
+	}
+
+	if containsLink(comment.Content) {
+		if err := checkTrust(s.db, comment.UID, models.TrustLevel.CanPostLinks); err != nil {
+			return 0, err
+		}
+	}
+
+	pending, err := needsReview(s.db, comment.UID)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO comments (uid, post_id, content, content_html, html_version, pending) VALUES ($1, $2, $3, $4, $5, $6)",
+		comment.UID, comment.PostID, comment.Content, markdown.Render(comment.Content), markdown.Version, pending)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if pending {
+		if err := queueForReview(tx, comment.PostID, int(newID)); err != nil {
+			return 0, err
+		}
+	} else if err := refreshPostScore(tx, comment.PostID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if pending {
+		return int(newID), nil
+	}
+
+	comment.ID = int(newID)
+	s.announce(comment)
+
+	return int(newID), nil
+}
+
+// ApproveComment publishes the comment with ID that was held for review
+// and returns it.
+func (s *CommentService) ApproveComment(ID int) (models.Comment, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.Comment{}, err
+	}
+	defer tx.Rollback()
+
+	if err := approveReview(tx, "comments", ID); err != nil {
+		return models.Comment{}, err
+	}
+
+	comment, err := scanComment(tx.QueryRow("SELECT "+commentColumns+" FROM comments WHERE id = $1", ID))
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	if err := refreshPostScore(tx, comment.PostID); err != nil {
+		return models.Comment{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Comment{}, err
+	}
+
+	s.announce(comment)
+
+	return comment, nil
 }
 
-func (s *CommentService) SubmitCommentForPost(comment models.Comment) error {
-	_, err := s.db.Exec("INSERT INTO comments (uid, post_id, content) VALUES ($1, $2, $3)",
-		comment.UID, comment.PostID, comment.Content)
+// announce tells the live updates, the webhooks, the author of the post and
+// the followers of the thread about the published comment. The comment is
+// saved already, so failures are only logged.
+func (s *CommentService) announce(comment models.Comment) {
+	if err := s.publish(comment.ID); err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
 
-	return err
+	if err := s.notify(comment); err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
 }
 
-func (s *CommentService) DeleteComment(ID int) error {
-	_, err := s.db.Exec("DELETE FROM comments WHERE id = $1", ID)
+// notify tells the author and the followers of the thread about comment.
+func (s *CommentService) notify(comment models.Comment) error {
+	var authorID string
+	err := s.db.QueryRow("SELECT uid FROM posts WHERE id = $1", comment.PostID).Scan(&authorID)
+	if err != nil {
+		return err
+	}
 
-	return err
+	err = s.notifications.Notify(models.Notification{
+		UID:       authorID,
+		ActorUID:  comment.UID,
+		Type:      models.NotifyReply,
+		PostID:    comment.PostID,
+		CommentID: comment.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.notifyFollowers(comment, authorID)
 }
 
-func (s *CommentService) GetCommentsByPostID(postID int) ([]models.Comment, error) {
-	rows, err := s.db.Query("SELECT * FROM comments WHERE post_id = $1", postID)
+// notifyFollowers tells the users following the thread of comment about it.
+// The author of the thread is left out as they get a reply notification.
+func (s *CommentService) notifyFollowers(comment models.Comment, threadAuthor string) error {
+	rows, err := s.db.Query("SELECT uid FROM follows WHERE kind = $1 AND target_id = $2 AND state = $3",
+		models.FollowThread, strconv.Itoa(comment.PostID), models.FollowStateFollow)
+	if err != nil {
+		return err
+	}
+
+	var followers []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return err
+		}
+		followers = append(followers, uid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, uid := range followers {
+		if uid == threadAuthor {
+			continue
+		}
+
+		err := checkPostAccess(s.db, uid, comment.PostID, forumActionRead)
+		if err == models.ErrForbidden {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = s.notifications.Notify(models.Notification{
+			UID:       uid,
+			ActorUID:  comment.UID,
+			Type:      models.NotifyFollow,
+			PostID:    comment.PostID,
+			CommentID: comment.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publish pushes the comment with ID to the live updates of its post and to
+// the webhooks.
+func (s *CommentService) publish(ID int) error {
+	comment, err := scanComment(s.db.QueryRow("SELECT "+commentColumns+" FROM comments WHERE id = $1", ID))
+	if err != nil {
+		return err
+	}
+
+	author, err := usernameByID(s.db, comment.UID)
+	if err != nil {
+		return err
+	}
+
+	err = s.webhooks.EmitForComment(comment.PostID, comment.ID, models.WebhookCommentCreated, map[string]interface{}{
+		"id":     comment.ID,
+		"postId": comment.PostID,
+		"author": author,
+		"url":    s.webhooks.Link("/post/" + strconv.Itoa(comment.PostID) + "#comment-" + strconv.Itoa(comment.ID)),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.hub.Publish(events.PostTopic(comment.PostID), eventComment, commentEvent{
+		ID:        comment.ID,
+		Author:    author,
+		HTML:      comment.ContentHTML,
+		CreatedAt: comment.CreatedAt,
+	})
+}
+
+// DeleteComment removes the comment with ID on behalf of user by. The author
+// is notified when someone else removed the comment.
+func (s *CommentService) DeleteComment(ID int, by string) error {
+	comment, err := scanComment(s.db.QueryRow("SELECT "+commentColumns+" FROM comments WHERE id = $1", ID))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.NotFoundAnything
+		default:
+			return err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE users SET reputation = reputation - (
+			SELECT COALESCE(SUM(weight), 0) FROM reactions
+			WHERE target = 'comment' AND target_id = $1 AND user_id != users.id)
+		WHERE id = $2`, ID, comment.UID)
+	if err != nil {
+		return err
+	}
+
+	// Reactions name the comment without a foreign key; mentions, reports
+	// and bookmarks go with ON DELETE CASCADE.
+	_, err = tx.Exec("DELETE FROM reactions WHERE target = 'comment' AND target_id = $1", ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM comments WHERE id = $1", ID)
+	if err != nil {
+		return err
+	}
+
+	if err := refreshPostScore(tx, comment.PostID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	err = s.notifications.Notify(models.Notification{
+		UID:       comment.UID,
+		ActorUID:  by,
+		Type:      models.NotifyModeration,
+		PostID:    comment.PostID,
+		CommentID: comment.ID,
+	})
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
+
+	return nil
+}
+
+// GetCommentsByPostID returns the comments on postID, oldest first. Held
+// comments are only included for their author and the staff.
+func (s *CommentService) GetCommentsByPostID(postID int, viewer models.User) ([]models.Comment, error) {
+	rows, err := s.db.Query("SELECT "+commentColumns+" FROM comments WHERE post_id = $1 AND (pending = 0 OR uid = $2 OR $3) ORDER BY id",
+		postID, viewer.ID, viewer.IsStaff())
 	if err != nil {
 		return nil, err
 	}
@@ -36,13 +299,7 @@ func (s *CommentService) GetCommentsByPostID(postID int) ([]models.Comment, erro
 	var comments []models.Comment
 
 	for rows.Next() {
-		comment := models.Comment{}
-
-		err := rows.Scan(&comment.ID,
-			&comment.UID,
-			&comment.PostID,
-			&comment.Content,
-		)
+		comment, err := scanComment(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -56,3 +313,68 @@ func (s *CommentService) GetCommentsByPostID(postID int) ([]models.Comment, erro
 
 	return comments, nil
 }
+
+// GetCommentsPageByUID returns limit comments of user UID on posts in
+// forumIDs, newest first, starting at offset, and how many such comments
+// there are in total.
+func (s *CommentService) GetCommentsPageByUID(UID string, forumIDs []int, limit, offset int) ([]models.Comment, int, error) {
+	where := " FROM comments WHERE uid = $1 AND pending = 0 AND post_id IN (SELECT id FROM posts WHERE pending = 0 AND forum_id IN (" + intsToList(forumIDs) + "))"
+
+	var total int
+	err := s.db.QueryRow("SELECT COUNT(*)"+where, UID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query("SELECT "+commentColumns+where+" ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3", UID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		comments = append(comments, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return comments, total, nil
+}
+
+// RefreshHTML re-renders the cached HTML of comments rendered by an older
+// version of the Markdown renderer.
+func (s *CommentService) RefreshHTML() error {
+	return refreshHTML(s.db, "comments")
+}
+
+func scanComment(row rowScanner) (models.Comment, error) {
+	var comment models.Comment
+	var version int
+	err := row.Scan(&comment.ID,
+		&comment.UID,
+		&comment.PostID,
+		&comment.Content,
+		&comment.CreatedAt,
+		&comment.ContentHTML,
+		&version,
+		&comment.Pending,
+	)
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	if version != markdown.Version {
+		comment.ContentHTML = markdown.Render(comment.Content)
+	}
+
+	return comment, nil
+}
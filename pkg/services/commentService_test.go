@@ -0,0 +1,78 @@
+package services
+
+import (
+	"forum/pkg/events"
+	"forum/pkg/models"
+	"testing"
+)
+
+func TestHeldCommentsWaitForApproval(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec(`
+		INSERT INTO users (id, username, email, password, email_verified, created_at) VALUES
+			('u1', 'ann', 'ann@example.com', 'x', 1, datetime('now', '-10 days')),
+			('u2', 'bob', 'bob@example.com', 'x', 1, datetime('now')),
+			('u3', 'eve', 'eve@example.com', 'x', 1, datetime('now'));
+		UPDATE users SET role = 'moderator' WHERE id = 'u3';
+		INSERT INTO posts (id, title, content, uid, forum_id) VALUES (1, 'post', 'x', 'u1', (SELECT id FROM forums WHERE slug = 'general'));`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := events.NewHub()
+	s := NewCommentService(db, NewNotificationService(db, hub), hub, NewWebhookService(db, "http://forum.test"))
+
+	// bob joined today, so his comment is held; ann's is not.
+	held, err := s.SubmitCommentForPost(models.Comment{UID: "u2", PostID: 1, Content: "held"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SubmitCommentForPost(models.Comment{UID: "u1", PostID: 1, Content: "live"}); err != nil {
+		t.Fatal(err)
+	}
+
+	visible := func(viewer models.User) int {
+		t.Helper()
+		comments, err := s.GetCommentsByPostID(1, viewer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(comments)
+	}
+	ann := models.User{ID: "u1", Role: models.RoleUser}
+	bob := models.User{ID: "u2", Role: models.RoleUser}
+	eve := models.User{ID: "u3", Role: models.RoleModerator}
+	if got := visible(ann); got != 1 {
+		t.Fatalf("ann sees %d comments, want 1", got)
+	}
+	if got, want := visible(bob), 2; got != want {
+		t.Fatalf("bob sees %d comments, want %d", got, want)
+	}
+	if got, want := visible(eve), 2; got != want {
+		t.Fatalf("eve sees %d comments, want %d", got, want)
+	}
+
+	var reports int
+	if err := db.QueryRow("SELECT COUNT(*) FROM reports WHERE comment_id = $1", held).Scan(&reports); err != nil {
+		t.Fatal(err)
+	}
+	if reports != 1 {
+		t.Fatalf("%d review reports, want 1", reports)
+	}
+
+	if _, err := s.ApproveComment(held); err != nil {
+		t.Fatal(err)
+	}
+	if got := visible(ann); got != 2 {
+		t.Fatalf("ann sees %d comments after approval, want 2", got)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM reports").Scan(&reports); err != nil {
+		t.Fatal(err)
+	}
+	if reports != 0 {
+		t.Fatalf("%d reports left after approval, want 0", reports)
+	}
+	if _, err := s.ApproveComment(held); err != models.NotFoundAnything {
+		t.Fatalf("approving twice = %v, want %v", err, models.NotFoundAnything)
+	}
+}
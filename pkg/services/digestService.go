@@ -0,0 +1,403 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"forum/pkg/mailer"
+	"forum/pkg/models"
+	"forum/pkg/utils/tokens"
+	htmltemplate "html/template"
+	"net/url"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	digestUnsubscribePurpose = "digest-unsubscribe"
+	// digestUnsubscribeTTL keeps the links of old digests working.
+	digestUnsubscribeTTL = 365 * 24 * time.Hour
+	// digestSectionSize is how many threads each section of a digest lists.
+	digestSectionSize = 10
+	digestTopSize     = 5
+
+	digestTextTemplate = "./ui/templates/email/digest.txt"
+	digestHTMLTemplate = "./ui/templates/email/digest.html"
+
+	// sqliteTime is how CURRENT_TIMESTAMP defaults are written, so that
+	// they compare as strings.
+	sqliteTime = "2006-01-02 15:04:05"
+)
+
+type DigestService struct {
+	db      *sql.DB
+	mailer  mailer.Mailer
+	secret  []byte
+	baseURL string
+}
+
+func NewDigestService(db *sql.DB, mail mailer.Mailer, secret []byte, baseURL string) *DigestService {
+	return &DigestService{db: db, mailer: mail, secret: secret, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (s *DigestService) GetSettings(uid string) (models.DigestSettings, error) {
+	var settings models.DigestSettings
+	err := s.db.QueryRow("SELECT frequency FROM digest_subscriptions WHERE uid = $1", uid).Scan(&settings.Frequency)
+	if err != nil && err != sql.ErrNoRows {
+		return models.DigestSettings{}, err
+	}
+
+	rows, err := s.db.Query("SELECT category_id FROM digest_categories WHERE uid = $1 ORDER BY category_id", uid)
+	if err != nil {
+		return models.DigestSettings{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return models.DigestSettings{}, err
+		}
+		settings.Categories = append(settings.Categories, id)
+	}
+
+	return settings, rows.Err()
+}
+
+// SetSettings stores the digest settings of uid. A user who turns digests on
+// or changes their frequency gets the first one in the next period, covering
+// what happened from now on.
+func (s *DigestService) SetSettings(uid string, settings models.DigestSettings) error {
+	switch settings.Frequency {
+	case models.DigestOff, models.DigestDaily, models.DigestWeekly:
+	default:
+		return models.ValueMismatch
+	}
+
+	current, err := s.GetSettings(uid)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if settings.Frequency == models.DigestOff {
+		_, err = tx.Exec("DELETE FROM digest_subscriptions WHERE uid = $1", uid)
+		if err != nil {
+			return err
+		}
+	} else if settings.Frequency != current.Frequency {
+		_, err = tx.Exec("INSERT INTO digest_subscriptions (uid, frequency, last_sent_at) VALUES ($1, $2, $3) ON CONFLICT(uid) DO UPDATE SET frequency = excluded.frequency, last_sent_at = excluded.last_sent_at",
+			uid, settings.Frequency, now)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT OR IGNORE INTO digest_deliveries (uid, period, created_at) VALUES ($1, $2, $3)", uid, digestPeriod(settings.Frequency, now), now)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM digest_categories WHERE uid = $1", uid)
+	if err != nil {
+		return err
+	}
+	for _, id := range settings.Categories {
+		_, err = tx.Exec("INSERT OR IGNORE INTO digest_categories (uid, category_id) SELECT $1, id FROM categories WHERE id = $2", uid, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UnsubscribeLink returns the signed link that turns off the digests of uid
+// without logging in.
+func (s *DigestService) UnsubscribeLink(uid string) string {
+	token := tokens.Sign(s.secret, digestUnsubscribePurpose, uid, time.Now().Add(digestUnsubscribeTTL))
+	return s.baseURL + "/digest/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+// CheckUnsubscribeToken returns the user an unsubscribe token was issued to.
+func (s *DigestService) CheckUnsubscribeToken(token string) (string, error) {
+	return tokens.Verify(s.secret, digestUnsubscribePurpose, token)
+}
+
+// Unsubscribe turns off the digests of the user token was issued to.
+func (s *DigestService) Unsubscribe(token string) error {
+	uid, err := s.CheckUnsubscribeToken(token)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("DELETE FROM digest_subscriptions WHERE uid = $1", uid)
+	return err
+}
+
+// Run sends the digests that are due every interval until the process
+// exits. Errors are passed to logError and do not stop the loop.
+func (s *DigestService) Run(interval time.Duration, logError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.SendDue(time.Now()); err != nil {
+			logError(err)
+		}
+		<-ticker.C
+	}
+}
+
+type digestSubscriber struct {
+	user       models.User
+	frequency  string
+	lastSentAt time.Time
+}
+
+// SendDue mails every subscriber who has not had a digest for the period
+// holding now. A period is claimed in digest_deliveries before the mail goes
+// out, so a user gets at most one digest per period even when several
+// instances run the job; the claim is dropped again when sending fails.
+func (s *DigestService) SendDue(now time.Time) error {
+	now = now.UTC()
+
+	rows, err := s.db.Query(`
+		SELECT u.id, u.username, u.email, u.role, d.frequency, d.last_sent_at
+		FROM digest_subscriptions d
+		JOIN users u ON u.id = d.uid
+		WHERE u.email_verified = 1`)
+	if err != nil {
+		return err
+	}
+
+	var subscribers []digestSubscriber
+	for rows.Next() {
+		var sub digestSubscriber
+		var lastSentAt sql.NullTime
+		if err := rows.Scan(&sub.user.ID, &sub.user.Username, &sub.user.Email, &sub.user.Role, &sub.frequency, &lastSentAt); err != nil {
+			rows.Close()
+			return err
+		}
+		sub.lastSentAt = lastSentAt.Time
+		subscribers = append(subscribers, sub)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, sub := range subscribers {
+		if err := s.sendDigest(sub, now); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (s *DigestService) sendDigest(sub digestSubscriber, now time.Time) error {
+	period := digestPeriod(sub.frequency, now)
+
+	result, err := s.db.Exec("INSERT OR IGNORE INTO digest_deliveries (uid, period, created_at) VALUES ($1, $2, $3)", sub.user.ID, period, now)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return nil
+	}
+
+	since := sub.lastSentAt
+	if since.IsZero() {
+		since = now.Add(-digestLength(sub.frequency))
+	}
+
+	digest, err := s.BuildDigest(sub.user, sub.frequency, since)
+	if err == nil && !digest.Empty() {
+		err = s.send(sub.user, digest)
+	}
+	if err != nil {
+		if _, delErr := s.db.Exec("DELETE FROM digest_deliveries WHERE uid = $1 AND period = $2", sub.user.ID, period); delErr != nil {
+			return delErr
+		}
+		return err
+	}
+
+	_, err = s.db.Exec("UPDATE digest_subscriptions SET last_sent_at = $1 WHERE uid = $2", now, sub.user.ID)
+	return err
+}
+
+// BuildDigest collects what happened since since that user may read.
+func (s *DigestService) BuildDigest(user models.User, frequency string, since time.Time) (models.Digest, error) {
+	digest := models.Digest{
+		Username:       user.Username,
+		Frequency:      frequency,
+		Since:          since,
+		SettingsURL:    s.baseURL + "/settings/digest",
+		UnsubscribeURL: s.UnsubscribeLink(user.ID),
+	}
+	after := since.UTC().Format(sqliteTime)
+	listed := make(map[int]bool)
+
+	var err error
+	digest.Posts, err = s.collect(user, listed, digestSectionSize, `
+		SELECT DISTINCT p.id, p.title, p.uid, p.forum_id, 0
+		FROM posts p
+		JOIN post_cats pc ON pc.post_id = p.id
+		JOIN digest_categories dc ON dc.category_id = pc.category_id AND dc.uid = $1
+		WHERE p.created_at > $2 AND p.uid != $1 AND p.pending = 0
+		ORDER BY p.created_at DESC, p.id DESC`, user.ID, after)
+	if err != nil {
+		return models.Digest{}, err
+	}
+
+	// Replies are listed even when the thread is among the new posts.
+	digest.Replies, err = s.collect(user, map[int]bool{}, digestSectionSize, `
+		SELECT p.id, p.title, p.uid, p.forum_id, COUNT(c.id)
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		WHERE p.uid = $1 AND c.uid != $1 AND c.created_at > $2 AND c.pending = 0
+		GROUP BY p.id
+		ORDER BY MAX(c.created_at) DESC`, user.ID, after)
+	if err != nil {
+		return models.Digest{}, err
+	}
+
+	digest.TopThreads, err = s.collect(user, listed, digestTopSize, `
+		SELECT p.id, p.title, p.uid, p.forum_id, SUM(r.weight) AS score
+		FROM posts p
+		JOIN reactions r ON r.target = 'post' AND r.target_id = p.id
+		WHERE p.created_at > $1 AND p.pending = 0
+		GROUP BY p.id
+		HAVING score > 0
+		ORDER BY score DESC, p.id DESC`, after)
+	if err != nil {
+		return models.Digest{}, err
+	}
+
+	return digest, nil
+}
+
+// collect runs query, which selects id, title, uid, forum_id and a count,
+// and keeps up to limit threads user may read that are not listed yet.
+func (s *DigestService) collect(user models.User, listed map[int]bool, limit int, query string, args ...interface{}) ([]models.DigestPost, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		post    models.DigestPost
+		uid     string
+		forumID int
+	}
+
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.post.ID, &c.post.Title, &c.uid, &c.forumID, &c.post.Count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var posts []models.DigestPost
+	for _, c := range candidates {
+		if len(posts) == limit {
+			break
+		}
+		if listed[c.post.ID] {
+			continue
+		}
+
+		err := checkForumAccess(s.db, user.ID, c.forumID, forumActionRead)
+		if err == models.ErrForbidden {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		c.post.Author, err = usernameByID(s.db, c.uid)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		c.post.URL = s.baseURL + "/post/" + strconv.Itoa(c.post.ID)
+
+		listed[c.post.ID] = true
+		posts = append(posts, c.post)
+	}
+
+	return posts, nil
+}
+
+func (s *DigestService) send(user models.User, digest models.Digest) error {
+	textTmpl, err := texttemplate.ParseFiles(digestTextTemplate)
+	if err != nil {
+		return err
+	}
+	htmlTmpl, err := htmltemplate.ParseFiles(digestHTMLTemplate)
+	if err != nil {
+		return err
+	}
+
+	var text, body bytes.Buffer
+	if err := textTmpl.Execute(&text, digest); err != nil {
+		return err
+	}
+	if err := htmlTmpl.Execute(&body, digest); err != nil {
+		return err
+	}
+
+	subject := "Your daily digest"
+	if digest.Frequency == models.DigestWeekly {
+		subject = "Your weekly digest"
+	}
+
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    body.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + digest.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
+
+// digestPeriod names the period holding now: the UTC day for daily digests
+// and the ISO week for weekly ones.
+func digestPeriod(frequency string, now time.Time) string {
+	now = now.UTC()
+	if frequency == models.DigestWeekly {
+		year, week := now.ISOWeek()
+		return fmt.Sprintf("weekly:%d-W%02d", year, week)
+	}
+	return "daily:" + now.Format("2006-01-02")
+}
+
+func digestLength(frequency string) time.Duration {
+	if frequency == models.DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
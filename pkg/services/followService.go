@@ -0,0 +1,214 @@
+package services
+
+import (
+	"database/sql"
+	"forum/pkg/models"
+	"strconv"
+	"time"
+)
+
+type FollowService struct {
+	db    *sql.DB
+	posts *PostService
+}
+
+func NewFollowService(db *sql.DB, posts *PostService) *FollowService {
+	return &FollowService{db: db, posts: posts}
+}
+
+// SetFollow makes uid follow or mute the target of kind, or removes the edge
+// when state is empty. Users cannot follow or mute themselves.
+func (s *FollowService) SetFollow(uid, kind, targetID, state string) error {
+	if err := s.checkTarget(uid, kind, targetID); err != nil {
+		return err
+	}
+
+	var err error
+	switch state {
+	case "":
+		_, err = s.db.Exec("DELETE FROM follows WHERE uid = $1 AND kind = $2 AND target_id = $3", uid, kind, targetID)
+	case models.FollowStateFollow, models.FollowStateMute:
+		_, err = s.db.Exec("INSERT INTO follows (uid, kind, target_id, state, created_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT(uid, kind, target_id) DO UPDATE SET state = excluded.state, created_at = excluded.created_at",
+			uid, kind, targetID, state, time.Now().UTC())
+	default:
+		return models.ValueMismatch
+	}
+
+	return err
+}
+
+// GetFollowState returns whether uid follows or mutes the target, or "".
+func (s *FollowService) GetFollowState(uid, kind, targetID string) (string, error) {
+	var state string
+	err := s.db.QueryRow("SELECT state FROM follows WHERE uid = $1 AND kind = $2 AND target_id = $3", uid, kind, targetID).Scan(&state)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return state, err
+}
+
+// GetFollows returns the edges of uid of the given state, newest first.
+func (s *FollowService) GetFollows(uid, state string) ([]models.Follow, error) {
+	rows, err := s.db.Query("SELECT uid, kind, target_id, state, created_at FROM follows WHERE uid = $1 AND state = $2 ORDER BY created_at DESC", uid, state)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var follows []models.Follow
+	for rows.Next() {
+		var f models.Follow
+		if err := rows.Scan(&f.UID, &f.Kind, &f.TargetID, &f.State, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		follows = append(follows, f)
+	}
+
+	return follows, rows.Err()
+}
+
+// GetFeed returns limit posts of followed users and categories and followed
+// threads in forumIDs, most recently active first, starting at offset, and
+// how many there are in total. Followed threads are active when they get a
+// comment. Posts by muted users, in muted categories and muted threads are
+// left out.
+func (s *FollowService) GetFeed(uid string, forumIDs []int, limit, offset int) ([]models.FeedEntry, int, error) {
+	from := `
+		FROM posts p
+		LEFT JOIN follows ft ON ft.uid = $1 AND ft.kind = 'thread' AND ft.target_id = CAST(p.id AS TEXT) AND ft.state = 'follow'
+		LEFT JOIN comments lc ON ft.uid IS NOT NULL AND lc.id = (SELECT MAX(c.id) FROM comments c WHERE c.post_id = p.id AND c.pending = 0)
+		WHERE p.pending = 0 AND p.forum_id IN (` + intsToList(forumIDs) + `)
+		  AND (ft.uid IS NOT NULL
+		       OR p.uid IN (SELECT target_id FROM follows WHERE uid = $1 AND kind = 'user' AND state = 'follow')
+		       OR p.id IN (SELECT pc.post_id FROM post_cats pc JOIN follows f ON f.target_id = CAST(pc.category_id AS TEXT)
+		                   WHERE f.uid = $1 AND f.kind = 'category' AND f.state = 'follow'))
+		  AND p.uid NOT IN (SELECT target_id FROM follows WHERE uid = $1 AND kind = 'user' AND state = 'mute')
+		  AND p.id NOT IN (SELECT pc.post_id FROM post_cats pc JOIN follows f ON f.target_id = CAST(pc.category_id AS TEXT)
+		                   WHERE f.uid = $1 AND f.kind = 'category' AND f.state = 'mute')
+		  AND CAST(p.id AS TEXT) NOT IN (SELECT target_id FROM follows WHERE uid = $1 AND kind = 'thread' AND state = 'mute')`
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*)"+from, uid).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+prefixedPostColumns+`,
+		       CASE
+		           WHEN ft.uid IS NOT NULL THEN 'thread'
+		           WHEN EXISTS (SELECT 1 FROM follows f WHERE f.uid = $1 AND f.kind = 'user' AND f.target_id = p.uid AND f.state = 'follow') THEN 'user'
+		           ELSE 'category'
+		       END,
+		       lc.created_at`+from+`
+		ORDER BY CASE WHEN lc.created_at > p.created_at THEN lc.created_at ELSE p.created_at END DESC, p.id DESC
+		LIMIT $2 OFFSET $3`, uid, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var entries []models.FeedEntry
+	var ids []int
+	for rows.Next() {
+		var reason string
+		var repliedAt sql.NullTime
+		post, err := scanPost(withColumns{rows, []interface{}{&reason, &repliedAt}})
+		if err != nil {
+			return nil, 0, err
+		}
+
+		entry := models.FeedEntry{
+			Post: models.PostWithCats{
+				ID:          post.ID,
+				UID:         post.UID,
+				ForumID:     post.ForumID,
+				Title:       post.Title,
+				Content:     post.Content,
+				ContentHTML: post.ContentHTML,
+				CreatedAt:   post.CreatedAt,
+			},
+			ActiveAt: post.CreatedAt,
+			Reason:   reason,
+		}
+		if repliedAt.Valid && repliedAt.Time.After(entry.ActiveAt) {
+			entry.ActiveAt = repliedAt.Time
+		}
+		entries = append(entries, entry)
+		ids = append(ids, post.ID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	cats, err := s.posts.getCatsForPosts(ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range entries {
+		entries[i].Post.Cats = cats[entries[i].Post.ID]
+	}
+
+	return entries, total, nil
+}
+
+// Visit records that uid opened their feed now and returns when they opened
+// it before, or the zero time on the first visit.
+func (s *FollowService) Visit(uid string) (time.Time, error) {
+	var last sql.NullTime
+	err := s.db.QueryRow("SELECT visited_at FROM feed_visits WHERE uid = $1", uid).Scan(&last)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+
+	_, err = s.db.Exec("INSERT INTO feed_visits (uid, visited_at) VALUES ($1, $2) ON CONFLICT(uid) DO UPDATE SET visited_at = excluded.visited_at", uid, time.Now().UTC())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return last.Time, nil
+}
+
+// withColumns scans the columns of a row that follow the ones scanned by a
+// helper such as scanPost into extra.
+type withColumns struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (w withColumns) Scan(dest ...interface{}) error {
+	return w.row.Scan(append(dest, w.extra...)...)
+}
+
+// checkTarget verifies that the target of kind exists and is not uid.
+func (s *FollowService) checkTarget(uid, kind, targetID string) error {
+	var query string
+	switch kind {
+	case models.FollowUser:
+		if targetID == uid {
+			return models.ValueMismatch
+		}
+		query = "SELECT COUNT(*) FROM users WHERE id = $1"
+	case models.FollowCategory:
+		query = "SELECT COUNT(*) FROM categories WHERE CAST(id AS TEXT) = $1"
+	case models.FollowThread:
+		query = "SELECT COUNT(*) FROM posts WHERE CAST(id AS TEXT) = $1"
+	default:
+		return models.ValueMismatch
+	}
+
+	var count int
+	if err := s.db.QueryRow(query, targetID).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return models.NotFoundAnything
+	}
+
+	if kind == models.FollowThread {
+		postID, _ := strconv.Atoi(targetID)
+		return checkPostAccess(s.db, uid, postID, forumActionRead)
+	}
+
+	return nil
+}
@@ -0,0 +1,455 @@
+package services
+
+import (
+	"database/sql"
+	"forum/pkg/models"
+	"strconv"
+	"strings"
+)
+
+const (
+	forumActionRead = "read"
+	forumActionPost = "post"
+)
+
+const forumColumns = "id, parent_id, name, slug, description, sort_order, read_role, post_role"
+
+type ForumService struct {
+	db *sql.DB
+}
+
+func NewForumService(db *sql.DB) *ForumService {
+	return &ForumService{db: db}
+}
+
+func (s *ForumService) CreateForum(forum models.Forum) (int, error) {
+	if forum.Slug == "" {
+		forum.Slug = slugify(forum.Name)
+	}
+	if err := s.validateForum(forum); err != nil {
+		return 0, err
+	}
+
+	result, err := s.db.Exec("INSERT INTO forums (parent_id, name, slug, description, sort_order, read_role, post_role) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		nullableID(forum.ParentID), forum.Name, forum.Slug, forum.Description, forum.SortOrder, forum.ReadRole, forum.PostRole)
+	if err != nil {
+		if err.Error() == "UNIQUE constraint failed: forums.slug" {
+			return 0, models.UniqueConstraintSlug
+		}
+		return 0, err
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(newID), nil
+}
+
+func (s *ForumService) UpdateForum(forum models.Forum) error {
+	if forum.Slug == "" {
+		forum.Slug = slugify(forum.Name)
+	}
+	if err := s.validateForum(forum); err != nil {
+		return err
+	}
+
+	if forum.ParentID != 0 {
+		forums, err := s.GetForums()
+		if err != nil {
+			return err
+		}
+		for _, id := range Subtree(forums, forum.ID) {
+			if id == forum.ParentID {
+				return models.ValueMismatch
+			}
+		}
+	}
+
+	result, err := s.db.Exec("UPDATE forums SET parent_id = $1, name = $2, slug = $3, description = $4, sort_order = $5, read_role = $6, post_role = $7 WHERE id = $8",
+		nullableID(forum.ParentID), forum.Name, forum.Slug, forum.Description, forum.SortOrder, forum.ReadRole, forum.PostRole, forum.ID)
+	if err != nil {
+		if err.Error() == "UNIQUE constraint failed: forums.slug" {
+			return models.UniqueConstraintSlug
+		}
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.NotFoundAnything
+	}
+
+	return nil
+}
+
+// DeleteForum removes an empty forum. Forums that still hold threads or
+// sub-forums must be emptied first.
+func (s *ForumService) DeleteForum(ID int) error {
+	var children, threads int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM forums WHERE parent_id = $1", ID).Scan(&children)
+	if err != nil {
+		return err
+	}
+	err = s.db.QueryRow("SELECT COUNT(*) FROM posts WHERE forum_id = $1", ID).Scan(&threads)
+	if err != nil {
+		return err
+	}
+	if children > 0 || threads > 0 {
+		return models.ErrForumNotEmpty
+	}
+
+	_, err = s.db.Exec("DELETE FROM forums WHERE id = $1", ID)
+	return err
+}
+
+func (s *ForumService) GetForums() ([]models.Forum, error) {
+	rows, err := s.db.Query("SELECT " + forumColumns + " FROM forums ORDER BY sort_order, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var forums []models.Forum
+
+	for rows.Next() {
+		forum, err := scanForum(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		forums = append(forums, forum)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return forums, nil
+}
+
+func (s *ForumService) GetForumByID(ID int) (models.Forum, error) {
+	forum, err := scanForum(s.db.QueryRow("SELECT "+forumColumns+" FROM forums WHERE id = $1", ID))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.Forum{}, models.NotFoundAnything
+		default:
+			return models.Forum{}, err
+		}
+	}
+
+	return forum, nil
+}
+
+func (s *ForumService) GetForumBySlug(slug string) (models.Forum, error) {
+	forum, err := scanForum(s.db.QueryRow("SELECT "+forumColumns+" FROM forums WHERE slug = $1", slug))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.Forum{}, models.NotFoundAnything
+		default:
+			return models.Forum{}, err
+		}
+	}
+
+	return forum, nil
+}
+
+// GetBreadcrumbs returns the chain of forums from the root down to forumID.
+func (s *ForumService) GetBreadcrumbs(forumID int) ([]models.Forum, error) {
+	var crumbs []models.Forum
+
+	for id := forumID; id != 0; {
+		forum, err := s.GetForumByID(id)
+		if err != nil {
+			return nil, err
+		}
+		crumbs = append([]models.Forum{forum}, crumbs...)
+		id = forum.ParentID
+
+		if len(crumbs) > 32 {
+			return nil, models.ValueMismatch
+		}
+	}
+
+	return crumbs, nil
+}
+
+// GetStats aggregates thread and post counts and the last activity time over
+// the given forums. Comments count as posts along with the threads themselves.
+func (s *ForumService) GetStats(forumIDs []int) (models.ForumStats, error) {
+	var stats models.ForumStats
+	if len(forumIDs) == 0 {
+		return stats, nil
+	}
+
+	in := intsToList(forumIDs)
+
+	err := s.db.QueryRow("SELECT COUNT(*) FROM posts WHERE pending = 0 AND forum_id IN (" + in + ")").Scan(&stats.ThreadCount)
+	if err != nil {
+		return models.ForumStats{}, err
+	}
+
+	var comments int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.pending = 0 AND p.pending = 0 AND p.forum_id IN (" + in + ")").Scan(&comments)
+	if err != nil {
+		return models.ForumStats{}, err
+	}
+	stats.PostCount = stats.ThreadCount + comments
+
+	var lastPost, lastComment models.Post
+	err = s.db.QueryRow("SELECT created_at FROM posts WHERE pending = 0 AND forum_id IN (" + in + ") ORDER BY created_at DESC LIMIT 1").Scan(&lastPost.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return models.ForumStats{}, err
+	}
+	err = s.db.QueryRow("SELECT c.created_at FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.pending = 0 AND p.pending = 0 AND p.forum_id IN (" + in + ") ORDER BY c.created_at DESC LIMIT 1").Scan(&lastComment.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return models.ForumStats{}, err
+	}
+
+	stats.LastActivity = lastPost.CreatedAt
+	if lastComment.CreatedAt.After(stats.LastActivity) {
+		stats.LastActivity = lastComment.CreatedAt
+	}
+
+	return stats, nil
+}
+
+func (s *ForumService) CanRead(role string, forum models.Forum) bool {
+	return models.HasRole(role, forum.ReadRole)
+}
+
+func (s *ForumService) CanPost(role string, forum models.Forum) bool {
+	return s.CanRead(role, forum) && models.HasRole(role, forum.PostRole)
+}
+
+// CheckRead returns models.ErrForbidden when role may not read forumID.
+func (s *ForumService) CheckRead(role string, forumID int) error {
+	forum, err := s.GetForumByID(forumID)
+	if err != nil {
+		return err
+	}
+	if !s.CanRead(role, forum) {
+		return models.ErrForbidden
+	}
+	return nil
+}
+
+// ReadableForumIDs returns the ids of the forums role may read.
+func (s *ForumService) ReadableForumIDs(role string) ([]int, error) {
+	return readableForumIDs(s.db, role)
+}
+
+// FilterPosts drops posts living in forums that role may not read.
+func (s *ForumService) FilterPosts(role string, posts []models.PostWithCats) ([]models.PostWithCats, error) {
+	forums, err := s.GetForums()
+	if err != nil {
+		return nil, err
+	}
+
+	readable := make(map[int]bool)
+	for _, forum := range forums {
+		readable[forum.ID] = s.CanRead(role, forum)
+	}
+
+	var visible []models.PostWithCats
+	for _, post := range posts {
+		if readable[post.ForumID] {
+			visible = append(visible, post)
+		}
+	}
+
+	return visible, nil
+}
+
+func (s *ForumService) validateForum(forum models.Forum) error {
+	if !models.IsValidRole(forum.ReadRole) || !models.IsValidRole(forum.PostRole) {
+		return models.ValueMismatch
+	}
+	if forum.PostRole == models.RoleGuest {
+		return models.ValueMismatch
+	}
+	if forum.ParentID != 0 {
+		if forum.ParentID == forum.ID {
+			return models.ValueMismatch
+		}
+		if _, err := s.GetForumByID(forum.ParentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subtree returns forumID together with the IDs of all of its descendants.
+func Subtree(forums []models.Forum, forumID int) []int {
+	ids := []int{forumID}
+	for i := 0; i < len(ids); i++ {
+		for _, forum := range forums {
+			if forum.ParentID == ids[i] {
+				ids = append(ids, forum.ID)
+			}
+		}
+	}
+	return ids
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanForum(row rowScanner) (models.Forum, error) {
+	var forum models.Forum
+	var parentID sql.NullInt64
+	err := row.Scan(&forum.ID, &parentID, &forum.Name, &forum.Slug, &forum.Description, &forum.SortOrder, &forum.ReadRole, &forum.PostRole)
+	if err != nil {
+		return models.Forum{}, err
+	}
+	forum.ParentID = int(parentID.Int64)
+	return forum, nil
+}
+
+// checkForumAccess verifies that user uid may perform action in forumID.
+// An empty uid is treated as a guest.
+func checkForumAccess(db *sql.DB, uid string, forumID int, action string) error {
+	if forumID < 1 {
+		return models.ValueMismatch
+	}
+
+	var readRole, postRole string
+	err := db.QueryRow("SELECT read_role, post_role FROM forums WHERE id = $1", forumID).Scan(&readRole, &postRole)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.NotFoundAnything
+		default:
+			return err
+		}
+	}
+
+	role := models.RoleGuest
+	verified := false
+	if uid != "" {
+		err := db.QueryRow("SELECT role, email_verified FROM users WHERE id = $1", uid).Scan(&role, &verified)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !models.HasRole(role, readRole) {
+		return models.ErrForbidden
+	}
+	if action == forumActionPost {
+		if !models.HasRole(role, postRole) {
+			return models.ErrForbidden
+		}
+		if !verified {
+			return models.ErrEmailNotVerified
+		}
+	}
+
+	return nil
+}
+
+func readableForumIDs(db *sql.DB, role string) ([]int, error) {
+	rows, err := db.Query("SELECT id, read_role FROM forums")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		var readRole string
+		if err := rows.Scan(&id, &readRole); err != nil {
+			return nil, err
+		}
+		if models.HasRole(role, readRole) {
+			ids = append(ids, id)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// checkPostAccess verifies that user uid may perform action in the forum
+// holding postID and may see the post if it is held for review.
+func checkPostAccess(db *sql.DB, uid string, postID int, action string) error {
+	var forumID int
+	var authorID string
+	var pending bool
+	err := db.QueryRow("SELECT forum_id, uid, pending FROM posts WHERE id = $1", postID).Scan(&forumID, &authorID, &pending)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.NotFoundAnything
+		default:
+			return err
+		}
+	}
+
+	if err := checkForumAccess(db, uid, forumID, action); err != nil {
+		return err
+	}
+
+	return checkPending(db, uid, authorID, pending)
+}
+
+// checkCommentAccess verifies that commentID is on postID and that user uid
+// may perform action on it, like checkPostAccess for posts.
+func checkCommentAccess(db *sql.DB, uid string, postID, commentID int, action string) error {
+	var commentPostID int
+	var authorID string
+	var pending bool
+	err := db.QueryRow("SELECT post_id, uid, pending FROM comments WHERE id = $1", commentID).Scan(&commentPostID, &authorID, &pending)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.NotFoundAnything
+		default:
+			return err
+		}
+	}
+	if commentPostID != postID {
+		return models.NotFoundAnything
+	}
+
+	if err := checkPostAccess(db, uid, postID, action); err != nil {
+		return err
+	}
+
+	return checkPending(db, uid, authorID, pending)
+}
+
+// checkPending gives ErrForbidden when content of authorID is held for
+// review and uid is neither its author nor staff.
+func checkPending(db *sql.DB, uid, authorID string, pending bool) error {
+	if !pending || (uid != "" && uid == authorID) {
+		return nil
+	}
+	return checkStaff(db, uid)
+}
+
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func intsToList(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
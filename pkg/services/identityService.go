@@ -0,0 +1,140 @@
+package services
+
+import (
+	"database/sql"
+	"forum/pkg/models"
+	"forum/pkg/oauth"
+	"strconv"
+	"strings"
+)
+
+type IdentityService struct {
+	db    *sql.DB
+	users *UserService
+}
+
+func NewIdentityService(db *sql.DB, users *UserService) *IdentityService {
+	return &IdentityService{db: db, users: users}
+}
+
+// ResolveLogin maps an external identity to a forum account. A known identity
+// logs into its account; otherwise it is linked to currentUID when somebody is
+// logged in, to the account with the same email when both sides verified it,
+// or to a brand new account. Anyone can register an unconfirmed address, so
+// such accounts have to sign in with their password and link the provider
+// from their settings.
+func (s *IdentityService) ResolveLogin(provider string, ident oauth.Identity, currentUID string) (models.User, error) {
+	users := s.users
+
+	var uid string
+	err := s.db.QueryRow("SELECT uid FROM user_identities WHERE provider = $1 AND subject = $2", provider, ident.Subject).Scan(&uid)
+	switch {
+	case err == nil:
+		if currentUID != "" && currentUID != uid {
+			return models.User{}, models.ErrIdentityConflict
+		}
+		return users.GetUserByID(uid)
+	case err != sql.ErrNoRows:
+		return models.User{}, err
+	}
+
+	if currentUID != "" {
+		if err := s.link(provider, ident, currentUID); err != nil {
+			return models.User{}, err
+		}
+		return users.GetUserByID(currentUID)
+	}
+
+	if ident.Email == "" {
+		return models.User{}, models.ErrIdentityNoEmail
+	}
+
+	existing, err := users.GetUserByEmail(ident.Email)
+	switch err {
+	case nil:
+		if !ident.EmailVerified || !existing.EmailVerified {
+			return models.User{}, models.ErrIdentityConflict
+		}
+		if err := s.link(provider, ident, existing.ID); err != nil {
+			return models.User{}, err
+		}
+		return existing, nil
+	case models.NotFoundAnything:
+	default:
+		return models.User{}, err
+	}
+
+	username, err := s.freeUsername(ident.Username)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// The account can only be entered through the provider until the user
+	// resets the password.
+	password, err := oauth.RandomString(32)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := users.RegisterUser(models.User{Username: username, Email: ident.Email, Password: password})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if ident.EmailVerified {
+		if err := users.SetEmailVerified(user.ID, true); err != nil {
+			return models.User{}, err
+		}
+		user.EmailVerified = true
+	}
+
+	if err := s.link(provider, ident, user.ID); err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func (s *IdentityService) link(provider string, ident oauth.Identity, uid string) error {
+	_, err := s.db.Exec("INSERT INTO user_identities (provider, subject, uid, email) VALUES ($1, $2, $3, $4)",
+		provider, ident.Subject, uid, ident.Email)
+	return err
+}
+
+// freeUsername derives an unused username of 2 to 10 characters from hint.
+func (s *IdentityService) freeUsername(hint string) (string, error) {
+	var b strings.Builder
+	for _, r := range hint {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	base := b.String()
+	if len(base) < 2 {
+		base = "user"
+	}
+	if len(base) > 10 {
+		base = base[:10]
+	}
+
+	candidate := base
+	for i := 1; i < 1000; i++ {
+		var count int
+		err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE username = $1 COLLATE NOCASE", candidate).Scan(&count)
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+
+		suffix := strconv.Itoa(i)
+		if len(base)+len(suffix) > 10 {
+			candidate = base[:10-len(suffix)] + suffix
+		} else {
+			candidate = base + suffix
+		}
+	}
+
+	return "", models.UniqueConstraintUsername
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"database/sql"
+	"forum/pkg/models"
+	"forum/pkg/oauth"
+	"os"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDB returns an empty in-memory database with the current schema.
+func newTestDB(t *testing.T) *sql.DB {
+	schema, err := os.ReadFile("../migrations/tables.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", ":memory:?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a database of its own.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestResolveLoginLinksVerifiedEmail(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec("INSERT INTO users (id, username, email, password, email_verified) VALUES ('u1', 'ann', 'ann@example.com', 'x', 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewIdentityService(db, NewUserService(db, nil, nil))
+
+	ident := oauth.Identity{Subject: "abc", Email: "ann@example.com", EmailVerified: true, Username: "annie"}
+	user, err := s.ResolveLogin("mock", ident, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "u1" || !user.EmailVerified {
+		t.Fatalf("user = %s verified %v, want u1 verified", user.ID, user.EmailVerified)
+	}
+
+	var linked string
+	err = db.QueryRow("SELECT uid FROM user_identities WHERE provider = 'mock' AND subject = 'abc'").Scan(&linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked != "u1" {
+		t.Fatalf("identity linked to %s, want u1", linked)
+	}
+
+	// The next login finds the identity even if the provider email changed.
+	ident.Email = "other@example.com"
+	user, err = s.ResolveLogin("mock", ident, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "u1" {
+		t.Fatalf("second login user = %s, want u1", user.ID)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("%d users, want 1", count)
+	}
+}
+
+func TestResolveLoginRefusesUnverifiedEmail(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec("INSERT INTO users (id, username, email, password) VALUES ('u1', 'ann', 'ann@example.com', 'x')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewIdentityService(db, NewUserService(db, nil, nil))
+
+	ident := oauth.Identity{Subject: "abc", Email: "ann@example.com", Username: "ann"}
+	if _, err := s.ResolveLogin("mock", ident, ""); err != models.ErrIdentityConflict {
+		t.Fatalf("err = %v, want %v", err, models.ErrIdentityConflict)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM user_identities").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("%d identities linked, want 0", count)
+	}
+}
+
+func TestResolveLoginRefusesUnverifiedAccount(t *testing.T) {
+	db := newTestDB(t)
+	// Somebody registered the address first and never confirmed it.
+	_, err := db.Exec("INSERT INTO users (id, username, email, password) VALUES ('u1', 'mallory', 'ann@example.com', 'x')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewIdentityService(db, NewUserService(db, nil, nil))
+
+	ident := oauth.Identity{Subject: "abc", Email: "ann@example.com", EmailVerified: true, Username: "ann"}
+	if _, err := s.ResolveLogin("mock", ident, ""); err != models.ErrIdentityConflict {
+		t.Fatalf("err = %v, want %v", err, models.ErrIdentityConflict)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM user_identities").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("%d identities linked, want 0", count)
+	}
+
+	var verified bool
+	if err := db.QueryRow("SELECT email_verified FROM users WHERE id = 'u1'").Scan(&verified); err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		t.Fatal("the unconfirmed address was marked confirmed")
+	}
+}
@@ -0,0 +1,31 @@
+package services
+
+import "time"
+
+// Live update events published on the hub. Post topics get comment and
+// reactions events, user topics get notification events.
+const (
+	eventComment      = "comment"
+	eventReactions    = "reactions"
+	eventNotification = "notification"
+)
+
+type commentEvent struct {
+	ID        int       `json:"id"`
+	Author    string    `json:"author"`
+	HTML      string    `json:"html"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// reactionsEvent carries the count of every reaction kind by name.
+type reactionsEvent struct {
+	PostID    int            `json:"postId"`
+	CommentID int            `json:"commentId,omitempty"`
+	Counts    map[string]int `json:"counts"`
+}
+
+type notificationEvent struct {
+	Unread  int    `json:"unread"`
+	Message string `json:"message"`
+	Link    string `json:"link"`
+}
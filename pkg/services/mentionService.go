@@ -0,0 +1,119 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/pkg/mailer"
+	"forum/pkg/markdown"
+	"forum/pkg/models"
+	"html"
+	"strconv"
+)
+
+// maxMentions limits how many users one post or comment can notify.
+const maxMentions = 20
+
+type MentionService struct {
+	db            *sql.DB
+	mailer        mailer.Mailer
+	notifications *NotificationService
+	baseURL       string
+}
+
+func NewMentionService(db *sql.DB, mail mailer.Mailer, notifications *NotificationService, baseURL string) *MentionService {
+	return &MentionService{db: db, mailer: mail, notifications: notifications, baseURL: baseURL}
+}
+
+// Record stores the @mentions in content written by author in postID, or in
+// commentID when it is not 0, and notifies the mentioned users. Users who
+// cannot read the post are skipped. Content held for review mentions nobody
+// until it is approved.
+func (s *MentionService) Record(author models.User, postID, commentID int, content string) error {
+	names := markdown.Mentions(content)
+	if len(names) > maxMentions {
+		names = names[:maxMentions]
+	}
+
+	var title string
+	if len(names) > 0 {
+		var pending bool
+		err := s.db.QueryRow("SELECT title, pending FROM posts WHERE id = $1", postID).Scan(&title, &pending)
+		if err != nil {
+			return err
+		}
+		if commentID != 0 && !pending {
+			err := s.db.QueryRow("SELECT pending FROM comments WHERE id = $1", commentID).Scan(&pending)
+			if err != nil {
+				return err
+			}
+		}
+		if pending {
+			return nil
+		}
+	}
+
+	var firstErr error
+	for _, name := range names {
+		user, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = $1 COLLATE NOCASE", name))
+		if err != nil {
+			if err != sql.ErrNoRows && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if user.ID == author.ID {
+			continue
+		}
+
+		if err := checkPostAccess(s.db, user.ID, postID, forumActionRead); err != nil {
+			if err != models.ErrForbidden && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		_, err = s.db.Exec("INSERT INTO mentions (uid, author_uid, post_id, comment_id) VALUES ($1, $2, $3, $4)",
+			user.ID, author.ID, postID, nullableID(commentID))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		err = s.notifications.Notify(models.Notification{
+			UID:       user.ID,
+			ActorUID:  author.ID,
+			Type:      models.NotifyMention,
+			PostID:    postID,
+			CommentID: commentID,
+			Title:     title,
+		})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		if err := s.notify(user, author, postID, title); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (s *MentionService) notify(user, author models.User, postID int, title string) error {
+	if !user.EmailVerified {
+		return nil
+	}
+
+	link := s.baseURL + "/post/" + strconv.Itoa(postID)
+
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: author.Name() + " mentioned you",
+		Text: fmt.Sprintf("Hi %s,\n\n%s mentioned you in \"%s\".\n\n%s\n",
+			user.Username, author.Name(), title, link),
+		HTML: fmt.Sprintf("<p>Hi %s,</p><p>%s mentioned you in &quot;%s&quot;.</p><p><a href=\"%s\">%s</a></p>",
+			html.EscapeString(user.Username), html.EscapeString(author.Name()), html.EscapeString(title), html.EscapeString(link), html.EscapeString(link)),
+	})
+}
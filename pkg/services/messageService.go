@@ -0,0 +1,567 @@
+package services
+
+import (
+	"database/sql"
+	"forum/pkg/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxConversationMembers bounds group conversations, the creator included.
+	maxConversationMembers = 10
+	// conversationRateLimit is how many conversations a user can start per
+	// conversationRateWindow.
+	conversationRateLimit  = 5
+	conversationRateWindow = time.Hour
+
+	messageSubjectLength = 100
+	messageLength        = 5000
+	// messageReportListSize is how many open message reports the staff see.
+	messageReportListSize = 100
+)
+
+// MessageService keeps the private conversations between users. Every
+// method checks that the acting user takes part in the conversation; the
+// staff can only read messages that were reported to them.
+type MessageService struct {
+	db *sql.DB
+}
+
+func NewMessageService(db *sql.DB) *MessageService {
+	return &MessageService{db: db}
+}
+
+// StartConversation opens a conversation of uid with the users named by
+// usernames and sends its first message. Users who blocked uid, or whom uid
+// blocked, cannot be added.
+func (s *MessageService) StartConversation(uid string, usernames []string, subject, content string) (int, error) {
+	subject = strings.TrimSpace(subject)
+	content = strings.TrimSpace(content)
+	if subject == "" || utf8.RuneCountInString(subject) > messageSubjectLength {
+		return 0, models.ValueMismatch
+	}
+	if err := checkMessage(content); err != nil {
+		return 0, err
+	}
+
+	if err := s.checkSender(uid); err != nil {
+		return 0, err
+	}
+
+	members := []string{uid}
+	seen := map[string]bool{uid: true}
+	for _, name := range usernames {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		var memberID string
+		err := s.db.QueryRow("SELECT id FROM users WHERE username = $1 COLLATE NOCASE", name).Scan(&memberID)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return 0, models.NotFoundAnything
+			default:
+				return 0, err
+			}
+		}
+		if seen[memberID] {
+			continue
+		}
+		seen[memberID] = true
+		members = append(members, memberID)
+	}
+	if len(members) < 2 || len(members) > maxConversationMembers {
+		return 0, models.ValueMismatch
+	}
+
+	if err := s.checkBlocks(uid, members[1:]); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The limit is checked by the insert itself so that parallel requests
+	// cannot both pass it.
+	now := time.Now().UTC()
+	result, err := tx.Exec(`
+		INSERT INTO conversations (creator_uid, subject, created_at, updated_at)
+		SELECT $1, $2, $3, $3
+		WHERE (SELECT COUNT(*) FROM conversations WHERE creator_uid = $1 AND created_at > $4) < $5`,
+		uid, subject, now, now.Add(-conversationRateWindow), conversationRateLimit)
+	if err != nil {
+		return 0, err
+	}
+
+	started, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if started == 0 {
+		return 0, models.ErrRateLimited
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, member := range members {
+		_, err := tx.Exec("INSERT INTO conversation_members (conversation_id, uid) VALUES ($1, $2)", newID, member)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := addMessage(tx, int(newID), uid, content, now); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(newID), nil
+}
+
+// SendMessage adds a message of uid to the conversation with ID. Nobody can
+// write into a conversation with a member who blocked them or whom they
+// blocked.
+func (s *MessageService) SendMessage(uid string, ID int, content string) (int, error) {
+	content = strings.TrimSpace(content)
+	if err := checkMessage(content); err != nil {
+		return 0, err
+	}
+
+	if err := s.checkMember(uid, ID); err != nil {
+		return 0, err
+	}
+	if err := s.checkSender(uid); err != nil {
+		return 0, err
+	}
+
+	members, err := s.memberIDs(ID)
+	if err != nil {
+		return 0, err
+	}
+
+	var others []string
+	for _, member := range members {
+		if member != uid {
+			others = append(others, member)
+		}
+	}
+	if err := s.checkBlocks(uid, others); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newID, err := addMessage(tx, ID, uid, content, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetInbox returns the conversations of uid, most recently active first.
+func (s *MessageService) GetInbox(uid string) ([]models.Conversation, error) {
+	rows, err := s.db.Query(`
+		SELECT c.id, c.subject, c.creator_uid, c.created_at, c.updated_at,
+		       (SELECT COUNT(*) FROM messages m WHERE m.conversation_id = c.id AND m.id > cm.last_read_id AND m.uid != $1)
+		FROM conversations c
+		JOIN conversation_members cm ON cm.conversation_id = c.id AND cm.uid = $1
+		ORDER BY c.updated_at DESC, c.id DESC`, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	var conversations []models.Conversation
+	for rows.Next() {
+		var c models.Conversation
+		if err := rows.Scan(&c.ID, &c.Subject, &c.CreatorUID, &c.CreatedAt, &c.UpdatedAt, &c.Unread); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range conversations {
+		conversations[i].Members, err = s.memberNames(conversations[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return conversations, nil
+}
+
+// GetUnreadCount returns how many messages from others uid has not seen.
+func (s *MessageService) GetUnreadCount(uid string) (int, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM messages m
+		JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.uid = $1
+		WHERE m.id > cm.last_read_id AND m.uid != $1`, uid).Scan(&count)
+	return count, err
+}
+
+// GetConversation returns the conversation with ID and its messages, oldest
+// first, and marks them read for uid. Users outside the conversation get
+// NotFoundAnything.
+func (s *MessageService) GetConversation(uid string, ID int) (models.Conversation, []models.Message, error) {
+	if err := s.checkMember(uid, ID); err != nil {
+		return models.Conversation{}, nil, err
+	}
+
+	var c models.Conversation
+	err := s.db.QueryRow("SELECT id, subject, creator_uid, created_at, updated_at FROM conversations WHERE id = $1", ID).
+		Scan(&c.ID, &c.Subject, &c.CreatorUID, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return models.Conversation{}, nil, err
+	}
+
+	c.Members, err = s.memberNames(ID)
+	if err != nil {
+		return models.Conversation{}, nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT m.id, m.conversation_id, m.uid, COALESCE(u.username, ''), m.content, m.created_at
+		FROM messages m
+		LEFT JOIN users u ON u.id = m.uid
+		WHERE m.conversation_id = $1
+		ORDER BY m.id`, ID)
+	if err != nil {
+		return models.Conversation{}, nil, err
+	}
+
+	var messages []models.Message
+	for rows.Next() {
+		var m models.Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.UID, &m.Author, &m.Content, &m.CreatedAt); err != nil {
+			rows.Close()
+			return models.Conversation{}, nil, err
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.Conversation{}, nil, err
+	}
+
+	if len(messages) > 0 {
+		_, err := s.db.Exec("UPDATE conversation_members SET last_read_id = $1 WHERE conversation_id = $2 AND uid = $3",
+			messages[len(messages)-1].ID, ID, uid)
+		if err != nil {
+			return models.Conversation{}, nil, err
+		}
+	}
+
+	return c, messages, nil
+}
+
+// Block stops the user named username from messaging uid, and uid from
+// messaging them.
+func (s *MessageService) Block(uid, username string) error {
+	var blockedID string
+	err := s.db.QueryRow("SELECT id FROM users WHERE username = $1 COLLATE NOCASE", username).Scan(&blockedID)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.NotFoundAnything
+		default:
+			return err
+		}
+	}
+	if blockedID == uid {
+		return models.ValueMismatch
+	}
+
+	_, err = s.db.Exec("INSERT OR IGNORE INTO user_blocks (uid, blocked_uid, created_at) VALUES ($1, $2, $3)", uid, blockedID, time.Now().UTC())
+	return err
+}
+
+func (s *MessageService) Unblock(uid, username string) error {
+	result, err := s.db.Exec("DELETE FROM user_blocks WHERE uid = $1 AND blocked_uid = (SELECT id FROM users WHERE username = $2 COLLATE NOCASE)", uid, username)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.NotFoundAnything
+	}
+
+	return nil
+}
+
+// GetBlocked returns the usernames uid blocked, in alphabetical order.
+func (s *MessageService) GetBlocked(uid string) ([]string, error) {
+	rows, err := s.db.Query("SELECT u.username FROM user_blocks b JOIN users u ON u.id = b.blocked_uid WHERE b.uid = $1 ORDER BY u.username", uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// IsBlocked tells whether uid blocked the user with blockedID.
+func (s *MessageService) IsBlocked(uid, blockedID string) (bool, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM user_blocks WHERE uid = $1 AND blocked_uid = $2", uid, blockedID).Scan(&count)
+	return count > 0, err
+}
+
+// ReportMessage flags a message another member of the conversation sent to
+// uid for the staff.
+func (s *MessageService) ReportMessage(uid string, messageID int, reason string) error {
+	var conversationID int
+	var author string
+	err := s.db.QueryRow("SELECT conversation_id, uid FROM messages WHERE id = $1", messageID).Scan(&conversationID, &author)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.NotFoundAnything
+		default:
+			return err
+		}
+	}
+
+	if err := s.checkMember(uid, conversationID); err != nil {
+		return err
+	}
+	if author == uid {
+		return models.ValueMismatch
+	}
+
+	result, err := s.db.Exec("INSERT OR IGNORE INTO message_reports (reporter_uid, message_id, reason, created_at) VALUES ($1, $2, $3, $4)",
+		uid, messageID, reason, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.ErrAlreadyReported
+	}
+
+	return nil
+}
+
+// GetMessageReports returns the open message reports with the reported
+// messages, oldest first. Only the staff may read them.
+func (s *MessageService) GetMessageReports(uid string) ([]models.MessageReport, error) {
+	if err := checkStaff(s.db, uid); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT r.id, r.reporter_uid, COALESCE(ru.username, ''), r.reason, r.created_at,
+		       m.id, m.conversation_id, m.uid, COALESCE(mu.username, ''), m.content, m.created_at
+		FROM message_reports r
+		JOIN messages m ON m.id = r.message_id
+		LEFT JOIN users ru ON ru.id = r.reporter_uid
+		LEFT JOIN users mu ON mu.id = m.uid
+		ORDER BY r.id
+		LIMIT $1`, messageReportListSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []models.MessageReport
+	for rows.Next() {
+		var r models.MessageReport
+		m := &r.Message
+		err := rows.Scan(&r.ID, &r.ReporterUID, &r.ReporterName, &r.Reason, &r.CreatedAt,
+			&m.ID, &m.ConversationID, &m.UID, &m.Author, &m.Content, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+
+	return reports, rows.Err()
+}
+
+// DismissMessageReport closes the message report with ID on behalf of uid,
+// who must be staff.
+func (s *MessageService) DismissMessageReport(uid string, ID int) error {
+	if err := checkStaff(s.db, uid); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec("DELETE FROM message_reports WHERE id = $1", ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.NotFoundAnything
+	}
+
+	return nil
+}
+
+// checkMember returns NotFoundAnything unless uid takes part in the
+// conversation with ID, so that outsiders cannot tell it exists.
+func (s *MessageService) checkMember(uid string, ID int) error {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM conversation_members WHERE conversation_id = $1 AND uid = $2", ID, uid).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return models.NotFoundAnything
+	}
+	return nil
+}
+
+// checkSender requires a confirmed email address to send messages.
+func (s *MessageService) checkSender(uid string) error {
+	var verified bool
+	err := s.db.QueryRow("SELECT email_verified FROM users WHERE id = $1", uid).Scan(&verified)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return models.ErrEmailNotVerified
+	}
+	return nil
+}
+
+// checkBlocks returns ErrBlocked when uid and one of others blocked each
+// other.
+func (s *MessageService) checkBlocks(uid string, others []string) error {
+	for _, other := range others {
+		var count int
+		err := s.db.QueryRow("SELECT COUNT(*) FROM user_blocks WHERE (uid = $1 AND blocked_uid = $2) OR (uid = $2 AND blocked_uid = $1)", uid, other).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return models.ErrBlocked
+		}
+	}
+	return nil
+}
+
+func (s *MessageService) memberIDs(ID int) ([]string, error) {
+	return queryStrings(s.db, "SELECT uid FROM conversation_members WHERE conversation_id = $1", ID)
+}
+
+func (s *MessageService) memberNames(ID int) ([]string, error) {
+	return queryStrings(s.db, "SELECT u.username FROM conversation_members cm JOIN users u ON u.id = cm.uid WHERE cm.conversation_id = $1 ORDER BY u.username", ID)
+}
+
+func queryStrings(db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// addMessage stores a message and marks the conversation active and read by
+// the sender.
+func addMessage(tx *sql.Tx, conversationID int, uid, content string, at time.Time) (int, error) {
+	result, err := tx.Exec("INSERT INTO messages (conversation_id, uid, content, created_at) VALUES ($1, $2, $3, $4)", conversationID, uid, content, at)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("UPDATE conversations SET updated_at = $1 WHERE id = $2", at, conversationID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("UPDATE conversation_members SET last_read_id = $1 WHERE conversation_id = $2 AND uid = $3", newID, conversationID, uid)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(newID), nil
+}
+
+func checkMessage(content string) error {
+	if content == "" || utf8.RuneCountInString(content) > messageLength {
+		return models.ValueMismatch
+	}
+	return nil
+}
+
+// checkStaff returns ErrForbidden unless uid is a moderator or an admin.
+func checkStaff(db *sql.DB, uid string) error {
+	var role string
+	err := db.QueryRow("SELECT role FROM users WHERE id = $1", uid).Scan(&role)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.ErrForbidden
+		default:
+			return err
+		}
+	}
+	if !models.HasRole(role, models.RoleModerator) {
+		return models.ErrForbidden
+	}
+	return nil
+}
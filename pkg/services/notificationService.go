@@ -0,0 +1,207 @@
+package services
+
+import (
+	"database/sql"
+	"forum/pkg/events"
+	"forum/pkg/models"
+	"strconv"
+)
+
+// notificationPageSize is how many notifications the notifications page
+// shows.
+const notificationPageSize = 50
+
+type NotificationService struct {
+	db  *sql.DB
+	hub *events.Hub
+}
+
+func NewNotificationService(db *sql.DB, hub *events.Hub) *NotificationService {
+	return &NotificationService{db: db, hub: hub}
+}
+
+// Notify stores n for its recipient unless the recipient caused the event,
+// turned off notifications of its type or muted the actor or the thread.
+// The post title is copied so that the notification stays readable after
+// the post is deleted.
+func (s *NotificationService) Notify(n models.Notification) error {
+	if n.UID == "" || n.UID == n.ActorUID {
+		return nil
+	}
+
+	enabled, err := s.isEnabled(n.UID, n.Type)
+	if err != nil || !enabled {
+		return err
+	}
+
+	muted, err := s.isMuted(n)
+	if err != nil || muted {
+		return err
+	}
+
+	if n.Title == "" {
+		err := s.db.QueryRow("SELECT title FROM posts WHERE id = $1", n.PostID).Scan(&n.Title)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	_, err = s.db.Exec("INSERT INTO notifications (uid, actor_uid, type, post_id, comment_id, title) VALUES ($1, $2, $3, $4, $5, $6)",
+		n.UID, n.ActorUID, n.Type, n.PostID, nullableID(n.CommentID), n.Title)
+	if err != nil {
+		return err
+	}
+
+	return s.publish(n)
+}
+
+// publish pushes n with the new unread count to the live updates of its
+// recipient.
+func (s *NotificationService) publish(n models.Notification) error {
+	unread, err := s.CountUnread(n.UID)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.QueryRow("SELECT COALESCE(NULLIF(display_name, ''), username) FROM users WHERE id = $1", n.ActorUID).Scan(&n.ActorName)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	return s.hub.Publish(events.UserTopic(n.UID), eventNotification, notificationEvent{
+		Unread:  unread,
+		Message: n.Message(),
+		Link:    n.Link(),
+	})
+}
+
+// GetNotifications returns the latest notifications of uid, newest first.
+func (s *NotificationService) GetNotifications(uid string) ([]models.Notification, error) {
+	rows, err := s.db.Query(`
+		SELECT n.id, n.uid, n.actor_uid, COALESCE(NULLIF(u.display_name, ''), u.username, ''), n.type,
+		       n.post_id, COALESCE(n.comment_id, 0), n.title, n.read_at IS NOT NULL, n.created_at
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.actor_uid
+		WHERE n.uid = $1
+		ORDER BY n.id DESC
+		LIMIT $2`, uid, notificationPageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []models.Notification
+
+	for rows.Next() {
+		var n models.Notification
+
+		err := rows.Scan(&n.ID, &n.UID, &n.ActorUID, &n.ActorName, &n.Type, &n.PostID, &n.CommentID, &n.Title, &n.Read, &n.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func (s *NotificationService) CountUnread(uid string) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM notifications WHERE uid = $1 AND read_at IS NULL", uid).Scan(&count)
+	return count, err
+}
+
+func (s *NotificationService) MarkRead(uid string, ID int) error {
+	_, err := s.db.Exec("UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE id = $1 AND uid = $2 AND read_at IS NULL", ID, uid)
+	return err
+}
+
+func (s *NotificationService) MarkAllRead(uid string) error {
+	_, err := s.db.Exec("UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE uid = $1 AND read_at IS NULL", uid)
+	return err
+}
+
+// GetPreferences returns whether each notification type is delivered to uid.
+// Types are enabled until the user turns them off.
+func (s *NotificationService) GetPreferences(uid string) ([]models.NotificationPreference, error) {
+	disabled := make(map[string]bool)
+
+	rows, err := s.db.Query("SELECT type FROM notification_preferences WHERE uid = $1 AND enabled = 0", uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind string
+		if err := rows.Scan(&kind); err != nil {
+			return nil, err
+		}
+		disabled[kind] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	prefs := make([]models.NotificationPreference, 0, len(models.NotificationTypes))
+	for _, kind := range models.NotificationTypes {
+		prefs = append(prefs, models.NotificationPreference{Type: kind, Enabled: !disabled[kind]})
+	}
+
+	return prefs, nil
+}
+
+// SetPreferences turns on the notification types in enabled and turns off
+// the rest.
+func (s *NotificationService) SetPreferences(uid string, enabled map[string]bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, kind := range models.NotificationTypes {
+		_, err := tx.Exec(`INSERT INTO notification_preferences (uid, type, enabled) VALUES ($1, $2, $3)
+			ON CONFLICT (uid, type) DO UPDATE SET enabled = excluded.enabled`, uid, kind, enabled[kind])
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *NotificationService) isEnabled(uid, kind string) (bool, error) {
+	var enabled bool
+	err := s.db.QueryRow("SELECT enabled FROM notification_preferences WHERE uid = $1 AND type = $2", uid, kind).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	return enabled, err
+}
+
+// isMuted tells whether the recipient of n muted its actor or its thread.
+// Moderation notices are always delivered.
+func (s *NotificationService) isMuted(n models.Notification) (bool, error) {
+	if n.Type == models.NotifyModeration {
+		return false, nil
+	}
+
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM follows
+		WHERE uid = $1 AND state = $2
+		  AND ((kind = $3 AND target_id = $4) OR (kind = $5 AND target_id = $6))`,
+		n.UID, models.FollowStateMute, models.FollowUser, n.ActorUID, models.FollowThread, strconv.Itoa(n.PostID)).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"forum/pkg/mailer"
+	"forum/pkg/models"
+	"html"
+	"net/url"
+	"time"
+)
+
+const (
+	resetTTL = time.Hour
+
+	// resetRateWindow is the window in which an address can request
+	// resetEmailLimit links and an IP address resetIPLimit links.
+	resetRateWindow = time.Hour
+	resetEmailLimit = 3
+	resetIPLimit    = 10
+)
+
+type PasswordResetService struct {
+	db        *sql.DB
+	mailer    mailer.Mailer
+	passwords *PasswordService
+	baseURL   string
+}
+
+func NewPasswordResetService(db *sql.DB, mail mailer.Mailer, passwords *PasswordService, baseURL string) *PasswordResetService {
+	return &PasswordResetService{db: db, mailer: mail, passwords: passwords, baseURL: baseURL}
+}
+
+// RequestReset mails a one-time reset link to the owner of email. Unknown
+// addresses are ignored so the caller cannot probe for accounts. Requests
+// for the same address or from the same ip count towards a rate limit
+// whether or not the address has an account.
+func (s *PasswordResetService) RequestReset(email, ip string) error {
+	err := s.countRequest(email, ip)
+	if err != nil {
+		return err
+	}
+
+	var uid, username string
+	err = s.db.QueryRow("SELECT id, username FROM users WHERE email = $1", email).Scan(&uid, &username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	_, err = s.db.Exec("INSERT INTO password_resets (token_hash, uid, expires_at) VALUES ($1, $2, $3)",
+		hashResetToken(token), uid, time.Now().Add(resetTTL))
+	if err != nil {
+		return err
+	}
+
+	link := s.baseURL + "/password/reset?token=" + url.QueryEscape(token)
+
+	return s.mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Text: fmt.Sprintf("Hi %s,\n\nsomeone asked to reset your password. Open the link below within an hour to choose a new one.\nIf it was not you, ignore this email.\n\n%s\n",
+			username, link),
+		HTML: fmt.Sprintf("<p>Hi %s,</p><p>someone asked to reset your password. Open the link below within an hour to choose a new one.<br>If it was not you, ignore this email.</p><p><a href=\"%s\">%s</a></p>",
+			html.EscapeString(username), html.EscapeString(link), html.EscapeString(link)),
+	})
+}
+
+// countRequest records a reset request and returns models.ErrRateLimited
+// when email or ip asked for too many links in the last resetRateWindow.
+func (s *PasswordResetService) countRequest(email, ip string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	since := now.Add(-resetRateWindow)
+	_, err = tx.Exec("DELETE FROM password_reset_requests WHERE created_at <= $1", since)
+	if err != nil {
+		return err
+	}
+
+	var byEmail, byIP int
+	err = tx.QueryRow("SELECT COUNT(*) FROM password_reset_requests WHERE email = $1", email).Scan(&byEmail)
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow("SELECT COUNT(*) FROM password_reset_requests WHERE ip = $1", ip).Scan(&byIP)
+	if err != nil {
+		return err
+	}
+	if byEmail >= resetEmailLimit || byIP >= resetIPLimit {
+		return models.ErrRateLimited
+	}
+
+	_, err = tx.Exec("INSERT INTO password_reset_requests (email, ip, created_at) VALUES ($1, $2, $3)", email, ip, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CheckToken returns the id of the user token resets the password for while
+// it can still be used.
+func (s *PasswordResetService) CheckToken(token string) (string, error) {
+	return s.lookup(s.db.QueryRow, token)
+}
+
+// ResetPassword sets a new password using token, burns every outstanding
+// token of the user and logs them out everywhere.
+func (s *PasswordResetService) ResetPassword(token, pass string) error {
+	hash, err := s.passwords.Hash(pass)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	uid, err := s.lookup(tx.QueryRow, token)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE users SET password = $1 WHERE id = $2", hash, uid)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE password_resets SET used = 1 WHERE uid = $1", uid)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM sessions WHERE uid = $1", uid)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PasswordResetService) lookup(queryRow func(string, ...interface{}) *sql.Row, token string) (string, error) {
+	var uid string
+	var expires time.Time
+	var used bool
+	err := queryRow("SELECT uid, expires_at, used FROM password_resets WHERE token_hash = $1", hashResetToken(token)).Scan(&uid, &expires, &used)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", models.ErrResetTokenInvalid
+		}
+		return "", err
+	}
+
+	if used || expires.Before(time.Now()) {
+		return "", models.ErrResetTokenInvalid
+	}
+
+	return uid, nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
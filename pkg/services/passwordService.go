@@ -0,0 +1,57 @@
+package services
+
+import (
+	"forum/pkg/models"
+	"forum/pkg/utils/breach"
+	"forum/pkg/utils/validators"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordService struct {
+	policy   validators.PasswordPolicy
+	breached *breach.Checker
+	cost     int
+}
+
+func NewPasswordService(policy validators.PasswordPolicy, breached *breach.Checker, cost int) *PasswordService {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &PasswordService{policy: policy, breached: breached, cost: cost}
+}
+
+// Check validates a new password against the policy and the breached list.
+func (s *PasswordService) Check(password, username, email string) error {
+	if err := s.policy.Validate(password, username, email); err != nil {
+		return err
+	}
+
+	breached, err := s.breached.Contains(password)
+	if err != nil {
+		return err
+	}
+	if breached {
+		return models.ErrPasswordBreached
+	}
+
+	return nil
+}
+
+func (s *PasswordService) Hint() string {
+	return s.policy.Hint()
+}
+
+func (s *PasswordService) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// NeedsRehash reports whether hash was made with a lower cost than configured.
+func (s *PasswordService) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < s.cost
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"database/sql"
+	"forum/pkg/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	pollMinOptions     = 2
+	pollMaxOptions     = 10
+	pollQuestionLength = 200
+	pollOptionLength   = 100
+)
+
+type PollService struct {
+	db *sql.DB
+}
+
+func NewPollService(db *sql.DB) *PollService {
+	return &PollService{db: db}
+}
+
+// CheckPoll trims the question and the options of poll and verifies them,
+// so that the form can be refused before images are saved. Empty options
+// are dropped.
+func (s *PollService) CheckPoll(poll models.Poll) (models.Poll, error) {
+	return checkPoll(poll)
+}
+
+func checkPoll(poll models.Poll) (models.Poll, error) {
+	poll.Question = strings.TrimSpace(poll.Question)
+	if poll.Question == "" || utf8.RuneCountInString(poll.Question) > pollQuestionLength {
+		return poll, models.ValueMismatch
+	}
+
+	var options []models.PollOption
+	seen := make(map[string]bool)
+	for _, option := range poll.Options {
+		option.Label = strings.TrimSpace(option.Label)
+		if option.Label == "" {
+			continue
+		}
+		if utf8.RuneCountInString(option.Label) > pollOptionLength || seen[option.Label] {
+			return poll, models.ValueMismatch
+		}
+		seen[option.Label] = true
+		options = append(options, option)
+	}
+	if len(options) < pollMinOptions || len(options) > pollMaxOptions {
+		return poll, models.ValueMismatch
+	}
+	poll.Options = options
+
+	if !poll.ClosesAt.IsZero() {
+		if !poll.ClosesAt.After(time.Now()) {
+			return poll, models.ValueMismatch
+		}
+		poll.ClosesAt = poll.ClosesAt.UTC()
+	}
+
+	return poll, nil
+}
+
+// insertPoll saves poll, checked by checkPoll, as part of tx.
+func insertPoll(tx *sql.Tx, poll models.Poll) error {
+	var closesAt interface{}
+	if !poll.ClosesAt.IsZero() {
+		closesAt = poll.ClosesAt
+	}
+
+	_, err := tx.Exec("INSERT INTO polls (post_id, question, multiple, anonymous, closes_at) VALUES ($1, $2, $3, $4, $5)",
+		poll.PostID, poll.Question, poll.Multiple, poll.Anonymous, closesAt)
+	if err != nil {
+		return err
+	}
+
+	for i, option := range poll.Options {
+		_, err := tx.Exec("INSERT INTO poll_options (post_id, position, label) VALUES ($1, $2, $3)", poll.PostID, i, option.Label)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetPoll returns the poll of postID with its results as seen by uid, who
+// may be empty for guests. Posts without a poll give NotFoundAnything.
+func (s *PollService) GetPoll(uid string, postID int) (models.Poll, error) {
+	if err := checkPostAccess(s.db, uid, postID, forumActionRead); err != nil {
+		return models.Poll{}, err
+	}
+
+	poll := models.Poll{PostID: postID}
+	var closesAt sql.NullTime
+	err := s.db.QueryRow("SELECT question, multiple, anonymous, closes_at FROM polls WHERE post_id = $1", postID).
+		Scan(&poll.Question, &poll.Multiple, &poll.Anonymous, &closesAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.Poll{}, models.NotFoundAnything
+		default:
+			return models.Poll{}, err
+		}
+	}
+	poll.ClosesAt = closesAt.Time
+
+	err = s.db.QueryRow("SELECT COUNT(*) FROM poll_ballots WHERE post_id = $1", postID).Scan(&poll.Voters)
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT o.id, o.label, (SELECT COUNT(*) FROM poll_votes v WHERE v.option_id = o.id)
+		FROM poll_options o
+		WHERE o.post_id = $1
+		ORDER BY o.position`, postID)
+	if err != nil {
+		return models.Poll{}, err
+	}
+	for rows.Next() {
+		var option models.PollOption
+		if err := rows.Scan(&option.ID, &option.Label, &option.Votes); err != nil {
+			rows.Close()
+			return models.Poll{}, err
+		}
+		if poll.Voters > 0 {
+			option.Percent = option.Votes * 100 / poll.Voters
+		}
+		poll.Options = append(poll.Options, option)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.Poll{}, err
+	}
+
+	rows, err = s.db.Query(`
+		SELECT v.option_id, v.uid, COALESCE(u.username, '')
+		FROM poll_votes v
+		LEFT JOIN users u ON u.id = v.uid
+		WHERE v.post_id = $1
+		ORDER BY u.username`, postID)
+	if err != nil {
+		return models.Poll{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var optionID int
+		var voter, name string
+		if err := rows.Scan(&optionID, &voter, &name); err != nil {
+			return models.Poll{}, err
+		}
+		for i := range poll.Options {
+			option := &poll.Options[i]
+			if option.ID != optionID {
+				continue
+			}
+			if uid != "" && voter == uid {
+				option.Chosen = true
+				poll.Voted = true
+			}
+			if !poll.Anonymous {
+				option.VoterNames = append(option.VoterNames, name)
+			}
+		}
+	}
+
+	return poll, rows.Err()
+}
+
+// Vote casts the ballot of uid in the poll of postID. Single choice polls
+// take exactly one option. A user votes once; later attempts give
+// ErrAlreadyVoted.
+func (s *PollService) Vote(uid string, postID int, optionIDs []int) error {
+	if err := checkPostAccess(s.db, uid, postID, forumActionRead); err != nil {
+		return err
+	}
+
+	var multiple bool
+	var closesAt sql.NullTime
+	err := s.db.QueryRow("SELECT multiple, closes_at FROM polls WHERE post_id = $1", postID).Scan(&multiple, &closesAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.NotFoundAnything
+		default:
+			return err
+		}
+	}
+	if (models.Poll{ClosesAt: closesAt.Time}).IsClosed() {
+		return models.ErrPollClosed
+	}
+
+	chosen := make(map[int]bool)
+	for _, id := range optionIDs {
+		chosen[id] = true
+	}
+	if len(chosen) == 0 || (!multiple && len(chosen) > 1) {
+		return models.ValueMismatch
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO poll_ballots (post_id, uid, created_at) VALUES ($1, $2, $3)", postID, uid, time.Now().UTC())
+	if err != nil {
+		if err.Error() == "UNIQUE constraint failed: poll_ballots.post_id, poll_ballots.uid" {
+			return models.ErrAlreadyVoted
+		}
+		return err
+	}
+
+	for id := range chosen {
+		result, err := tx.Exec("INSERT INTO poll_votes (post_id, uid, option_id) SELECT $1, $2, id FROM poll_options WHERE id = $3 AND post_id = $1", postID, uid, id)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return models.ValueMismatch
+		}
+	}
+
+	return tx.Commit()
+}
@@ -3,20 +3,30 @@ package services
 import (
 	"database/sql"
 	"fmt"
+	"forum/pkg/markdown"
 	"forum/pkg/models"
+	"forum/pkg/utils/logger"
 	"strconv"
 )
 
+const (
+	postColumns         = "id, title, content, uid, forum_id, created_at, content_html, html_version, pending"
+	prefixedPostColumns = "p.id, p.title, p.content, p.uid, p.forum_id, p.created_at, p.content_html, p.html_version, p.pending"
+)
+
 type PostService struct {
-	db *sql.DB
+	db            *sql.DB
+	notifications *NotificationService
+	webhooks      *WebhookService
+	uploads       *UploadService
 }
 
-func NewPostService(db *sql.DB) *PostService {
-	return &PostService{db: db}
+func NewPostService(db *sql.DB, notifications *NotificationService, webhooks *WebhookService, uploads *UploadService) *PostService {
+	return &PostService{db: db, notifications: notifications, webhooks: webhooks, uploads: uploads}
 }
 
 func (s *PostService) GetAllPosts() ([]models.PostWithCats, error) {
-	rows, err := s.db.Query("SELECT * FROM posts")
+	rows, err := s.db.Query("SELECT " + postColumns + " FROM posts WHERE pending = 0")
 	if err != nil {
 		return nil, err
 	}
@@ -25,14 +35,7 @@ func (s *PostService) GetAllPosts() ([]models.PostWithCats, error) {
 	var posts []models.PostWithCats
 
 	for rows.Next() {
-		post := models.Post{}
-
-		err := rows.Scan(
-			&post.ID,
-			&post.Title,
-			&post.Content,
-			&post.UID,
-		)
+		post, err := scanPost(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -43,11 +46,14 @@ func (s *PostService) GetAllPosts() ([]models.PostWithCats, error) {
 		}
 
 		posts = append(posts, models.PostWithCats{
-			ID:      post.ID,
-			UID:     post.UID,
-			Title:   post.Title,
-			Content: post.Content,
-			Cats:    cats,
+			ID:          post.ID,
+			UID:         post.UID,
+			ForumID:     post.ForumID,
+			Title:       post.Title,
+			Content:     post.Content,
+			ContentHTML: post.ContentHTML,
+			CreatedAt:   post.CreatedAt,
+			Cats:        cats,
 		})
 	}
 
@@ -59,7 +65,7 @@ func (s *PostService) GetAllPosts() ([]models.PostWithCats, error) {
 }
 
 func (s *PostService) GetReactedPosts(UID string) ([]models.PostWithCats, error) {
-	rows, err := s.db.Query("SELECT p.id, p.title, p.content, p.uid FROM posts p JOIN post_reacts a ON p.id = a.pid WHERE a.uid = $1 AND a.sign IN (1, -1)", UID)
+	rows, err := s.db.Query("SELECT DISTINCT "+prefixedPostColumns+" FROM posts p JOIN reactions r ON r.target = 'post' AND r.target_id = p.id WHERE r.user_id = $1 AND p.pending = 0", UID)
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
@@ -73,24 +79,25 @@ func (s *PostService) GetReactedPosts(UID string) ([]models.PostWithCats, error)
 	var posts []models.PostWithCats
 
 	for rows.Next() {
-		post := models.Post{}
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
 
-		err := rows.Scan(&post.ID,
-			&post.Title,
-			&post.Content,
-			&post.UID,
-		)
 		cats, err := s.getCatsForPost(post.ID)
 		if err != nil {
 			return nil, err
 		}
 
 		posts = append(posts, models.PostWithCats{
-			ID:      post.ID,
-			UID:     post.UID,
-			Title:   post.Title,
-			Content: post.Content,
-			Cats:    cats,
+			ID:          post.ID,
+			UID:         post.UID,
+			ForumID:     post.ForumID,
+			Title:       post.Title,
+			Content:     post.Content,
+			ContentHTML: post.ContentHTML,
+			CreatedAt:   post.CreatedAt,
+			Cats:        cats,
 		})
 	}
 
@@ -101,26 +108,137 @@ func (s *PostService) GetReactedPosts(UID string) ([]models.PostWithCats, error)
 	return posts, nil
 }
 
-func (s *PostService) CreatePost(p models.Post, catIDS []int) error {
+// CreatePost saves p in the categories catIDS, with poll attached when it
+// is not nil, and returns its ID.
+func (s *PostService) CreatePost(p models.Post, catIDS []int, poll *models.Poll) (int, error) {
 	if len(catIDS) < 1 {
-		return models.NoCatsSelected
+		return 0, models.NoCatsSelected
+	}
+
+	if err := checkForumAccess(s.db, p.UID, p.ForumID, forumActionPost); err != nil {
+		return 0, err
+	}
+
+	if containsLink(p.Title + " " + p.Content) {
+		if err := checkTrust(s.db, p.UID, models.TrustLevel.CanPostLinks); err != nil {
+			return 0, err
+		}
+	}
+
+	if poll != nil {
+		checked, err := checkPoll(*poll)
+		if err != nil {
+			return 0, err
+		}
+		if err := checkTrust(s.db, p.UID, models.TrustLevel.CanCreatePolls); err != nil {
+			return 0, err
+		}
+		poll = &checked
 	}
 
-	result, err := s.db.Exec("INSERT INTO posts (title , content , UID) VALUES ($1 , $2 , $3)", p.Title, p.Content, p.UID)
+	pending, err := needsReview(s.db, p.UID)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO posts (title , content , UID, forum_id, content_html, html_version, pending) VALUES ($1 , $2 , $3, $4, $5, $6, $7)",
+		p.Title, p.Content, p.UID, p.ForumID, markdown.Render(p.Content), markdown.Version, pending)
+	if err != nil {
+		return 0, err
 	}
 
 	newID, err := result.LastInsertId()
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	if err := insertCatsForPost(tx, int(newID), catIDS); err != nil {
+		return 0, err
+	}
+
+	if poll != nil {
+		poll.PostID = int(newID)
+		if err := insertPoll(tx, *poll); err != nil {
+			return 0, err
+		}
+	}
+
+	if pending {
+		if err := queueForReview(tx, int(newID), 0); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := refreshPostScore(tx, int(newID)); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// The post is saved; the webhooks only hear about it, so failures are
+	// logged rather than reported to the author.
+	if !pending {
+		p.ID = int(newID)
+		if err := s.emitCreated(p); err != nil {
+			logger.GetLogger().Error(err.Error())
+		}
+	}
+
+	return int(newID), nil
+}
+
+// ApprovePost publishes the post with ID that was held for review and
+// returns it.
+func (s *PostService) ApprovePost(ID int) (models.PostWithCats, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.PostWithCats{}, err
+	}
+	defer tx.Rollback()
+
+	if err := approveReview(tx, "posts", ID); err != nil {
+		return models.PostWithCats{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.PostWithCats{}, err
+	}
+
+	post, err := s.GetPostByID(ID)
+	if err != nil {
+		return models.PostWithCats{}, err
 	}
 
-	if err := s.insertCatsForPost(int(newID), catIDS); err != nil {
+	err = s.emitCreated(models.Post{ID: post.ID, UID: post.UID, ForumID: post.ForumID, Title: post.Title})
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
+
+	return post, nil
+}
+
+// emitCreated sends the new post p to the webhooks.
+func (s *PostService) emitCreated(p models.Post) error {
+	author, err := usernameByID(s.db, p.UID)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return s.webhooks.EmitForPost(p.ID, models.WebhookPostCreated, map[string]interface{}{
+		"id":      p.ID,
+		"title":   p.Title,
+		"forumId": p.ForumID,
+		"author":  author,
+		"url":     s.webhooks.Link("/post/" + strconv.Itoa(p.ID)),
+	})
 }
 
 func (s *PostService) GetPostByID(ID int) (models.PostWithCats, error) {
@@ -128,13 +246,7 @@ func (s *PostService) GetPostByID(ID int) (models.PostWithCats, error) {
 		return models.PostWithCats{}, models.ValueMismatch
 	}
 
-	post := models.Post{}
-
-	err := s.db.QueryRow("SELECT * FROM posts WHERE id = $1", ID).Scan(&post.ID,
-		&post.Title,
-		&post.Content,
-		&post.UID,
-	)
+	post, err := scanPost(s.db.QueryRow("SELECT "+postColumns+" FROM posts WHERE id = $1", ID))
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
@@ -150,16 +262,20 @@ func (s *PostService) GetPostByID(ID int) (models.PostWithCats, error) {
 	}
 
 	return models.PostWithCats{
-		ID:      post.ID,
-		UID:     post.UID,
-		Title:   post.Title,
-		Content: post.Content,
-		Cats:    cats,
+		ID:          post.ID,
+		UID:         post.UID,
+		ForumID:     post.ForumID,
+		Title:       post.Title,
+		Content:     post.Content,
+		ContentHTML: post.ContentHTML,
+		CreatedAt:   post.CreatedAt,
+		Pending:     post.Pending,
+		Cats:        cats,
 	}, nil
 }
 
-func (s *PostService) insertCatsForPost(postID int, catIDS []int) error {
-	stmt, err := s.db.Prepare("INSERT INTO post_cats (post_id, category_id) VALUES ($1, $2)")
+func insertCatsForPost(tx *sql.Tx, postID int, catIDS []int) error {
+	stmt, err := tx.Prepare("INSERT INTO post_cats (post_id, category_id) VALUES ($1, $2)")
 	if err != nil {
 		return err
 	}
@@ -168,6 +284,9 @@ func (s *PostService) insertCatsForPost(postID int, catIDS []int) error {
 	for _, cat := range catIDS {
 		_, err := stmt.Exec(postID, cat)
 		if err != nil {
+			if err.Error() == "FOREIGN KEY constraint failed" {
+				return models.NotFoundAnything
+			}
 			return err
 		}
 	}
@@ -177,10 +296,10 @@ func (s *PostService) insertCatsForPost(postID int, catIDS []int) error {
 
 func (s *PostService) GetPostsByCats(catIDS []int) ([]models.PostWithCats, error) {
 	query := `
-		SELECT DISTINCT p.*
+		SELECT DISTINCT %s
 		FROM posts p
 		JOIN post_cats pc ON p.id = pc.post_id
-		WHERE pc.category_id IN (%s);
+		WHERE pc.category_id IN (%s) AND p.pending = 0;
 	`
 
 	catIDsStr := ""
@@ -191,7 +310,7 @@ func (s *PostService) GetPostsByCats(catIDS []int) ([]models.PostWithCats, error
 		catIDsStr += strconv.Itoa(id)
 	}
 
-	makeQuery := fmt.Sprintf(query, catIDsStr)
+	makeQuery := fmt.Sprintf(query, prefixedPostColumns, catIDsStr)
 
 	rows, err := s.db.Query(makeQuery)
 	if err != nil {
@@ -207,9 +326,51 @@ func (s *PostService) GetPostsByCats(catIDS []int) ([]models.PostWithCats, error
 	var posts []models.PostWithCats
 
 	for rows.Next() {
-		post := models.Post{}
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		cats, err := s.getCatsForPost(post.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, models.PostWithCats{
+			ID:          post.ID,
+			UID:         post.UID,
+			ForumID:     post.ForumID,
+			Title:       post.Title,
+			Content:     post.Content,
+			ContentHTML: post.ContentHTML,
+			CreatedAt:   post.CreatedAt,
+			Cats:        cats,
+		})
+	}
 
-		err := rows.Scan(&post.ID, &post.UID, &post.Title, &post.Content)
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// GetPostsByForums returns threads of the given forums, newest first.
+func (s *PostService) GetPostsByForums(forumIDs []int) ([]models.PostWithCats, error) {
+	if len(forumIDs) == 0 {
+		return nil, nil
+	}
+
+	rows, err := s.db.Query("SELECT " + postColumns + " FROM posts WHERE pending = 0 AND forum_id IN (" + intsToList(forumIDs) + ") ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []models.PostWithCats
+
+	for rows.Next() {
+		post, err := scanPost(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -220,11 +381,14 @@ func (s *PostService) GetPostsByCats(catIDS []int) ([]models.PostWithCats, error
 		}
 
 		posts = append(posts, models.PostWithCats{
-			ID:      post.ID,
-			UID:     post.UID,
-			Title:   post.Title,
-			Content: post.Content,
-			Cats:    cats,
+			ID:          post.ID,
+			UID:         post.UID,
+			ForumID:     post.ForumID,
+			Title:       post.Title,
+			Content:     post.Content,
+			ContentHTML: post.ContentHTML,
+			CreatedAt:   post.CreatedAt,
+			Cats:        cats,
 		})
 	}
 
@@ -235,12 +399,51 @@ func (s *PostService) GetPostsByCats(catIDS []int) ([]models.PostWithCats, error
 	return posts, nil
 }
 
+// getCatsForPosts returns the categories of each of postIDs in one query.
+func (s *PostService) getCatsForPosts(postIDs []int) (map[int][]models.Category, error) {
+	cats := make(map[int][]models.Category)
+	if len(postIDs) == 0 {
+		return cats, nil
+	}
+
+	rows, err := s.db.Query(`
+        SELECT pc.post_id, c.id, c.name, c.slug, c.description, c.color, c.sort_order
+        FROM categories c
+        JOIN post_cats pc ON c.id = pc.category_id
+        WHERE pc.post_id IN (` + intsToList(postIDs) + `)
+        ORDER BY c.sort_order, c.id
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		category := models.Category{}
+
+		err := rows.Scan(&postID, &category.ID, &category.Name, &category.Slug, &category.Description, &category.Color, &category.SortOrder)
+		if err != nil {
+			return nil, err
+		}
+
+		cats[postID] = append(cats[postID], category)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cats, nil
+}
+
 func (s *PostService) getCatsForPost(postID int) ([]models.Category, error) {
 	rows, err := s.db.Query(`
-        SELECT c.id, c.name
+        SELECT c.id, c.name, c.slug, c.description, c.color, c.sort_order
         FROM categories c
         JOIN post_cats pc ON c.id = pc.category_id
         WHERE pc.post_id = $1
+        ORDER BY c.sort_order, c.id
     `, postID)
 	if err != nil {
 		return nil, err
@@ -252,7 +455,7 @@ func (s *PostService) getCatsForPost(postID int) ([]models.Category, error) {
 	for rows.Next() {
 		category := models.Category{}
 
-		err := rows.Scan(&category.ID, &category.Name)
+		err := rows.Scan(&category.ID, &category.Name, &category.Slug, &category.Description, &category.Color, &category.SortOrder)
 		if err != nil {
 			return nil, err
 		}
@@ -269,8 +472,9 @@ func (s *PostService) getCatsForPost(postID int) ([]models.Category, error) {
 
 func (s *PostService) GetCats() ([]models.Category, error) {
 	rows, err := s.db.Query(`
-        SELECT c.id, c.name
-        FROM categories c`)
+        SELECT c.id, c.name, c.slug, c.description, c.color, c.sort_order
+        FROM categories c
+        ORDER BY c.sort_order, c.id`)
 	if err != nil {
 		return nil, err
 	}
@@ -281,7 +485,7 @@ func (s *PostService) GetCats() ([]models.Category, error) {
 	for rows.Next() {
 		category := models.Category{}
 
-		err := rows.Scan(&category.ID, &category.Name)
+		err := rows.Scan(&category.ID, &category.Name, &category.Slug, &category.Description, &category.Color, &category.SortOrder)
 		if err != nil {
 			return nil, err
 		}
@@ -297,7 +501,7 @@ func (s *PostService) GetCats() ([]models.Category, error) {
 }
 
 func (s *PostService) GetPostsByUID(UID string) ([]models.PostWithCats, error) {
-	rows, err := s.db.Query("SELECT * FROM posts WHERE uid = $1", UID)
+	rows, err := s.db.Query("SELECT "+postColumns+" FROM posts WHERE uid = $1 AND pending = 0 ORDER BY created_at DESC, id DESC", UID)
 	if err != nil {
 		return nil, err
 	}
@@ -306,13 +510,7 @@ func (s *PostService) GetPostsByUID(UID string) ([]models.PostWithCats, error) {
 	var posts []models.PostWithCats
 
 	for rows.Next() {
-		post := models.Post{}
-
-		err := rows.Scan(&post.ID,
-			&post.Title,
-			&post.Content,
-			&post.UID,
-		)
+		post, err := scanPost(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -323,11 +521,14 @@ func (s *PostService) GetPostsByUID(UID string) ([]models.PostWithCats, error) {
 		}
 
 		posts = append(posts, models.PostWithCats{
-			ID:      post.ID,
-			UID:     post.UID,
-			Title:   post.Title,
-			Content: post.Content,
-			Cats:    cats,
+			ID:          post.ID,
+			UID:         post.UID,
+			ForumID:     post.ForumID,
+			Title:       post.Title,
+			Content:     post.Content,
+			ContentHTML: post.ContentHTML,
+			CreatedAt:   post.CreatedAt,
+			Cats:        cats,
 		})
 	}
 
@@ -338,11 +539,192 @@ func (s *PostService) GetPostsByUID(UID string) ([]models.PostWithCats, error) {
 	return posts, nil
 }
 
-func (s *PostService) DeletePost(ID int) error {
-	_, err := s.db.Exec("DELETE FROM posts WHERE id = $1", ID)
+// GetPostsPageByUID returns limit posts of user UID in forumIDs, newest
+// first, starting at offset, and how many such posts there are in total.
+func (s *PostService) GetPostsPageByUID(UID string, forumIDs []int, limit, offset int) ([]models.PostWithCats, int, error) {
+	where := " FROM posts WHERE uid = $1 AND pending = 0 AND forum_id IN (" + intsToList(forumIDs) + ")"
+
+	var total int
+	err := s.db.QueryRow("SELECT COUNT(*)"+where, UID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query("SELECT "+postColumns+where+" ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3", UID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var posts []models.PostWithCats
+	var ids []int
+
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		posts = append(posts, models.PostWithCats{
+			ID:          post.ID,
+			UID:         post.UID,
+			ForumID:     post.ForumID,
+			Title:       post.Title,
+			Content:     post.Content,
+			ContentHTML: post.ContentHTML,
+			CreatedAt:   post.CreatedAt,
+		})
+		ids = append(ids, post.ID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	cats, err := s.getCatsForPosts(ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range posts {
+		posts[i].Cats = cats[posts[i].ID]
+	}
+
+	return posts, total, nil
+}
+
+// DeletePost removes the post with ID together with its comments on behalf
+// of user by. The author is notified when someone else removed the post.
+func (s *PostService) DeletePost(ID int, by string) error {
+	post, err := scanPost(s.db.QueryRow("SELECT "+postColumns+" FROM posts WHERE id = $1", ID))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.NotFoundAnything
+		default:
+			return err
+		}
+	}
+
+	uploads, err := s.uploads.GetUploadsByPostID(ID)
 	if err != nil {
 		return err
 	}
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Reactions and thread follows name the post without a foreign key;
+	// everything else hanging off it goes with ON DELETE CASCADE.
+	for _, query := range []string{
+		`UPDATE users SET reputation = reputation - (
+			SELECT COALESCE(SUM(r.weight), 0) FROM reactions r JOIN comments c ON c.id = r.target_id
+			WHERE r.target = 'comment' AND c.post_id = $1 AND c.uid = users.id AND r.user_id != users.id)
+		WHERE id IN (SELECT uid FROM comments WHERE post_id = $1)`,
+		`UPDATE users SET reputation = reputation - (
+			SELECT COALESCE(SUM(weight), 0) FROM reactions
+			WHERE target = 'post' AND target_id = $1 AND user_id != users.id)
+		WHERE id = (SELECT uid FROM posts WHERE id = $1)`,
+		"DELETE FROM reactions WHERE target = 'comment' AND target_id IN (SELECT id FROM comments WHERE post_id = $1)",
+		"DELETE FROM follows WHERE kind = 'thread' AND target_id = CAST($1 AS TEXT)",
+		"DELETE FROM reactions WHERE target = 'post' AND target_id = $1",
+		"DELETE FROM posts WHERE id = $1",
+	} {
+		if _, err := tx.Exec(query, ID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// The post is gone; files that cannot be removed and failed
+	// notifications are only logged.
+	for _, upload := range uploads {
+		if err := s.uploads.deleteFiles(upload); err != nil {
+			logger.GetLogger().Error(err.Error())
+		}
+	}
+
+	err = s.notifications.Notify(models.Notification{
+		UID:      post.UID,
+		ActorUID: by,
+		Type:     models.NotifyModeration,
+		PostID:   post.ID,
+		Title:    post.Title,
+	})
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
+
+	return nil
+}
+
+// RefreshHTML re-renders the cached HTML of posts rendered by an older
+// version of the Markdown renderer.
+func (s *PostService) RefreshHTML() error {
+	return refreshHTML(s.db, "posts")
+}
+
+// scanPost reads a row selected with postColumns. HTML cached by an older
+// renderer is rendered again until RefreshHTML updates the row.
+func scanPost(row rowScanner) (models.Post, error) {
+	var post models.Post
+	var version int
+	err := row.Scan(&post.ID,
+		&post.Title,
+		&post.Content,
+		&post.UID,
+		&post.ForumID,
+		&post.CreatedAt,
+		&post.ContentHTML,
+		&version,
+		&post.Pending,
+	)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	if version != markdown.Version {
+		post.ContentHTML = markdown.Render(post.Content)
+	}
+
+	return post, nil
+}
+
+// refreshHTML renders content_html again for every row of table with an
+// outdated html_version.
+func refreshHTML(db *sql.DB, table string) error {
+	rows, err := db.Query("SELECT id, content FROM "+table+" WHERE html_version != $1", markdown.Version)
+	if err != nil {
+		return err
+	}
+
+	stale := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		stale[id] = content
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, content := range stale {
+		_, err := db.Exec("UPDATE "+table+" SET content_html = $1, html_version = $2 WHERE id = $3", markdown.Render(content), markdown.Version, id)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"database/sql"
+	"forum/pkg/models"
+	"forum/pkg/ranking"
+	"strconv"
+	"time"
+)
+
+type RankingService struct {
+	db    *sql.DB
+	posts *PostService
+}
+
+func NewRankingService(db *sql.DB, posts *PostService) *RankingService {
+	return &RankingService{db: db, posts: posts}
+}
+
+// GetRankedPosts returns limit posts of forumIDs in the order of sort,
+// starting at offset, and how many such posts there are in total. Top and
+// controversial listings only hold the posts created in period.
+func (s *RankingService) GetRankedPosts(sort, period string, forumIDs []int, limit, offset int) ([]models.PostWithCats, int, error) {
+	where := " FROM posts p LEFT JOIN post_scores s ON s.post_id = p.id WHERE p.pending = 0 AND p.forum_id IN (" + intsToList(forumIDs) + ")"
+	var args []interface{}
+
+	if sort == ranking.SortTop || sort == ranking.SortControversial {
+		if since, ok := ranking.Since(period, time.Now().UTC()); ok {
+			args = append(args, since.Format(sqliteTime))
+			where += " AND p.created_at >= $" + strconv.Itoa(len(args))
+		}
+	}
+
+	var total int
+	err := s.db.QueryRow("SELECT COUNT(*)"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var order string
+	switch sort {
+	case ranking.SortNew:
+		order = " ORDER BY p.created_at DESC, p.id DESC"
+	case ranking.SortTop:
+		order = " ORDER BY COALESCE(s.score, 0) DESC, p.id DESC"
+	case ranking.SortControversial:
+		order = " ORDER BY COALESCE(s.controversy, 0) DESC, p.id DESC"
+	default:
+		order = " ORDER BY COALESCE(s.hot, 0) DESC, p.id DESC"
+	}
+
+	args = append(args, limit, offset)
+	rows, err := s.db.Query("SELECT "+prefixedPostColumns+where+order+
+		" LIMIT $"+strconv.Itoa(len(args)-1)+" OFFSET $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var posts []models.PostWithCats
+	var ids []int
+
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		posts = append(posts, models.PostWithCats{
+			ID:          post.ID,
+			UID:         post.UID,
+			ForumID:     post.ForumID,
+			Title:       post.Title,
+			Content:     post.Content,
+			ContentHTML: post.ContentHTML,
+			CreatedAt:   post.CreatedAt,
+		})
+		ids = append(ids, post.ID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	cats, err := s.posts.getCatsForPosts(ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range posts {
+		posts[i].Cats = cats[posts[i].ID]
+	}
+
+	return posts, total, nil
+}
+
+// RefreshScores scores the posts that have no score yet, such as the posts
+// of a database created before ranking.
+func (s *RankingService) RefreshScores() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id FROM posts WHERE id NOT IN (SELECT post_id FROM post_scores)")
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := refreshPostScore(tx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// refreshPostScore recomputes the stored scores of postID from its reactions
+// and comments as part of tx, which changed them. Reactions with a positive
+// weight count as ups and the others as downs.
+func refreshPostScore(tx *sql.Tx, postID int) error {
+	var created time.Time
+	err := tx.QueryRow("SELECT created_at FROM posts WHERE id = $1", postID).Scan(&created)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.NotFoundAnything
+		default:
+			return err
+		}
+	}
+
+	var ups, downs, comments int
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN weight > 0 THEN weight END), 0), COALESCE(SUM(CASE WHEN weight < 0 THEN -weight END), 0)
+		FROM reactions
+		WHERE target = 'post' AND target_id = $1`, postID).Scan(&ups, &downs)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow("SELECT COUNT(*) FROM comments WHERE post_id = $1 AND pending = 0", postID).Scan(&comments)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO post_scores (post_id, ups, downs, comments, score, hot, controversy) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT(post_id) DO UPDATE SET ups = excluded.ups, downs = excluded.downs, comments = excluded.comments,
+			score = excluded.score, hot = excluded.hot, controversy = excluded.controversy`,
+		postID, ups, downs, comments, ranking.Score(ups, downs), ranking.Hot(ups, downs, comments, created), ranking.Controversy(ups, downs))
+	return err
+}
@@ -2,127 +2,389 @@ package services
 
 import (
 	"database/sql"
+	"forum/pkg/events"
 	"forum/pkg/models"
+	"forum/pkg/utils/logger"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ReactionService struct {
-	db *sql.DB
+	db            *sql.DB
+	notifications *NotificationService
+	hub           *events.Hub
+	webhooks      *WebhookService
+	config        models.ReactionConfig
 }
 
-func NewReactionService(db *sql.DB) *ReactionService {
-	return &ReactionService{db: db}
+func NewReactionService(db *sql.DB, notifications *NotificationService, hub *events.Hub, webhooks *WebhookService, config models.ReactionConfig) *ReactionService {
+	return &ReactionService{db: db, notifications: notifications, hub: hub, webhooks: webhooks, config: config}
 }
 
+// Kinds returns the reactions offered on target.
+func (s *ReactionService) Kinds(target string) models.ReactionSet {
+	if target == models.ReactionTargetComment {
+		return s.config.Comment
+	}
+	return s.config.Post
+}
+
+// SubmitReactionForPost toggles the reaction of reaction.UID of the given
+// kind on the post reaction.SubjectID.
 func (s *ReactionService) SubmitReactionForPost(reaction models.Reaction) error {
-	if reaction.Sign != 1 && reaction.Sign != -1 {
-		return models.SignIsMismatch
+	kind, ok := s.config.Post.Kind(reaction.Kind)
+	if !ok {
+		return models.ErrUnknownReaction
+	}
+	var authorID string
+	err := s.db.QueryRow("SELECT uid FROM posts WHERE id = $1", reaction.SubjectID).Scan(&authorID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.NotFoundAnything
+		}
+		return err
+	}
+	if err := checkPostAccess(s.db, reaction.UID, reaction.SubjectID, forumActionRead); err != nil {
+		return err
 	}
-	existingSign, err := s.GetReactionSignForPost(reaction.UID, reaction.SubjectID)
+
+	added, err := s.toggle(models.ReactionTargetPost, s.config.Post, reaction, kind, authorID)
 	if err != nil {
 		return err
 	}
 
-	if existingSign == reaction.Sign {
-		return s.DeleteReactionForPost(reaction.UID, reaction.SubjectID)
+	// The reaction is saved; failures to pass it on are only logged.
+	if err := s.publishCounts(reaction.SubjectID, 0); err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
+	if err := s.emit(reaction, kind, added, reaction.SubjectID, 0); err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
+	if !added || kind.Weight < 0 {
+		return nil
 	}
 
-	if existingSign != 0 {
-		return s.SwapReactionForPost(reaction.UID, reaction.SubjectID, reaction.Sign)
+	err = s.notifications.Notify(models.Notification{
+		UID:      authorID,
+		ActorUID: reaction.UID,
+		Type:     models.NotifyReaction,
+		PostID:   reaction.SubjectID,
+	})
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
 	}
 
-	return s.InsertReactionForPost(reaction)
+	return nil
 }
 
+// SubmitReactionForComment toggles the reaction of reaction.UID of the given
+// kind on the comment reaction.SubjectID.
 func (s *ReactionService) SubmitReactionForComment(reaction models.Reaction) error {
-	if reaction.Sign != 1 && reaction.Sign != -1 {
-		return models.SignIsMismatch
+	kind, ok := s.config.Comment.Kind(reaction.Kind)
+	if !ok {
+		return models.ErrUnknownReaction
 	}
-	existingSign, err := s.GetReactionSignForComment(reaction.UID, reaction.SubjectID)
+	var postID int
+	var authorID string
+	err := s.db.QueryRow("SELECT post_id, uid FROM comments WHERE id = $1", reaction.SubjectID).Scan(&postID, &authorID)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.NotFoundAnything
+		}
+		return err
+	}
+	if err := checkCommentAccess(s.db, reaction.UID, postID, reaction.SubjectID, forumActionRead); err != nil {
 		return err
 	}
 
-	if existingSign == reaction.Sign {
-		return s.DeleteReactionForComment(reaction.UID, reaction.SubjectID)
+	added, err := s.toggle(models.ReactionTargetComment, s.config.Comment, reaction, kind, authorID)
+	if err != nil {
+		return err
 	}
 
-	if existingSign != 0 {
-		return s.SwapReactionForComment(reaction.UID, reaction.SubjectID, reaction.Sign)
+	// The reaction is saved; failures to pass it on are only logged.
+	if err := s.publishCounts(postID, reaction.SubjectID); err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
+	if err := s.emit(reaction, kind, added, postID, reaction.SubjectID); err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
+	if !added || kind.Weight < 0 {
+		return nil
 	}
 
-	return s.InsertReactionForComment(reaction)
+	err = s.notifications.Notify(models.Notification{
+		UID:       authorID,
+		ActorUID:  reaction.UID,
+		Type:      models.NotifyReaction,
+		PostID:    postID,
+		CommentID: reaction.SubjectID,
+	})
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
+
+	return nil
 }
 
-func (s *ReactionService) GetReactionCountsForPost(postId int) (int, int, error) {
-	var likes, dislikes int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM posts_reactions WHERE post_id = ? AND sign = 1", postId).Scan(&likes)
+// toggle removes the reaction of kind when the user already left it and adds
+// it otherwise. Unless set allows several kinds, adding one replaces the
+// other reactions of the user. The reputation of authorID and the score of a
+// post follow the weights in the same transaction. It reports whether the
+// reaction was added.
+func (s *ReactionService) toggle(target string, set models.ReactionSet, reaction models.Reaction, kind models.ReactionKind, authorID string) (bool, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return 0, 0, err
+		return false, err
 	}
-	err = s.db.QueryRow("SELECT COUNT(*) FROM posts_reactions WHERE post_id = ? AND sign = -1", postId).Scan(&dislikes)
-	if err != nil {
-		return 0, 0, err
+	defer tx.Rollback()
+
+	var weight int
+	err = tx.QueryRow("SELECT weight FROM reactions WHERE user_id = $1 AND target = $2 AND target_id = $3 AND kind = $4",
+		reaction.UID, target, reaction.SubjectID, kind.Name).Scan(&weight)
+	switch err {
+	case nil:
+		_, err := tx.Exec("DELETE FROM reactions WHERE user_id = $1 AND target = $2 AND target_id = $3 AND kind = $4",
+			reaction.UID, target, reaction.SubjectID, kind.Name)
+		if err != nil {
+			return false, err
+		}
+		if err := addReputation(tx, authorID, reaction.UID, -weight); err != nil {
+			return false, err
+		}
+		if err := refreshTargetScore(tx, target, reaction.SubjectID); err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	case sql.ErrNoRows:
+	default:
+		return false, err
 	}
-	return likes, dislikes, nil
-}
 
-func (s *ReactionService) GetReactionCountsForComment(comId int) (int, int, error) {
-	var likes, dislikes int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM comments_reactions WHERE comment_id = ? AND sign = 1", comId).Scan(&likes)
-	if err != nil {
-		return 0, 0, err
+	delta := kind.Weight
+	if !set.Multiple {
+		var replaced int
+		err := tx.QueryRow("SELECT COALESCE(SUM(weight), 0) FROM reactions WHERE user_id = $1 AND target = $2 AND target_id = $3",
+			reaction.UID, target, reaction.SubjectID).Scan(&replaced)
+		if err != nil {
+			return false, err
+		}
+		delta -= replaced
+
+		_, err = tx.Exec("DELETE FROM reactions WHERE user_id = $1 AND target = $2 AND target_id = $3", reaction.UID, target, reaction.SubjectID)
+		if err != nil {
+			return false, err
+		}
 	}
-	err = s.db.QueryRow("SELECT COUNT(*) FROM comments_reactions WHERE comment_id = ? AND sign = -1", comId).Scan(&dislikes)
+
+	_, err = tx.Exec("INSERT INTO reactions (user_id, target, target_id, kind, weight, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		reaction.UID, target, reaction.SubjectID, kind.Name, kind.Weight, time.Now().UTC())
 	if err != nil {
-		return 0, 0, err
+		return false, err
+	}
+	if err := addReputation(tx, authorID, reaction.UID, delta); err != nil {
+		return false, err
 	}
-	return likes, dislikes, nil
+	if err := refreshTargetScore(tx, target, reaction.SubjectID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
 }
 
-func (s *ReactionService) GetReactionSignForPost(uid string, postID int) (int, error) {
-	var sign int
-	err := s.db.QueryRow("SELECT sign FROM posts_reactions WHERE user_id = $1 AND post_id = $2", uid, postID).Scan(&sign)
-	if err == sql.ErrNoRows {
-		return 0, nil
+// refreshTargetScore updates the score of the post targetID as part of tx
+// when target is a post. Reactions on comments do not count towards it.
+func refreshTargetScore(tx *sql.Tx, target string, targetID int) error {
+	if target != models.ReactionTargetPost {
+		return nil
 	}
-	return sign, err
+	return refreshPostScore(tx, targetID)
 }
 
-func (s *ReactionService) GetReactionSignForComment(uid string, commentID int) (int, error) {
-	var sign int
-	err := s.db.QueryRow("SELECT sign FROM comments_reactions WHERE user_id = $1 AND comment_id = $2", uid, commentID).Scan(&sign)
-	if err == sql.ErrNoRows {
-		return 0, nil
+// emit sends a reaction event to the webhooks. Sign is the weight of the
+// kind, or 0 when the reaction was taken back.
+func (s *ReactionService) emit(reaction models.Reaction, kind models.ReactionKind, added bool, postID, commentID int) error {
+	user, err := usernameByID(s.db, reaction.UID)
+	if err != nil {
+		return err
+	}
+
+	sign := 0
+	if added {
+		sign = kind.Weight
 	}
-	return sign, err
-}
 
-func (s *ReactionService) InsertReactionForPost(reaction models.Reaction) error {
-	_, err := s.db.Exec("INSERT INTO posts_reactions (user_id, post_id, sign) VALUES ($1, $2, $3)", reaction.UID, reaction.SubjectID, reaction.Sign)
-	return err
+	data := map[string]interface{}{
+		"postId":  postID,
+		"user":    user,
+		"kind":    kind.Name,
+		"removed": !added,
+		"sign":    sign,
+		"url":     s.webhooks.Link("/post/" + strconv.Itoa(postID)),
+	}
+	if commentID != 0 {
+		data["commentId"] = commentID
+		return s.webhooks.EmitForComment(postID, commentID, models.WebhookReaction, data)
+	}
+
+	return s.webhooks.EmitForPost(postID, models.WebhookReaction, data)
 }
 
-func (s *ReactionService) InsertReactionForComment(reaction models.Reaction) error {
-	_, err := s.db.Exec("INSERT INTO comments_reactions (user_id, comment_id, sign) VALUES ($1, $2, $3)", reaction.UID, reaction.SubjectID, reaction.Sign)
-	return err
+// publishCounts pushes the reaction counts of postID, or of commentID on it
+// when set, to the live updates of the post.
+func (s *ReactionService) publishCounts(postID, commentID int) error {
+	var counts []models.ReactionCount
+	var err error
+	if commentID != 0 {
+		counts, err = s.GetReactionsForComment("", commentID)
+	} else {
+		counts, err = s.GetReactionsForPost("", postID)
+	}
+	if err != nil {
+		return err
+	}
+
+	event := reactionsEvent{PostID: postID, CommentID: commentID, Counts: make(map[string]int)}
+	for _, count := range counts {
+		event.Counts[count.Kind.Name] = count.Count
+	}
+
+	return s.hub.Publish(events.PostTopic(postID), eventReactions, event)
 }
 
-func (s *ReactionService) DeleteReactionForPost(uid string, postID int) error {
-	_, err := s.db.Exec("DELETE FROM posts_reactions WHERE user_id = $1 AND post_id = $2", uid, postID)
-	return err
+// SyncWeights gives the stored reactions the weights of their kinds in the
+// configuration, and 0 to kinds that are no longer offered, as each row
+// keeps the weight it was left with. When a weight changed, the reputation
+// of every user and the scores of the posts are computed again.
+func (s *ReactionService) SyncWeights() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	changed := int64(0)
+	for _, target := range []string{models.ReactionTargetPost, models.ReactionTargetComment} {
+		kinds := s.Kinds(target).Kinds
+
+		names := make([]interface{}, 0, len(kinds)+1)
+		names = append(names, target)
+		placeholders := make([]string, len(kinds))
+		for i, kind := range kinds {
+			result, err := tx.Exec("UPDATE reactions SET weight = $1 WHERE target = $2 AND kind = $3 AND weight != $1", kind.Weight, target, kind.Name)
+			if err != nil {
+				return err
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			changed += affected
+
+			names = append(names, kind.Name)
+			placeholders[i] = "$" + strconv.Itoa(i+2)
+		}
+
+		result, err := tx.Exec("UPDATE reactions SET weight = 0 WHERE target = $1 AND weight != 0 AND kind NOT IN ("+strings.Join(placeholders, ", ")+")", names...)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		changed += affected
+	}
+
+	if changed == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`UPDATE users SET reputation =
+		    (SELECT COALESCE(SUM(r.weight), 0) FROM reactions r
+		     JOIN posts p ON p.id = r.target_id
+		     WHERE r.target = 'post' AND p.uid = users.id AND r.user_id != users.id)
+		  + (SELECT COALESCE(SUM(r.weight), 0) FROM reactions r
+		     JOIN comments c ON c.id = r.target_id
+		     WHERE r.target = 'comment' AND c.uid = users.id AND r.user_id != users.id)`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT DISTINCT r.target_id FROM reactions r JOIN posts p ON p.id = r.target_id WHERE r.target = 'post'")
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := refreshPostScore(tx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-func (s *ReactionService) DeleteReactionForComment(uid string, commentID int) error {
-	_, err := s.db.Exec("DELETE FROM comments_reactions WHERE user_id = $1 AND comment_id = $2", uid, commentID)
-	return err
+// GetReactionsForPost returns the counts of every kind offered on posts left
+// on postID, with who reacted. Reacted is set for the kinds uid left.
+func (s *ReactionService) GetReactionsForPost(uid string, postID int) ([]models.ReactionCount, error) {
+	return s.getReactions(models.ReactionTargetPost, s.config.Post, uid, postID)
 }
 
-func (s *ReactionService) SwapReactionForPost(uid string, postID int, newSign int) error {
-	_, err := s.db.Exec("UPDATE posts_reactions SET sign = $1 WHERE user_id = $2 AND post_id = $3", newSign, uid, postID)
-	return err
+// GetReactionsForComment is GetReactionsForPost for comments.
+func (s *ReactionService) GetReactionsForComment(uid string, commentID int) ([]models.ReactionCount, error) {
+	return s.getReactions(models.ReactionTargetComment, s.config.Comment, uid, commentID)
 }
 
-func (s *ReactionService) SwapReactionForComment(uid string, commentID int, newSign int) error {
-	_, err := s.db.Exec("UPDATE comments_reactions SET sign = $1 WHERE user_id = $2 AND comment_id = $3", newSign, uid, commentID)
-	return err
+func (s *ReactionService) getReactions(target string, set models.ReactionSet, uid string, targetID int) ([]models.ReactionCount, error) {
+	counts := make([]models.ReactionCount, len(set.Kinds))
+	index := make(map[string]int)
+	for i, kind := range set.Kinds {
+		counts[i].Kind = kind
+		index[kind.Name] = i
+	}
+
+	rows, err := s.db.Query(`
+		SELECT r.kind, r.user_id, COALESCE(u.username, '')
+		FROM reactions r
+		LEFT JOIN users u ON u.id = r.user_id
+		WHERE r.target = $1 AND r.target_id = $2
+		ORDER BY u.username`, target, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind, userID, username string
+		if err := rows.Scan(&kind, &userID, &username); err != nil {
+			return nil, err
+		}
+
+		i, ok := index[kind]
+		if !ok {
+			continue
+		}
+		counts[i].Count++
+		counts[i].Users = append(counts[i].Users, username)
+		if uid != "" && userID == uid {
+			counts[i].Reacted = true
+		}
+	}
+
+	return counts, rows.Err()
 }
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"forum/pkg/models"
+	"testing"
+)
+
+func TestSyncWeightsFollowsConfig(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec(`
+		INSERT INTO users (id, username, email, password) VALUES ('u1', 'ann', 'ann@example.com', 'x'), ('u2', 'bob', 'bob@example.com', 'x');
+		INSERT INTO posts (id, title, content, uid, forum_id) VALUES (1, 'post', 'x', 'u1', (SELECT id FROM forums WHERE slug = 'general'));
+		INSERT INTO reactions (user_id, target, target_id, kind, weight) VALUES ('u2', 'post', 1, 'like', 1), ('u2', 'post', 1, 'heart', 1);
+		UPDATE users SET reputation = 2 WHERE id = 'u1';`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(kinds []models.ReactionKind, reputation, ups int) {
+		t.Helper()
+		set := models.ReactionSet{Kinds: kinds, Multiple: true}
+		s := NewReactionService(db, nil, nil, nil, models.ReactionConfig{Post: set, Comment: set})
+		if err := s.SyncWeights(); err != nil {
+			t.Fatal(err)
+		}
+
+		var got int
+		if err := db.QueryRow("SELECT reputation FROM users WHERE id = 'u1'").Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != reputation {
+			t.Fatalf("reputation = %d, want %d", got, reputation)
+		}
+		if err := db.QueryRow("SELECT ups FROM post_scores WHERE post_id = 1").Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != ups {
+			t.Fatalf("ups = %d, want %d", got, ups)
+		}
+	}
+
+	// A heavier like counts for more; heart is not offered anymore.
+	check([]models.ReactionKind{{Name: "like", Weight: 3}}, 3, 3)
+	// Offering heart again restores its weight.
+	check([]models.ReactionKind{{Name: "like", Weight: 3}, {Name: "heart", Weight: 2}}, 5, 5)
+}
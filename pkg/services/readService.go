@@ -0,0 +1,83 @@
+package services
+
+import (
+	"database/sql"
+)
+
+// ReadService remembers up to which comment users read each thread, so that
+// listings can show how many comments are new to them.
+type ReadService struct {
+	db *sql.DB
+}
+
+func NewReadService(db *sql.DB) *ReadService {
+	return &ReadService{db: db}
+}
+
+// GetLastRead returns the ID of the last comment of postID uid read. It is
+// false when uid never opened the thread.
+func (s *ReadService) GetLastRead(uid string, postID int) (int, bool, error) {
+	var last int
+	err := s.db.QueryRow("SELECT last_comment_id FROM post_reads WHERE uid = $1 AND post_id = $2", uid, postID).Scan(&last)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+	return last, true, nil
+}
+
+// MarkRead records that uid read postID up to the comment lastCommentID, or
+// 0 when it has none. Markers never move back.
+func (s *ReadService) MarkRead(uid string, postID, lastCommentID int) error {
+	_, err := s.db.Exec(`
+		INSERT INTO post_reads (uid, post_id, last_comment_id) VALUES ($1, $2, $3)
+		ON CONFLICT(uid, post_id) DO UPDATE SET last_comment_id = MAX(last_comment_id, excluded.last_comment_id)`,
+		uid, postID, lastCommentID)
+	return err
+}
+
+// MarkCategoryRead marks every thread of categoryID read up to its latest
+// comment for uid.
+func (s *ReadService) MarkCategoryRead(uid string, categoryID int) error {
+	_, err := s.db.Exec(`
+		INSERT INTO post_reads (uid, post_id, last_comment_id)
+		SELECT $1, pc.post_id, COALESCE((SELECT MAX(c.id) FROM comments c WHERE c.post_id = pc.post_id AND c.pending = 0), 0)
+		FROM post_cats pc
+		WHERE pc.category_id = $2
+		ON CONFLICT(uid, post_id) DO UPDATE SET last_comment_id = MAX(last_comment_id, excluded.last_comment_id)`,
+		uid, categoryID)
+	return err
+}
+
+// GetUnreadCounts returns how many comments each of the threads postIDs uid
+// opened got since uid last read it, by post ID. Threads uid never opened
+// are left out.
+func (s *ReadService) GetUnreadCounts(uid string, postIDs []int) (map[int]int, error) {
+	counts := make(map[int]int)
+	if len(postIDs) == 0 {
+		return counts, nil
+	}
+
+	rows, err := s.db.Query(`
+		SELECT r.post_id, (SELECT COUNT(*) FROM comments c WHERE c.post_id = r.post_id AND c.id > r.last_comment_id AND c.pending = 0)
+		FROM post_reads r
+		WHERE r.uid = $1 AND r.post_id IN (`+intsToList(postIDs)+`)`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID, unread int
+		if err := rows.Scan(&postID, &unread); err != nil {
+			return nil, err
+		}
+		counts[postID] = unread
+	}
+
+	return counts, rows.Err()
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"database/sql"
+	"forum/pkg/models"
+	"strconv"
+)
+
+// reportListSize is how many open reports the staff page shows.
+const reportListSize = 100
+
+type ReportService struct {
+	db       *sql.DB
+	webhooks *WebhookService
+}
+
+func NewReportService(db *sql.DB, webhooks *WebhookService) *ReportService {
+	return &ReportService{db: db, webhooks: webhooks}
+}
+
+// FileReport stores report for the staff. A user can report a post or a
+// comment once.
+func (s *ReportService) FileReport(report models.Report) (int, error) {
+	if err := checkPostAccess(s.db, report.ReporterUID, report.PostID, forumActionRead); err != nil {
+		return 0, err
+	}
+
+	if report.CommentID != 0 {
+		var postID int
+		var authorID string
+		var pending bool
+		err := s.db.QueryRow("SELECT post_id, uid, pending FROM comments WHERE id = $1", report.CommentID).Scan(&postID, &authorID, &pending)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return 0, models.NotFoundAnything
+			default:
+				return 0, err
+			}
+		}
+		if postID != report.PostID {
+			return 0, models.ValueMismatch
+		}
+		if err := checkPending(s.db, report.ReporterUID, authorID, pending); err != nil {
+			return 0, err
+		}
+	}
+
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM reports WHERE reporter_uid = $1 AND post_id = $2 AND COALESCE(comment_id, 0) = $3",
+		report.ReporterUID, report.PostID, report.CommentID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, models.ErrAlreadyReported
+	}
+
+	result, err := s.db.Exec("INSERT INTO reports (reporter_uid, post_id, comment_id, reason) VALUES ($1, $2, $3, $4)",
+		report.ReporterUID, report.PostID, nullableID(report.CommentID), report.Reason)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	reporter, err := usernameByID(s.db, report.ReporterUID)
+	if err != nil {
+		return 0, err
+	}
+
+	link := "/post/" + strconv.Itoa(report.PostID)
+	data := map[string]interface{}{
+		"id":       newID,
+		"postId":   report.PostID,
+		"reason":   report.Reason,
+		"reporter": reporter,
+	}
+	if report.CommentID != 0 {
+		data["commentId"] = report.CommentID
+		link += "#comment-" + strconv.Itoa(report.CommentID)
+	}
+	data["url"] = s.webhooks.Link(link)
+
+	if err := s.webhooks.Emit(models.WebhookReportFiled, data); err != nil {
+		return 0, err
+	}
+
+	return int(newID), nil
+}
+
+// GetReports returns the open reports, oldest first.
+func (s *ReportService) GetReports() ([]models.Report, error) {
+	rows, err := s.db.Query(`
+		SELECT r.id, COALESCE(r.reporter_uid, ''), COALESCE(u.username, ''), r.post_id, COALESCE(r.comment_id, 0), r.reason, r.created_at
+		FROM reports r
+		LEFT JOIN users u ON u.id = r.reporter_uid
+		ORDER BY r.id
+		LIMIT $1`, reportListSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []models.Report
+
+	for rows.Next() {
+		var r models.Report
+
+		err := rows.Scan(&r.ID, &r.ReporterUID, &r.ReporterName, &r.PostID, &r.CommentID, &r.Reason, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		r.Review = r.ReporterUID == "" && r.Reason == reviewReason
+
+		reports = append(reports, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// DismissReport closes the report with ID.
+func (s *ReportService) DismissReport(ID int) error {
+	_, err := s.db.Exec("DELETE FROM reports WHERE id = $1", ID)
+	return err
+}
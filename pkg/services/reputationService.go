@@ -0,0 +1,150 @@
+package services
+
+import (
+	"database/sql"
+	"forum/pkg/models"
+	"strings"
+	"time"
+)
+
+const (
+	// leaderboardSize is how many users the leaderboard lists.
+	leaderboardSize = 50
+	// reviewReason is the reason of the reports that queue the posts and
+	// comments of users who do not skip moderation yet.
+	reviewReason = "New user, awaiting review"
+)
+
+type ReputationService struct {
+	db *sql.DB
+}
+
+func NewReputationService(db *sql.DB) *ReputationService {
+	return &ReputationService{db: db}
+}
+
+// GetTrust returns the reputation of uid with the trust level it gives.
+func (s *ReputationService) GetTrust(uid string) (models.Reputation, error) {
+	return getReputation(s.db, uid)
+}
+
+// Leaderboard returns the users with the highest reputation, best first.
+func (s *ReputationService) Leaderboard() ([]models.Reputation, error) {
+	rows, err := s.db.Query("SELECT username, reputation, created_at, role FROM users ORDER BY reputation DESC, username COLLATE NOCASE LIMIT $1", leaderboardSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var board []models.Reputation
+
+	for rows.Next() {
+		reputation, err := scanReputation(rows)
+		if err != nil {
+			return nil, err
+		}
+		board = append(board, reputation)
+	}
+
+	return board, rows.Err()
+}
+
+func getReputation(db *sql.DB, uid string) (models.Reputation, error) {
+	reputation, err := scanReputation(db.QueryRow("SELECT username, reputation, created_at, role FROM users WHERE id = $1", uid))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.Reputation{}, models.NotFoundAnything
+		default:
+			return models.Reputation{}, err
+		}
+	}
+	return reputation, nil
+}
+
+// scanReputation reads username, reputation, created_at and role. Staff are
+// trusted fully whatever their score.
+func scanReputation(row rowScanner) (models.Reputation, error) {
+	var r models.Reputation
+	var role string
+	if err := row.Scan(&r.Username, &r.Score, &r.CreatedAt, &role); err != nil {
+		return models.Reputation{}, err
+	}
+
+	r.Level = models.TrustLevelFor(r.Score, time.Since(r.CreatedAt))
+	if models.HasRole(role, models.RoleModerator) {
+		r.Level = models.TrustMember
+	}
+	return r, nil
+}
+
+// checkTrust gives ErrTrustTooLow unless the trust level of uid allows it.
+func checkTrust(db *sql.DB, uid string, allowed func(models.TrustLevel) bool) error {
+	reputation, err := getReputation(db, uid)
+	if err != nil {
+		return err
+	}
+	if !allowed(reputation.Level) {
+		return models.ErrTrustTooLow
+	}
+	return nil
+}
+
+// addReputation changes the reputation of authorID by delta as part of tx.
+// Users do not earn reputation from their own reactions.
+func addReputation(tx *sql.Tx, authorID, actorID string, delta int) error {
+	if delta == 0 || authorID == actorID {
+		return nil
+	}
+	_, err := tx.Exec("UPDATE users SET reputation = reputation + $1 WHERE id = $2", delta, authorID)
+	return err
+}
+
+// containsLink reports whether text links to another site.
+func containsLink(text string) bool {
+	text = strings.ToLower(text)
+	return strings.Contains(text, "http://") || strings.Contains(text, "https://") || strings.Contains(text, "www.")
+}
+
+// needsReview reports whether the new posts and comments of uid are held
+// until the staff approve them.
+func needsReview(db *sql.DB, uid string) (bool, error) {
+	reputation, err := getReputation(db, uid)
+	if err != nil {
+		return false, err
+	}
+	return !reputation.Level.SkipsModeration(), nil
+}
+
+// queueForReview reports the held post postID, or the comment commentID on
+// it when not 0, to the staff as part of tx.
+func queueForReview(tx *sql.Tx, postID, commentID int) error {
+	_, err := tx.Exec("INSERT INTO reports (reporter_uid, post_id, comment_id, reason) VALUES (NULL, $1, $2, $3)",
+		postID, nullableID(commentID), reviewReason)
+	return err
+}
+
+// approveReview clears the pending flag of the row ID of table and closes
+// its review report as part of tx. Rows that are not held give
+// NotFoundAnything.
+func approveReview(tx *sql.Tx, table string, ID int) error {
+	result, err := tx.Exec("UPDATE "+table+" SET pending = 0 WHERE id = $1 AND pending = 1", ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.NotFoundAnything
+	}
+
+	subject := "post_id = $2 AND comment_id IS NULL"
+	if table == "comments" {
+		subject = "comment_id = $2"
+	}
+	_, err = tx.Exec("DELETE FROM reports WHERE reporter_uid IS NULL AND reason = $1 AND "+subject, reviewReason, ID)
+	return err
+}
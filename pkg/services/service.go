@@ -1,21 +1,78 @@
 package services
 
-import "database/sql"
+import (
+	"database/sql"
+	"forum/pkg/events"
+	"forum/pkg/mailer"
+	"forum/pkg/models"
+	"forum/pkg/storage"
+)
 
 type Service struct {
-	UserService     UserService
-	PostService     PostService
-	CommentService  CommentService
-	SessionService  SessionService
-	ReactionService ReactionService
+	UserService          UserService
+	PostService          PostService
+	CommentService       CommentService
+	SessionService       SessionService
+	ReactionService      ReactionService
+	CategoryService      CategoryService
+	ForumService         ForumService
+	VerificationService  VerificationService
+	PasswordResetService PasswordResetService
+	TwoFactorService     TwoFactorService
+	SettingsService      SettingsService
+	IdentityService      IdentityService
+	PasswordService      PasswordService
+	UploadService        UploadService
+	MentionService       MentionService
+	NotificationService  NotificationService
+	WebhookService       WebhookService
+	ReportService        ReportService
+	DigestService        DigestService
+	BookmarkService      BookmarkService
+	FollowService        FollowService
+	MessageService       MessageService
+	PollService          PollService
+	ReputationService    ReputationService
+	RankingService       RankingService
+	ReadService          ReadService
+	// Events carries live updates to SSE clients.
+	Events *events.Hub
 }
 
-func NewService(db *sql.DB) *Service {
+func NewService(db *sql.DB, mail mailer.Mailer, passwords *PasswordService, store storage.Storage, maxUpload int64, secret []byte, baseURL string, hub *events.Hub, reactions models.ReactionConfig) *Service {
+	notifications := NewNotificationService(db, hub)
+	webhooks := NewWebhookService(db, baseURL)
+	users := NewUserService(db, passwords, webhooks)
+	uploads := NewUploadService(db, store, maxUpload)
+	posts := NewPostService(db, notifications, webhooks, uploads)
+
 	return &Service{
-		UserService:     *NewUserService(db),
-		PostService:     *NewPostService(db),
-		ReactionService: *NewReactionService(db),
-		CommentService:  *NewCommentService(db),
-		SessionService:  *NewSessionService(db),
+		UserService:          *users,
+		PostService:          *posts,
+		ReactionService:      *NewReactionService(db, notifications, hub, webhooks, reactions),
+		CommentService:       *NewCommentService(db, notifications, hub, webhooks),
+		SessionService:       *NewSessionService(db),
+		CategoryService:      *NewCategoryService(db),
+		ForumService:         *NewForumService(db),
+		VerificationService:  *NewVerificationService(db, mail, secret, baseURL),
+		PasswordResetService: *NewPasswordResetService(db, mail, passwords, baseURL),
+		TwoFactorService:     *NewTwoFactorService(db, secret),
+		SettingsService:      *NewSettingsService(db),
+		IdentityService:      *NewIdentityService(db, users),
+		PasswordService:      *passwords,
+		UploadService:        *uploads,
+		MentionService:       *NewMentionService(db, mail, notifications, baseURL),
+		NotificationService:  *notifications,
+		WebhookService:       *webhooks,
+		ReportService:        *NewReportService(db, webhooks),
+		DigestService:        *NewDigestService(db, mail, secret, baseURL),
+		BookmarkService:      *NewBookmarkService(db, posts),
+		FollowService:        *NewFollowService(db, posts),
+		MessageService:       *NewMessageService(db),
+		PollService:          *NewPollService(db),
+		ReputationService:    *NewReputationService(db),
+		RankingService:       *NewRankingService(db, posts),
+		ReadService:          *NewReadService(db),
+		Events:               hub,
 	}
 }
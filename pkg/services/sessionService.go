@@ -71,3 +71,12 @@ func (s *SessionService) DeleteSessionByID(ID string) error {
 
 	return nil
 }
+
+func (s *SessionService) DeleteSessionsByUID(UID string) error {
+	_, err := s.db.Exec("DELETE FROM sessions WHERE uid = $1", UID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
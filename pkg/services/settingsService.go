@@ -0,0 +1,50 @@
+package services
+
+import "database/sql"
+
+// Keys of site-wide settings managed by administrators.
+const (
+	SettingRequireStaffTwoFactor = "require_staff_2fa"
+)
+
+type SettingsService struct {
+	db *sql.DB
+}
+
+func NewSettingsService(db *sql.DB) *SettingsService {
+	return &SettingsService{db: db}
+}
+
+// Get returns the value stored under key or fallback when it is unset.
+func (s *SettingsService) Get(key, fallback string) (string, error) {
+	var value string
+	err := s.db.QueryRow("SELECT value FROM settings WHERE key = $1", key).Scan(&value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fallback, nil
+		}
+		return "", err
+	}
+
+	return value, nil
+}
+
+func (s *SettingsService) Set(key, value string) error {
+	_, err := s.db.Exec("INSERT INTO settings (key, value) VALUES ($1, $2) ON CONFLICT(key) DO UPDATE SET value = excluded.value", key, value)
+	return err
+}
+
+func (s *SettingsService) GetBool(key string) (bool, error) {
+	value, err := s.Get(key, "0")
+	if err != nil {
+		return false, err
+	}
+	return value == "1", nil
+}
+
+func (s *SettingsService) SetBool(key string, value bool) error {
+	if value {
+		return s.Set(key, "1")
+	}
+	return s.Set(key, "0")
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"forum/pkg/models"
+	"forum/pkg/utils/tokens"
+	"forum/pkg/utils/totp"
+	"strings"
+	"time"
+)
+
+const (
+	twoFactorLoginPurpose = "2fa-login"
+	twoFactorLoginTTL     = 5 * time.Minute
+	recoveryCodeCount     = 10
+	recoveryCodeAlphabet  = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	// A login token stops working after twoFactorTokenAttempts wrong codes,
+	// and a user cannot try more than twoFactorUserAttempts wrong codes per
+	// twoFactorAttemptWindow however many tokens they get.
+	twoFactorTokenAttempts = 5
+	twoFactorUserAttempts  = 10
+	twoFactorAttemptWindow = 15 * time.Minute
+)
+
+type TwoFactorService struct {
+	db     *sql.DB
+	secret []byte
+}
+
+func NewTwoFactorService(db *sql.DB, secret []byte) *TwoFactorService {
+	return &TwoFactorService{db: db, secret: secret}
+}
+
+// BeginEnrollment stores a fresh, not yet enabled TOTP secret for uid and
+// returns it.
+func (s *TwoFactorService) BeginEnrollment(uid string) (string, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.db.Exec("UPDATE users SET totp_secret = $1 WHERE id = $2 AND totp_enabled = 0", secret, uid)
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// Enable turns 2FA on once the user proves they can produce codes for the
+// pending secret. Fresh recovery codes are returned in plain text exactly once.
+func (s *TwoFactorService) Enable(uid, code string) ([]string, error) {
+	var secret string
+	err := s.db.QueryRow("SELECT totp_secret FROM users WHERE id = $1", uid).Scan(&secret)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, models.ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := totp.Match(secret, code, time.Now(), 1)
+	if !ok {
+		return nil, models.ErrInvalidTwoFactorCode
+	}
+
+	_, err = s.db.Exec("UPDATE users SET totp_enabled = 1, totp_last_step = $1 WHERE id = $2", step, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.RegenerateRecoveryCodes(uid)
+}
+
+func (s *TwoFactorService) Disable(uid string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totp_enabled = 0, totp_secret = '', totp_last_step = 0 WHERE id = $1", uid)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE uid = $1", uid)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of uid.
+func (s *TwoFactorService) RegenerateRecoveryCodes(uid string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE uid = $1", uid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		_, err := tx.Exec("INSERT INTO recovery_codes (uid, code_hash) VALUES ($1, $2)", uid, hashRecoveryCode(code))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifyCode accepts either a current TOTP code or an unused recovery code,
+// burning the latter. A TOTP code is accepted once, and after too many wrong
+// codes models.ErrRateLimited is returned until the window passes.
+func (s *TwoFactorService) VerifyCode(uid, code string) error {
+	return s.verifyCode(uid, "", code)
+}
+
+// verifyCode is VerifyCode that records failures against the login token
+// with tokenHash as well.
+func (s *TwoFactorService) verifyCode(uid, tokenHash, code string) error {
+	var secret string
+	var enabled bool
+	err := s.db.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id = $1", uid).Scan(&secret, &enabled)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return models.ErrTwoFactorNotEnrolled
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	_, err = tx.Exec("DELETE FROM two_factor_failures WHERE created_at <= $1", now.Add(-twoFactorAttemptWindow))
+	if err != nil {
+		return err
+	}
+
+	var failures int
+	err = tx.QueryRow("SELECT COUNT(*) FROM two_factor_failures WHERE uid = $1", uid).Scan(&failures)
+	if err != nil {
+		return err
+	}
+	if failures >= twoFactorUserAttempts {
+		return models.ErrRateLimited
+	}
+
+	accepted, err := acceptCode(tx, uid, secret, code)
+	if err != nil {
+		return err
+	}
+
+	if !accepted {
+		_, err = tx.Exec("INSERT INTO two_factor_failures (uid, token_hash, created_at) VALUES ($1, $2, $3)", uid, tokenHash, now)
+		if err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return models.ErrInvalidTwoFactorCode
+	}
+
+	_, err = tx.Exec("DELETE FROM two_factor_failures WHERE uid = $1", uid)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// acceptCode reports whether code is a TOTP code of a step after the last
+// one uid used, or one of their unused recovery codes, and uses it up.
+func acceptCode(tx *sql.Tx, uid, secret, code string) (bool, error) {
+	if step, ok := totp.Match(secret, code, time.Now(), 1); ok {
+		result, err := tx.Exec("UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1", step, uid)
+		if err != nil {
+			return false, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		return affected > 0, nil
+	}
+
+	result, err := tx.Exec("UPDATE recovery_codes SET used = 1 WHERE uid = $1 AND code_hash = $2 AND used = 0", uid, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// StartLogin returns a short-lived token proving that uid passed the password
+// step and still has to enter a second factor.
+func (s *TwoFactorService) StartLogin(uid string) string {
+	return tokens.Sign(s.secret, twoFactorLoginPurpose, uid, time.Now().Add(twoFactorLoginTTL))
+}
+
+// CompleteLogin checks the second factor for a token issued by StartLogin.
+// The token becomes invalid after twoFactorTokenAttempts wrong codes.
+func (s *TwoFactorService) CompleteLogin(token, code string) (string, error) {
+	uid, err := tokens.Verify(s.secret, twoFactorLoginPurpose, token)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	tokenHash := hex.EncodeToString(sum[:])
+
+	var failures int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM two_factor_failures WHERE token_hash = $1", tokenHash).Scan(&failures)
+	if err != nil {
+		return "", err
+	}
+	if failures >= twoFactorTokenAttempts {
+		return "", tokens.ErrInvalid
+	}
+
+	if err := s.verifyCode(uid, tokenHash, code); err != nil {
+		return "", err
+	}
+
+	return uid, nil
+}
+
+func (s *TwoFactorService) RemainingRecoveryCodes(uid string) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE uid = $1 AND used = 0", uid).Scan(&count)
+	return count, err
+}
+
+func randomRecoveryCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i, c := range raw {
+		if i == 5 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(recoveryCodeAlphabet[int(c)%len(recoveryCodeAlphabet)])
+	}
+	return b.String(), nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"forum/pkg/models"
+	"forum/pkg/storage"
+	"forum/pkg/utils/images"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// thumbSize is the bounding square of thumbnails, also used for avatars.
+const thumbSize = 256
+
+type UploadService struct {
+	db       *sql.DB
+	store    storage.Storage
+	maxBytes int64
+}
+
+func NewUploadService(db *sql.DB, store storage.Storage, maxBytes int64) *UploadService {
+	return &UploadService{db: db, store: store, maxBytes: maxBytes}
+}
+
+// MaxBytes is the largest accepted upload.
+func (s *UploadService) MaxBytes() int64 {
+	return s.maxBytes
+}
+
+// Save validates the image read from r, stores it with its thumbnail and
+// records it as an upload of uid not yet attached to a post.
+func (s *UploadService) Save(uid string, r io.Reader) (models.Upload, error) {
+	data, err := io.ReadAll(io.LimitReader(r, s.maxBytes+1))
+	if err != nil {
+		return models.Upload{}, err
+	}
+	if int64(len(data)) > s.maxBytes {
+		return models.Upload{}, models.ErrUploadTooLarge
+	}
+
+	img, err := images.Process(data, thumbSize)
+	if err != nil {
+		switch err {
+		case images.ErrUnsupported:
+			return models.Upload{}, models.ErrUnsupportedUpload
+		case images.ErrTooLarge:
+			return models.Upload{}, models.ErrUploadTooLarge
+		default:
+			return models.Upload{}, err
+		}
+	}
+
+	upload := models.Upload{
+		ID:          uuid.New().String(),
+		UID:         uid,
+		ContentType: img.ContentType,
+		Ext:         img.Ext,
+		Width:       img.Width,
+		Height:      img.Height,
+		Size:        len(img.Data),
+	}
+
+	if err := s.store.Put(upload.ID+upload.Ext, bytes.NewReader(img.Data)); err != nil {
+		return models.Upload{}, err
+	}
+	if err := s.store.Put(upload.ID+"_thumb"+upload.Ext, bytes.NewReader(img.Thumb)); err != nil {
+		s.store.Delete(upload.ID + upload.Ext)
+		return models.Upload{}, err
+	}
+
+	_, err = s.db.Exec("INSERT INTO uploads (id, uid, content_type, ext, width, height, size) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		upload.ID, upload.UID, upload.ContentType, upload.Ext, upload.Width, upload.Height, upload.Size)
+	if err != nil {
+		s.deleteFiles(upload)
+		return models.Upload{}, err
+	}
+
+	return upload, nil
+}
+
+// AttachToPost links uploads of uid to postID.
+func (s *UploadService) AttachToPost(uploads []models.Upload, postID int) error {
+	for _, upload := range uploads {
+		_, err := s.db.Exec("UPDATE uploads SET post_id = $1 WHERE id = $2 AND uid = $3", postID, upload.ID, upload.UID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *UploadService) GetUploadsByPostID(postID int) ([]models.Upload, error) {
+	rows, err := s.db.Query("SELECT id, uid, post_id, content_type, ext, width, height, size, created_at FROM uploads WHERE post_id = $1 ORDER BY created_at, id", postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uploads []models.Upload
+
+	for rows.Next() {
+		upload := models.Upload{}
+
+		err := rows.Scan(&upload.ID,
+			&upload.UID,
+			&upload.PostID,
+			&upload.ContentType,
+			&upload.Ext,
+			&upload.Width,
+			&upload.Height,
+			&upload.Size,
+			&upload.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		uploads = append(uploads, upload)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return uploads, nil
+}
+
+// DeleteUpload removes an upload and its files.
+func (s *UploadService) DeleteUpload(upload models.Upload) error {
+	_, err := s.db.Exec("DELETE FROM uploads WHERE id = $1", upload.ID)
+	if err != nil {
+		return err
+	}
+	return s.deleteFiles(upload)
+}
+
+// DeleteAvatar removes the upload of uid whose thumbnail URL is avatar, once
+// a new avatar replaced it. Avatars that are no upload of uid are ignored.
+func (s *UploadService) DeleteAvatar(uid, avatar string) error {
+	name := strings.TrimPrefix(avatar, "/uploads/")
+	if name == avatar {
+		return nil
+	}
+	id := strings.TrimSuffix(strings.TrimSuffix(name, path.Ext(name)), "_thumb")
+
+	upload := models.Upload{ID: id, UID: uid}
+	err := s.db.QueryRow("SELECT ext FROM uploads WHERE id = $1 AND uid = $2 AND post_id IS NULL", id, uid).Scan(&upload.Ext)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	return s.DeleteUpload(upload)
+}
+
+// Open returns the stored file name and its content type.
+func (s *UploadService) Open(name string) (storage.File, string, error) {
+	file, err := s.store.Open(name)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return nil, "", models.NotFoundAnything
+		}
+		return nil, "", err
+	}
+
+	contentType := mime.TypeByExtension(strings.ToLower(path.Ext(name)))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return file, contentType, nil
+}
+
+func (s *UploadService) deleteFiles(upload models.Upload) error {
+	if err := s.store.Delete(upload.ID + upload.Ext); err != nil {
+		return err
+	}
+	return s.store.Delete(upload.ID + "_thumb" + upload.Ext)
+}
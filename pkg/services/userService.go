@@ -3,33 +3,51 @@ package services
 import (
 	"database/sql"
 	"forum/pkg/models"
+	"forum/pkg/utils/logger"
+	"strings"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const userColumns = "id, username, password, email, role, email_verified, totp_secret, totp_enabled, display_name, bio, avatar, created_at"
+
 type UserService struct {
-	db *sql.DB
+	db        *sql.DB
+	passwords *PasswordService
+	webhooks  *WebhookService
 }
 
-func NewUserService(db *sql.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *sql.DB, passwords *PasswordService, webhooks *WebhookService) *UserService {
+	return &UserService{db: db, passwords: passwords, webhooks: webhooks}
 }
 
 func (s *UserService) RegisterUser(user models.User) (models.User, error) {
 	NewID := uuid.New().String()
-	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hash, err := s.passwords.Hash(user.Password)
 	if err != nil {
 		return models.User{}, err
 	}
 
 	user.ID = NewID
-	user.Password = string(hash)
+	user.Password = hash
+	user.Role = models.RoleUser
 
 	newUser, err := s.createUser(user)
 	if err != nil {
 		return models.User{}, err
 	}
+
+	// The account exists; a failure to queue the webhooks is only logged.
+	err = s.webhooks.Emit(models.WebhookUserRegistered, map[string]interface{}{
+		"id":       newUser.ID,
+		"username": newUser.Username,
+		"url":      s.webhooks.Link("/u/" + newUser.Username),
+	})
+	if err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
+
 	return newUser, nil
 }
 
@@ -43,15 +61,134 @@ func (s *UserService) AuthenticateUser(login, pass string) (models.User, error)
 		return models.User{}, models.ErrInvalidCredentials
 	}
 
+	// The plain password is only known here, so hashes made with an older,
+	// cheaper cost are upgraded on a successful login.
+	if s.passwords.NeedsRehash(user.Password) {
+		if err := s.UpdatePassword(user.ID, pass); err != nil {
+			return models.User{}, err
+		}
+	}
+
 	return user, nil
 }
 
+func (s *UserService) UpdatePassword(id, pass string) error {
+	hash, err := s.passwords.Hash(pass)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("UPDATE users SET password = $1 WHERE id = $2", hash, id)
+	return err
+}
+
+// ChangePassword replaces the password of user id after checking the current one.
+func (s *UserService) ChangePassword(id, current, pass string) error {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(current)) != nil {
+		return models.ErrInvalidCredentials
+	}
+
+	return s.UpdatePassword(id, pass)
+}
+
+// ChangeEmail moves the account id to email when current is its password.
+// The new address starts unconfirmed.
+func (s *UserService) ChangeEmail(id, current, email string) error {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(current)) != nil {
+		return models.ErrInvalidCredentials
+	}
+
+	return s.UpdateEmail(id, email)
+}
+
+// GetUserByUsername returns the user with username, ignoring case, for public
+// pages.
+func (s *UserService) GetUserByUsername(username string) (models.User, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = $1 COLLATE NOCASE", username))
+	if err == sql.ErrNoRows {
+		return models.User{}, models.NotFoundAnything
+	}
+	return user, err
+}
+
+func (s *UserService) UpdateProfile(id, displayName, bio string) error {
+	_, err := s.db.Exec("UPDATE users SET display_name = $1, bio = $2 WHERE id = $3", displayName, bio, id)
+	return err
+}
+
+// SuggestUsers returns up to limit users whose username starts with prefix,
+// ignoring case.
+func (s *UserService) SuggestUsers(prefix string, limit int) ([]models.User, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)
+
+	rows, err := s.db.Query("SELECT "+userColumns+" FROM users WHERE username LIKE $1 ESCAPE '\\' ORDER BY username COLLATE NOCASE LIMIT $2", escaped+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (s *UserService) UpdateAvatar(id, avatar string) error {
+	_, err := s.db.Exec("UPDATE users SET avatar = $1 WHERE id = $2", avatar, id)
+	return err
+}
+
+// GetUserStats counts the posts and comments of user id and reads their
+// reputation.
+func (s *UserService) GetUserStats(id string) (models.UserStats, error) {
+	var stats models.UserStats
+
+	err := s.db.QueryRow("SELECT COUNT(*) FROM posts WHERE uid = $1 AND pending = 0", id).Scan(&stats.PostCount)
+	if err != nil {
+		return models.UserStats{}, err
+	}
+
+	err = s.db.QueryRow("SELECT COUNT(*) FROM comments WHERE uid = $1 AND pending = 0", id).Scan(&stats.CommentCount)
+	if err != nil {
+		return models.UserStats{}, err
+	}
+
+	err = s.db.QueryRow("SELECT reputation FROM users WHERE id = $1", id).Scan(&stats.Karma)
+	if err != nil {
+		return models.UserStats{}, err
+	}
+
+	return stats, nil
+}
+
 func (s *UserService) createUser(user models.User) (models.User, error) {
-	_, err := s.db.Exec("INSERT INTO users (id,username, password, email) VALUES ($1, $2, $3, $4)",
+	_, err := s.db.Exec("INSERT INTO users (id,username, password, email, role) VALUES ($1, $2, $3, $4, $5)",
 		user.ID,
 		user.Username,
 		user.Password,
-		user.Email)
+		user.Email,
+		user.Role)
 	if err != nil {
 		switch err.Error() {
 		case "UNIQUE constraint failed: users.email":
@@ -67,11 +204,7 @@ func (s *UserService) createUser(user models.User) (models.User, error) {
 }
 
 func (s *UserService) GetUserByID(id string) (models.User, error) {
-	var user models.User
-	err := s.db.QueryRow("SELECT id , username , password , email FROM users WHERE id = $1", id).Scan(&user.ID,
-		&user.Username,
-		&user.Password,
-		&user.Email)
+	user, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1", id))
 	if err != nil {
 		return models.User{}, err
 	}
@@ -79,12 +212,72 @@ func (s *UserService) GetUserByID(id string) (models.User, error) {
 	return user, nil
 }
 
+func (s *UserService) GetUserByEmail(email string) (models.User, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE email = $1", email))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.User{}, models.NotFoundAnything
+		default:
+			return models.User{}, err
+		}
+	}
+
+	return user, nil
+}
+
 func (s *UserService) getUserByUsername(username string) (models.User, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = $1 COLLATE NOCASE", username))
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func (s *UserService) SetEmailVerified(id string, verified bool) error {
+	_, err := s.db.Exec("UPDATE users SET email_verified = $1 WHERE id = $2", verified, id)
+	return err
+}
+
+// UpdateEmail changes the address of a user and marks it as unverified.
+func (s *UserService) UpdateEmail(id, email string) error {
+	_, err := s.db.Exec("UPDATE users SET email = $1, email_verified = 0 WHERE id = $2", email, id)
+	if err != nil {
+		if err.Error() == "UNIQUE constraint failed: users.email" {
+			return models.UniqueConstraintEmail
+		}
+		return err
+	}
+
+	return nil
+}
+
+func scanUser(row rowScanner) (models.User, error) {
 	var user models.User
-	err := s.db.QueryRow("SELECT id , username, password , email FROM users WHERE username = $1", username).Scan(&user.ID, &user.Username, &user.Password, &user.Email)
+	err := row.Scan(&user.ID,
+		&user.Username,
+		&user.Password,
+		&user.Email,
+		&user.Role,
+		&user.EmailVerified,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Avatar,
+		&user.CreatedAt)
 	if err != nil {
 		return models.User{}, err
 	}
 
 	return user, nil
 }
+
+// usernameByID returns the username of user id for payloads of other
+// services.
+func usernameByID(db *sql.DB, id string) (string, error) {
+	var username string
+	err := db.QueryRow("SELECT username FROM users WHERE id = $1", id).Scan(&username)
+	return username, err
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/pkg/mailer"
+	"forum/pkg/models"
+	"forum/pkg/utils/tokens"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	verifyPurpose = "verify-email"
+	verifyTTL     = 24 * time.Hour
+)
+
+type VerificationService struct {
+	db      *sql.DB
+	mailer  mailer.Mailer
+	secret  []byte
+	baseURL string
+}
+
+func NewVerificationService(db *sql.DB, mail mailer.Mailer, secret []byte, baseURL string) *VerificationService {
+	return &VerificationService{db: db, mailer: mail, secret: secret, baseURL: baseURL}
+}
+
+// SendVerification mails user a link confirming their current address.
+// The token is bound to the address, so changing it invalidates old links.
+func (s *VerificationService) SendVerification(user models.User) error {
+	token := tokens.Sign(s.secret, verifyPurpose, user.ID+":"+user.Email, time.Now().Add(verifyTTL))
+	link := s.baseURL + "/verify?token=" + url.QueryEscape(token)
+
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Text: fmt.Sprintf("Hi %s,\n\nconfirm your email by opening the link below. It is valid for %d hours.\n\n%s\n",
+			user.Username, int(verifyTTL.Hours()), link),
+		HTML: fmt.Sprintf("<p>Hi %s,</p><p>confirm your email by opening the link below. It is valid for %d hours.</p><p><a href=\"%s\">%s</a></p>",
+			html.EscapeString(user.Username), int(verifyTTL.Hours()), html.EscapeString(link), html.EscapeString(link)),
+	})
+}
+
+// SendEmailChanged tells user at their previous address that the account
+// now uses email, so that an unexpected change does not go unnoticed.
+func (s *VerificationService) SendEmailChanged(user models.User, email string) error {
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your email was changed",
+		Text: fmt.Sprintf("Hi %s,\n\nyour account now uses the email %s instead of this one. If you did not change it, reset your password and contact the staff.\n",
+			user.Username, email),
+		HTML: fmt.Sprintf("<p>Hi %s,</p><p>your account now uses the email %s instead of this one. If you did not change it, reset your password and contact the staff.</p>",
+			html.EscapeString(user.Username), html.EscapeString(email)),
+	})
+}
+
+// Verify marks the address referenced by token as confirmed.
+func (s *VerificationService) Verify(token string) (string, error) {
+	subject, err := tokens.Verify(s.secret, verifyPurpose, token)
+	if err != nil {
+		return "", err
+	}
+
+	uid, email, ok := strings.Cut(subject, ":")
+	if !ok {
+		return "", tokens.ErrInvalid
+	}
+
+	result, err := s.db.Exec("UPDATE users SET email_verified = 1 WHERE id = $1 AND email = $2", uid, email)
+	if err != nil {
+		return "", err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if affected == 0 {
+		return "", tokens.ErrInvalid
+	}
+
+	return uid, nil
+}
@@ -0,0 +1,493 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"forum/pkg/models"
+	"forum/pkg/oauth"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// webhookMaxAttempts is how many times a delivery is tried before it is
+	// marked as failed.
+	webhookMaxAttempts = 8
+	// webhookBackoff is the wait after the first failed attempt. It doubles
+	// with every further attempt up to webhookMaxBackoff.
+	webhookBackoff    = 30 * time.Second
+	webhookMaxBackoff = 6 * time.Hour
+	webhookTimeout    = 10 * time.Second
+	// webhookBatch is how many due deliveries one pass of the worker sends.
+	webhookBatch = 20
+	// webhookLogSize is how many deliveries the log of a webhook shows.
+	webhookLogSize = 50
+)
+
+// webhookPayload is the JSON body POSTed to webhooks. The X-Forum-Signature
+// header holds "sha256=" and the hex HMAC-SHA256 of the body keyed with the
+// secret of the webhook.
+type webhookPayload struct {
+	ID        int         `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+type WebhookService struct {
+	db      *sql.DB
+	client  *http.Client
+	baseURL string
+	// wake makes the worker look for deliveries before its next tick.
+	wake chan struct{}
+}
+
+func NewWebhookService(db *sql.DB, baseURL string) *WebhookService {
+	return &WebhookService{
+		db:      db,
+		client:  &http.Client{Timeout: webhookTimeout},
+		baseURL: strings.TrimRight(baseURL, "/"),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+func (s *WebhookService) CreateWebhook(url string, events []string) (int, error) {
+	if err := validateWebhook(url, events); err != nil {
+		return 0, err
+	}
+
+	secret, err := oauth.RandomString(32)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := s.db.Exec("INSERT INTO webhooks (url, secret, events) VALUES ($1, $2, $3)", url, secret, strings.Join(events, ","))
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(newID), nil
+}
+
+func (s *WebhookService) UpdateWebhook(ID int, url string, events []string, active bool) error {
+	if err := validateWebhook(url, events); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec("UPDATE webhooks SET url = $1, events = $2, active = $3 WHERE id = $4", url, strings.Join(events, ","), active, ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.NotFoundAnything
+	}
+
+	return nil
+}
+
+func (s *WebhookService) DeleteWebhook(ID int) error {
+	_, err := s.db.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = $1", ID)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec("DELETE FROM webhooks WHERE id = $1", ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.NotFoundAnything
+	}
+
+	return nil
+}
+
+func (s *WebhookService) GetWebhooks() ([]models.Webhook, error) {
+	rows, err := s.db.Query("SELECT id, url, secret, events, active, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []models.Webhook
+
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+func (s *WebhookService) GetWebhookByID(ID int) (models.Webhook, error) {
+	hook, err := scanWebhook(s.db.QueryRow("SELECT id, url, secret, events, active, created_at FROM webhooks WHERE id = $1", ID))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return models.Webhook{}, models.NotFoundAnything
+		default:
+			return models.Webhook{}, err
+		}
+	}
+
+	return hook, nil
+}
+
+// GetDeliveries returns the latest deliveries of webhook ID, newest first.
+func (s *WebhookService) GetDeliveries(ID int) ([]models.WebhookDelivery, error) {
+	rows, err := s.db.Query(`
+		SELECT id, webhook_id, event, payload, status, attempts, response_code, error, next_attempt_at, created_at
+		FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2`, ID, webhookLogSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+
+	for rows.Next() {
+		var d models.WebhookDelivery
+
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.ResponseCode, &d.Error, &d.NextAttempt, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// SendTest queues a ping event for webhook ID only.
+func (s *WebhookService) SendTest(ID int) error {
+	hook, err := s.GetWebhookByID(ID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.enqueue(hook, models.WebhookPing, map[string]interface{}{"webhookId": hook.ID}); err != nil {
+		return err
+	}
+
+	s.notifyWorker()
+	return nil
+}
+
+// Redeliver queues delivery ID again with a fresh set of attempts.
+func (s *WebhookService) Redeliver(ID int) error {
+	result, err := s.db.Exec("UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2 WHERE id = $3",
+		models.DeliveryPending, time.Now().UTC(), ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.NotFoundAnything
+	}
+
+	s.notifyWorker()
+	return nil
+}
+
+// Emit queues event with data for every active webhook subscribed to it.
+func (s *WebhookService) Emit(event string, data interface{}) error {
+	hooks, err := s.GetWebhooks()
+	if err != nil {
+		return err
+	}
+
+	queued := false
+	for _, hook := range hooks {
+		if !hook.Active || !hook.Subscribed(event) {
+			continue
+		}
+		if err := s.enqueue(hook, event, data); err != nil {
+			return err
+		}
+		queued = true
+	}
+
+	if queued {
+		s.notifyWorker()
+	}
+
+	return nil
+}
+
+// EmitForPost queues event like Emit when guests may read postID. Receivers
+// sit outside the forum, so nothing from restricted forums is sent to them.
+func (s *WebhookService) EmitForPost(postID int, event string, data interface{}) error {
+	err := checkPostAccess(s.db, "", postID, forumActionRead)
+	if err == models.ErrForbidden {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.Emit(event, data)
+}
+
+// EmitForComment queues event like EmitForPost when guests may also read
+// commentID on postID, which they may not while it is held for review.
+func (s *WebhookService) EmitForComment(postID, commentID int, event string, data interface{}) error {
+	err := checkCommentAccess(s.db, "", postID, commentID, forumActionRead)
+	if err == models.ErrForbidden {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.Emit(event, data)
+}
+
+// Link turns a path of the forum into an absolute URL for payloads.
+func (s *WebhookService) Link(path string) string {
+	return s.baseURL + path
+}
+
+// Run sends due deliveries until the process exits. It wakes up every
+// interval and whenever an event is queued.
+func (s *WebhookService) Run(interval time.Duration, logError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.deliverDue(); err != nil {
+			logError(err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// enqueue queues a delivery of event to hook. The payload names the
+// delivery, so the row is stored first and completed in the same
+// transaction; the worker never sees it without its payload.
+func (s *WebhookService) enqueue(hook models.Webhook, event string, data interface{}) error {
+	now := time.Now().UTC()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at) VALUES ($1, $2, '', $3, $4, $4)",
+		hook.ID, event, models.DeliveryPending, now)
+	if err != nil {
+		return err
+	}
+
+	deliveryID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(webhookPayload{ID: int(deliveryID), Event: event, CreatedAt: now, Data: data})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE webhook_deliveries SET payload = $1 WHERE id = $2", string(payload), deliveryID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *WebhookService) notifyWorker() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverDue sends the pending deliveries whose next attempt is due.
+func (s *WebhookService) deliverDue() error {
+	rows, err := s.db.Query(`
+		SELECT d.id, d.event, d.payload, d.attempts, w.url, w.secret
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = $1 AND d.next_attempt_at <= $2
+		ORDER BY d.next_attempt_at
+		LIMIT $3`, models.DeliveryPending, time.Now().UTC(), webhookBatch)
+	if err != nil {
+		return err
+	}
+
+	type due struct {
+		id       int
+		event    string
+		payload  string
+		attempts int
+		url      string
+		secret   string
+	}
+
+	var batch []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.event, &d.payload, &d.attempts, &d.url, &d.secret); err != nil {
+			rows.Close()
+			return err
+		}
+		batch = append(batch, d)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range batch {
+		code, sendErr := s.send(d.url, d.secret, d.id, d.event, []byte(d.payload))
+		attempts := d.attempts + 1
+
+		if sendErr == nil {
+			_, err = s.db.Exec("UPDATE webhook_deliveries SET status = $1, attempts = $2, response_code = $3, error = '' WHERE id = $4",
+				models.DeliveryDelivered, attempts, code, d.id)
+		} else {
+			status := models.DeliveryPending
+			if attempts >= webhookMaxAttempts {
+				status = models.DeliveryFailed
+			}
+			_, err = s.db.Exec("UPDATE webhook_deliveries SET status = $1, attempts = $2, response_code = $3, error = $4, next_attempt_at = $5 WHERE id = $6",
+				status, attempts, code, sendErr.Error(), time.Now().UTC().Add(webhookRetryDelay(attempts)), d.id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send POSTs payload to url. Any response other than 2xx is an error.
+func (s *WebhookService) send(url, secret string, deliveryID int, event string, payload []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "forum-webhooks")
+	req.Header.Set("X-Forum-Event", event)
+	req.Header.Set("X-Forum-Delivery", strconv.Itoa(deliveryID))
+	req.Header.Set("X-Forum-Signature", "sha256="+SignWebhook(secret, payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of payload keyed with secret, as
+// sent in the X-Forum-Signature header.
+func SignWebhook(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryDelay is the wait before the attempt after the given number of
+// failed ones.
+func webhookRetryDelay(failed int) time.Duration {
+	delay := webhookBackoff
+	for i := 1; i < failed; i++ {
+		delay *= 2
+		if delay >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return delay
+}
+
+func validateWebhook(url string, events []string) error {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return models.ValueMismatch
+	}
+	if len(events) == 0 {
+		return models.ValueMismatch
+	}
+	for _, event := range events {
+		known := false
+		for _, e := range models.WebhookEvents {
+			if e == event {
+				known = true
+			}
+		}
+		if !known {
+			return models.ValueMismatch
+		}
+	}
+	return nil
+}
+
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var hook models.Webhook
+	var events string
+
+	err := row.Scan(&hook.ID, &hook.URL, &hook.Secret, &events, &hook.Active, &hook.CreatedAt)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	if events != "" {
+		hook.Events = strings.Split(events, ",")
+	}
+
+	return hook, nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"encoding/json"
+	"forum/pkg/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeliverDueSignsPayload(t *testing.T) {
+	db := newTestDB(t)
+	s := NewWebhookService(db, "http://forum.test")
+
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan received, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header, body}
+	}))
+	defer receiver.Close()
+
+	id, err := s.CreateWebhook(receiver.URL, []string{models.WebhookUserRegistered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook, err := s.GetWebhookByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Emit(models.WebhookUserRegistered, map[string]interface{}{"username": "ann"}); err != nil {
+		t.Fatal(err)
+	}
+	// Events the webhook did not subscribe to are not queued.
+	if err := s.Emit(models.WebhookReportFiled, map[string]interface{}{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.deliverDue(); err != nil {
+		t.Fatal(err)
+	}
+
+	var r received
+	select {
+	case r = <-got:
+	default:
+		t.Fatal("receiver was not called")
+	}
+
+	if want := "sha256=" + SignWebhook(hook.Secret, r.body); r.header.Get("X-Forum-Signature") != want {
+		t.Fatalf("signature = %q, want %q", r.header.Get("X-Forum-Signature"), want)
+	}
+	if SignWebhook("other", r.body) == SignWebhook(hook.Secret, r.body) {
+		t.Fatal("signature does not depend on the secret")
+	}
+	if r.header.Get("X-Forum-Event") != models.WebhookUserRegistered {
+		t.Fatalf("event header = %q", r.header.Get("X-Forum-Event"))
+	}
+
+	var payload struct {
+		ID    int
+		Event string
+		Data  map[string]interface{}
+	}
+	if err := json.Unmarshal(r.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != models.WebhookUserRegistered || payload.Data["username"] != "ann" {
+		t.Fatalf("payload = %s", r.body)
+	}
+	if r.header.Get("X-Forum-Delivery") != strconv.Itoa(payload.ID) {
+		t.Fatalf("delivery header = %q, payload id %d", r.header.Get("X-Forum-Delivery"), payload.ID)
+	}
+
+	deliveries, err := s.GetDeliveries(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("%d deliveries, want 1", len(deliveries))
+	}
+	if d := deliveries[0]; d.Status != models.DeliveryDelivered || d.Attempts != 1 || d.ResponseCode != http.StatusOK {
+		t.Fatalf("delivery = %s after %d attempts with %d", d.Status, d.Attempts, d.ResponseCode)
+	}
+}
+
+func TestDeliverDueRetriesFailures(t *testing.T) {
+	db := newTestDB(t)
+	s := NewWebhookService(db, "http://forum.test")
+
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	id, err := s.CreateWebhook(receiver.URL, []string{models.WebhookUserRegistered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Emit(models.WebhookUserRegistered, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().UTC()
+	if err := s.deliverDue(); err != nil {
+		t.Fatal(err)
+	}
+	// The retry is not due yet.
+	if err := s.deliverDue(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("receiver called %d times, want 1", calls)
+	}
+
+	deliveries, err := s.GetDeliveries(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := deliveries[0]
+	if d.Status != models.DeliveryPending || d.Attempts != 1 || d.ResponseCode != http.StatusServiceUnavailable || d.Error == "" {
+		t.Fatalf("delivery = %s after %d attempts with %d %q", d.Status, d.Attempts, d.ResponseCode, d.Error)
+	}
+	if d.NextAttempt.Before(before.Add(webhookBackoff)) {
+		t.Fatalf("next attempt at %s, want %s after %s", d.NextAttempt, webhookBackoff, before)
+	}
+
+	// The last attempt marks the delivery as failed.
+	_, err = db.Exec("UPDATE webhook_deliveries SET attempts = $1, next_attempt_at = $2", webhookMaxAttempts-1, before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.deliverDue(); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err = s.GetDeliveries(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := deliveries[0]; d.Status != models.DeliveryFailed || d.Attempts != webhookMaxAttempts {
+		t.Fatalf("delivery = %s after %d attempts", d.Status, d.Attempts)
+	}
+}
+
+func TestEmitForPostSkipsRestrictedForums(t *testing.T) {
+	db := newTestDB(t)
+	s := NewWebhookService(db, "http://forum.test")
+
+	_, err := db.Exec(`
+		INSERT INTO users (id, username, email, password) VALUES ('u1', 'ann', 'ann@example.com', 'x');
+		INSERT INTO posts (id, title, content, uid, forum_id) VALUES
+			(1, 'public', 'x', 'u1', (SELECT id FROM forums WHERE slug = 'general')),
+			(2, 'staff', 'x', 'u1', (SELECT id FROM forums WHERE slug = 'staff'));`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := s.CreateWebhook("http://receiver.test", []string{models.WebhookPostCreated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, postID := range []int{1, 2} {
+		if err := s.EmitForPost(postID, models.WebhookPostCreated, map[string]interface{}{"id": postID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deliveries, err := s.GetDeliveries(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("%d deliveries, want 1", len(deliveries))
+	}
+	if want := `"data":{"id":1}`; !strings.Contains(deliveries[0].Payload, want) {
+		t.Fatalf("payload = %s, want the public post", deliveries[0].Payload)
+	}
+}
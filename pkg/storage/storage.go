@@ -0,0 +1,116 @@
+// Package storage keeps uploaded files. The forum only talks to the Storage
+// interface so the local disk can later be swapped for an object store.
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("storage: file not found")
+
+// File is an opened stored file.
+type File interface {
+	io.ReadSeekCloser
+	ModTime() time.Time
+}
+
+type Storage interface {
+	Put(key string, r io.Reader) error
+	Open(key string) (File, error)
+	Delete(key string) error
+}
+
+// Local stores files in a directory on disk.
+type Local struct {
+	Dir string
+}
+
+func NewLocal(dir string) *Local {
+	return &Local{Dir: dir}
+}
+
+func (s *Local) Put(key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write under a temporary name so readers never see half a file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Local) Open(key string) (File, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &localFile{File: file, modTime: info.ModTime()}, nil
+}
+
+func (s *Local) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path maps key to a file inside Dir, refusing keys that would escape it.
+func (s *Local) path(key string) (string, error) {
+	if key == "" || strings.Contains(key, "..") || strings.ContainsAny(key, `/\`) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.Dir, key), nil
+}
+
+type localFile struct {
+	*os.File
+	modTime time.Time
+}
+
+func (f *localFile) ModTime() time.Time {
+	return f.modTime
+}
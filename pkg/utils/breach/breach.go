@@ -0,0 +1,55 @@
+// Package breach checks passwords against a local copy of a breached password
+// list. The list is split into k-anonymity style range files: the password is
+// hashed with SHA-1 and the file named after the first five hex digits of the
+// hash holds "SUFFIX:COUNT" lines for the remaining 35 digits, the same format
+// the Pwned Passwords range API serves. Only one small file is read per check
+// and the full hash never leaves the process.
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Checker struct {
+	Dir string
+}
+
+func NewChecker(dir string) *Checker {
+	return &Checker{Dir: dir}
+}
+
+// Contains reports whether password is on the list. A missing range file
+// means the password is not known to be breached.
+func (c *Checker) Contains(password string) (bool, error) {
+	if c == nil || c.Dir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(c.Dir, prefix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -6,7 +6,8 @@ import (
 )
 
 const (
-	cookieName = "GSESSIONID"
+	cookieName      = "GSESSIONID"
+	oauthCookieName = "GOAUTHSTATE"
 )
 
 func SetCookie(w http.ResponseWriter, value string, maxAge time.Time) {
@@ -38,3 +39,31 @@ func DeleteCookie(w http.ResponseWriter) {
 	}
 	http.SetCookie(w, cookie)
 }
+
+// SetOAuthCookie remembers a pending OAuth authorization in the browser.
+func SetOAuthCookie(w http.ResponseWriter, value string, maxAge time.Time) {
+	cookie := &http.Cookie{
+		Name:     oauthCookieName,
+		Value:    value,
+		HttpOnly: true,
+		Path:     "/oauth/",
+		Expires:  maxAge,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, cookie)
+}
+
+func GetOAuthCookie(r *http.Request) (*http.Cookie, error) {
+	return r.Cookie(oauthCookieName)
+}
+
+func DeleteOAuthCookie(w http.ResponseWriter) {
+	cookie := &http.Cookie{
+		Name:     oauthCookieName,
+		Value:    "",
+		HttpOnly: true,
+		Path:     "/oauth/",
+		MaxAge:   -1,
+	}
+	http.SetCookie(w, cookie)
+}
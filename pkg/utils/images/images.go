@@ -0,0 +1,230 @@
+// Package images validates and normalizes uploaded pictures.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// Formats recognized by Detect.
+const (
+	JPEG = "jpeg"
+	PNG  = "png"
+	GIF  = "gif"
+	WebP = "webp"
+)
+
+var (
+	ErrUnsupported = errors.New("images: unsupported format")
+	ErrTooLarge    = errors.New("images: dimensions too large")
+)
+
+// maxPixels bounds decoded images so a small file cannot expand into a huge
+// bitmap.
+const maxPixels = 40_000_000
+
+// Image is an upload re-encoded from its pixels, which drops EXIF and any
+// other metadata of the original file.
+type Image struct {
+	Format      string
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+	Data        []byte
+	Thumb       []byte
+}
+
+// Detect recognizes the format of data by its magic bytes.
+func Detect(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return JPEG, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG, nil
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return GIF, nil
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return WebP, nil
+	}
+	return "", ErrUnsupported
+}
+
+// Process decodes data, re-encodes it and renders a thumbnail that fits in a
+// thumbSize square. Animated GIFs keep their frames; WebP is stored as PNG
+// because there is no WebP encoder in the standard library.
+func Process(data []byte, thumbSize int) (Image, error) {
+	format, err := Detect(data)
+	if err != nil {
+		return Image{}, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrUnsupported
+	}
+	if config.Width*config.Height > maxPixels {
+		return Image{}, ErrTooLarge
+	}
+
+	var out bytes.Buffer
+	var first image.Image
+	img := Image{Format: format, Width: config.Width, Height: config.Height}
+
+	switch format {
+	case GIF:
+		// Every frame is decoded into a bitmap of its own, so an animation
+		// of many tiny frames in a small file is bounded as a whole.
+		if gifPixels(data) > maxPixels {
+			return Image{}, ErrTooLarge
+		}
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(anim.Image) == 0 {
+			return Image{}, ErrUnsupported
+		}
+		// Only frames are written back, comments and application
+		// extensions are dropped.
+		if err := gif.EncodeAll(&out, &gif.GIF{
+			Image:     anim.Image,
+			Delay:     anim.Delay,
+			LoopCount: anim.LoopCount,
+			Disposal:  anim.Disposal,
+			Config:    anim.Config,
+		}); err != nil {
+			return Image{}, err
+		}
+		first = anim.Image[0]
+		img.ContentType, img.Ext = "image/gif", ".gif"
+	case JPEG:
+		first, err = jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Image{}, ErrUnsupported
+		}
+		if err := jpeg.Encode(&out, first, &jpeg.Options{Quality: 90}); err != nil {
+			return Image{}, err
+		}
+		img.ContentType, img.Ext = "image/jpeg", ".jpg"
+	case PNG, WebP:
+		if format == PNG {
+			first, err = png.Decode(bytes.NewReader(data))
+		} else {
+			first, err = webp.Decode(bytes.NewReader(data))
+		}
+		if err != nil {
+			return Image{}, ErrUnsupported
+		}
+		if err := png.Encode(&out, first); err != nil {
+			return Image{}, err
+		}
+		img.ContentType, img.Ext = "image/png", ".png"
+	}
+	img.Data = out.Bytes()
+
+	thumb, err := encodeThumb(first, thumbSize, img.ContentType)
+	if err != nil {
+		return Image{}, err
+	}
+	img.Thumb = thumb
+
+	return img, nil
+}
+
+// gifPixels adds up the pixels of all frames of a GIF by walking its blocks
+// without decoding any image data. It stops counting where the data ends or
+// stops looking like a GIF and leaves reporting that to the decoder.
+func gifPixels(data []byte) int {
+	// Header, logical screen descriptor and global color table.
+	p := 13
+	if len(data) < p {
+		return 0
+	}
+	if flags := data[10]; flags&0x80 != 0 {
+		p += 3 << (flags&0x07 + 1)
+	}
+
+	total := 0
+	for p < len(data) {
+		switch data[p] {
+		case 0x21: // extension: label and sub-blocks
+			p = skipSubBlocks(data, p+2)
+		case 0x2C: // image descriptor
+			if p+10 > len(data) {
+				return total
+			}
+			width := int(data[p+5]) | int(data[p+6])<<8
+			height := int(data[p+7]) | int(data[p+8])<<8
+			total += width * height
+			flags := data[p+9]
+			p += 10
+			if flags&0x80 != 0 {
+				p += 3 << (flags&0x07 + 1)
+			}
+			// LZW minimum code size, then the image data sub-blocks.
+			p = skipSubBlocks(data, p+1)
+		default: // trailer or garbage
+			return total
+		}
+	}
+	return total
+}
+
+// skipSubBlocks returns the position after the sub-blocks starting at p.
+func skipSubBlocks(data []byte, p int) int {
+	for p < len(data) {
+		n := int(data[p])
+		p++
+		if n == 0 {
+			return p
+		}
+		p += n
+	}
+	return p
+}
+
+// encodeThumb scales src down to fit in a size square, never up. Thumbnails
+// of GIFs are still pictures of the first frame.
+func encodeThumb(src image.Image, size int, contentType string) ([]byte, error) {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > size || h > size {
+		if w >= h {
+			h = h * size / w
+			w = size
+		} else {
+			w = w * size / h
+			h = size
+		}
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var out bytes.Buffer
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&out, dst, &jpeg.Options{Quality: 85})
+	case "image/gif":
+		err = gif.Encode(&out, dst, nil)
+	default:
+		err = png.Encode(&out, dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,62 @@
+package tokens
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalid = errors.New("invalid token")
+	ErrExpired = errors.New("token expired")
+)
+
+// Sign returns a URL-safe token binding subject to purpose until exp.
+func Sign(secret []byte, purpose, subject string, exp time.Time) string {
+	payload := purpose + "\n" + subject + "\n" + strconv.FormatInt(exp.Unix(), 10)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac(secret, encoded))
+}
+
+// Verify checks a token produced by Sign for the same purpose and returns its subject.
+func Verify(secret []byte, purpose, token string) (string, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalid
+	}
+
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(given, mac(secret, encoded)) {
+		return "", ErrInvalid
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalid
+	}
+
+	parts := strings.SplitN(string(raw), "\n", 3)
+	if len(parts) != 3 || parts[0] != purpose {
+		return "", ErrInvalid
+	}
+
+	exp, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	if time.Now().Unix() > exp {
+		return "", ErrExpired
+	}
+
+	return parts[1], nil
+}
+
+func mac(secret []byte, data string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
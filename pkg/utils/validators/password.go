@@ -0,0 +1,95 @@
+package validators
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxPasswordBytes is the longest password bcrypt can hash; it ignores
+// everything after the first 72 bytes.
+const MaxPasswordBytes = 72
+
+// PasswordPolicy describes what a new password must look like.
+type PasswordPolicy struct {
+	MinLength int
+	// MinClasses is how many of lowercase, uppercase, digits and symbols the
+	// password must mix.
+	MinClasses int
+	// RejectPersonal forbids passwords containing the username or the local
+	// part of the email.
+	RejectPersonal bool
+}
+
+// PasswordError explains why a password does not satisfy a policy.
+type PasswordError struct {
+	Reason string
+}
+
+func (e *PasswordError) Error() string {
+	return e.Reason
+}
+
+// DefaultPasswordPolicy is used when no policy is configured.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:      8,
+	MinClasses:     2,
+	RejectPersonal: true,
+}
+
+// Validate checks password of the user with username and email against the
+// policy.
+func (p PasswordPolicy) Validate(password, username, email string) error {
+	if len(password) < p.MinLength {
+		return &PasswordError{"Password must have at least " + strconv.Itoa(p.MinLength) + " characters"}
+	}
+
+	if len(password) > MaxPasswordBytes {
+		return &PasswordError{"Password must have at most " + strconv.Itoa(MaxPasswordBytes) + " characters, fewer if it uses accented letters or emoji"}
+	}
+
+	if passwordClasses(password) < p.MinClasses {
+		return &PasswordError{"Password must mix at least " + strconv.Itoa(p.MinClasses) + " of lowercase letters, uppercase letters, digits and symbols"}
+	}
+
+	if p.RejectPersonal {
+		lower := strings.ToLower(password)
+		local, _, _ := strings.Cut(email, "@")
+		for _, personal := range []string{username, local} {
+			if len(personal) >= 3 && strings.Contains(lower, strings.ToLower(personal)) {
+				return &PasswordError{"Password must not contain your username or email"}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Hint describes the policy to the user.
+func (p PasswordPolicy) Hint() string {
+	hint := "Between " + strconv.Itoa(p.MinLength) + " and " + strconv.Itoa(MaxPasswordBytes) + " characters"
+	if p.MinClasses > 1 {
+		hint += ", mixing " + strconv.Itoa(p.MinClasses) + " of lowercase, uppercase, digits and symbols"
+	}
+	if p.RejectPersonal {
+		hint += ", not containing your username or email"
+	}
+	return hint + "."
+}
+
+func passwordClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
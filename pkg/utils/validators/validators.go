@@ -3,6 +3,7 @@ package validators
 import (
 	"errors"
 	"regexp"
+	"strconv"
 )
 
 func NonBlankValidate(input string) error {
@@ -29,14 +30,30 @@ func PasswordValidate(password string) error {
 
 func LengthRangeValidate(input string, min, max int) error {
 	if len(input) < min || len(input) > max {
-		return errors.New("length must be between " + string(min) + " and " + string(max))
+		return errors.New("length must be between " + strconv.Itoa(min) + " and " + strconv.Itoa(max))
 	}
 	return nil
 }
 
 func TextLengthValidate(text string, maxLength int) error {
 	if len(text) > maxLength {
-		return errors.New("text is too long, maximum length is " + string(maxLength))
+		return errors.New("text is too long, maximum length is " + strconv.Itoa(maxLength))
+	}
+	return nil
+}
+
+func SlugValidate(slug string) error {
+	slugRegex := `^[a-z0-9]+(-[a-z0-9]+)*$`
+	if matched, _ := regexp.MatchString(slugRegex, slug); !matched {
+		return errors.New("slug may contain only lowercase letters, digits and dashes")
+	}
+	return nil
+}
+
+func ColorValidate(color string) error {
+	colorRegex := `^#[0-9a-fA-F]{6}$`
+	if matched, _ := regexp.MatchString(colorRegex, color); !matched {
+		return errors.New("color must be in #rrggbb format")
 	}
 	return nil
 }
@@ -1,11 +1,20 @@
 package views
 
+import (
+	"forum/pkg/models"
+	"html/template"
+)
+
 type CommentView struct {
-	ID            int
-	Author        string
-	Content       string
-	LikesCount    int
-	DislikesCount int
-	IsLiked       bool
-	IsDisliked    bool
+	ID           int
+	Author       string
+	Content      string
+	ContentHTML  template.HTML
+	Reactions    []models.ReactionCount
+	IsBookmarked bool
+	// Unread is set for comments added since the viewer last read the
+	// thread.
+	Unread bool
+	// Pending is set while the comment waits for the staff to approve it.
+	Pending bool
 }
@@ -0,0 +1,9 @@
+package views
+
+import "forum/pkg/models"
+
+type ForumView struct {
+	Forum    models.Forum
+	Stats    models.ForumStats
+	Children []models.Forum
+}
@@ -1,11 +1,24 @@
 package views
 
-import "forum/pkg/models"
+import (
+	"forum/pkg/models"
+	"html/template"
+	"time"
+)
 
 type PostView struct {
 	AuthorName string
 	Title      string
 	Content    string
-	Cats       []models.Category
-	Id         int
+	// ContentHTML is the sanitized rendering of Content.
+	ContentHTML template.HTML
+	Cats        []models.Category
+	Id          int
+	CreatedAt   time.Time
+	// Unread counts the comments added since the viewer last read the
+	// thread. Unseen is set when the viewer never opened it.
+	Unread int
+	Unseen bool
+	// Pending is set while the post waits for the staff to approve it.
+	Pending bool
 }
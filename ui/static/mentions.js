@@ -0,0 +1,43 @@
+// Suggests usernames while typing an @mention in the textarea with the id
+// content. Clicking a suggestion completes the mention.
+(function () {
+    var content = document.getElementById("content");
+    if (!content) {
+        return;
+    }
+    var list = document.createElement("ul");
+    list.id = "mentionSuggestions";
+    list.hidden = true;
+    content.parentNode.insertBefore(list, content.nextSibling);
+    function mentionBeforeCursor() {
+        var text = content.value.slice(0, content.selectionStart);
+        var match = /(^|[^A-Za-z0-9_])@([A-Za-z0-9_.-]{1,10})$/.exec(text);
+        return match ? match[2] : null;
+    }
+    content.addEventListener("input", function () {
+        var prefix = mentionBeforeCursor();
+        if (prefix === null) {
+            list.hidden = true;
+            return;
+        }
+        fetch("/api/users/suggest?q=" + encodeURIComponent(prefix), {credentials: "same-origin"})
+            .then(function (res) { return res.json(); })
+            .then(function (users) {
+                list.innerHTML = "";
+                users.forEach(function (user) {
+                    var item = document.createElement("li");
+                    item.textContent = "@" + user.username + (user.displayName ? " (" + user.displayName + ")" : "");
+                    item.addEventListener("click", function () {
+                        var cursor = content.selectionStart;
+                        var start = cursor - prefix.length;
+                        content.value = content.value.slice(0, start) + user.username + " " + content.value.slice(cursor);
+                        content.selectionStart = content.selectionEnd = start + user.username.length + 1;
+                        list.hidden = true;
+                        content.focus();
+                    });
+                    list.appendChild(item);
+                });
+                list.hidden = users.length === 0;
+            });
+    });
+})();
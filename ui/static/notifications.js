@@ -0,0 +1,34 @@
+// Shows the number of unread notifications in the element with the id
+// notificationBadge and keeps it current with the live updates of the user.
+// Guests keep the badge hidden.
+(function () {
+    var badge = document.getElementById("notificationBadge");
+    if (!badge) {
+        return;
+    }
+    function show(unread) {
+        badge.querySelector("span").textContent = unread > 0 ? " (" + unread + ")" : "";
+        badge.hidden = false;
+    }
+    function listen() {
+        if (!window.EventSource) {
+            return;
+        }
+        var source = new EventSource("/events/user");
+        source.addEventListener("notification", function (e) {
+            show(JSON.parse(e.data).unread);
+        });
+    }
+    fetch("/api/notifications/unread", {credentials: "same-origin"})
+        .then(function (res) {
+            if (!res.ok) {
+                throw new Error(res.statusText);
+            }
+            return res.json();
+        })
+        .then(function (data) {
+            show(data.unread);
+            listen();
+        })
+        .catch(function () {});
+})();
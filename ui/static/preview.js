@@ -0,0 +1,17 @@
+// Shows how the Markdown in the textarea with the id content will be
+// rendered when the button with the id previewButton is clicked.
+(function () {
+    var button = document.getElementById("previewButton");
+    var content = document.getElementById("content");
+    var preview = document.getElementById("preview");
+    if (!button || !content || !preview) {
+        return;
+    }
+    button.addEventListener("click", function () {
+        var body = new URLSearchParams();
+        body.set("content", content.value);
+        fetch("/preview", {method: "POST", body: body, credentials: "same-origin"})
+            .then(function (res) { return res.text(); })
+            .then(function (html) { preview.innerHTML = html; });
+    });
+})();